@@ -36,6 +36,10 @@ type SimpleChaincode struct {
 
 var marbleIndexStr = "_marbleindex"				//name for the key/value that will store a list of all known marbles
 var openTradesStr = "_opentrades"				//name for the key/value that will store all open trades
+var roleAttribute = "role"						//certificate attribute holding the caller's role
+var adminRole = "admin"							//role allowed to re-run init, write, delete and reset
+var resetConfirmation = "RESET"					//what reset's argument must be, so nobody wipes the ledger by accident
+var chaincodeResetEvent = "chaincode_reset"		//sent once reset has run
 
 type Marble struct{
 	Name string `json:"name"`					//the fieldtags are needed to keep case from bouncing around
@@ -71,7 +75,7 @@ func main() {
 }
 
 // ============================================================================================================================
-// Init - reset all the things
+// Init - set up the test var and an empty marble index, marbles already on the ledger are kept
 // ============================================================================================================================
 func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
 	var Aval int
@@ -93,16 +97,12 @@ func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args [
 		return nil, err
 	}
 	
-	var empty []string
-	jsonAsBytes, _ := json.Marshal(empty)								//marshal an emtpy array of strings to clear the index
-	err = stub.PutState(marbleIndexStr, jsonAsBytes)
+	err = initIndex(stub, marbleIndexStr, []string{})					//only if there is none, init used to wipe the index
 	if err != nil {
 		return nil, err
 	}
 	
-	var trades AllTrades
-	jsonAsBytes, _ = json.Marshal(trades)								//clear the open trade struct
-	err = stub.PutState(openTradesStr, jsonAsBytes)
+	err = initIndex(stub, openTradesStr, AllTrades{})					//same for the open trades
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +110,33 @@ func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args [
 	return nil, nil
 }
 
+// ============================================================================================================================
+// initIndex - store empty under name unless something is already there
+// ============================================================================================================================
+func initIndex(stub *shim.ChaincodeStub, name string, empty interface{}) error {
+	indexAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return errors.New("Failed to get " + name)
+	}
+	if len(indexAsBytes) > 0 {
+		return nil
+	}
+	jsonAsBytes, _ := json.Marshal(empty)
+	return stub.PutState(name, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// requireAdmin - make sure the caller's certificate carries the admin role
+// ============================================================================================================================
+func requireAdmin(stub *shim.ChaincodeStub, action string) error {
+	role, err := stub.ReadCertAttribute(roleAttribute)
+	if err != nil || strings.ToLower(strings.TrimSpace(string(role))) != adminRole {
+		fmt.Println("! caller without the " + adminRole + " role tried to " + action)
+		return errors.New("only an admin can " + action)
+	}
+	return nil
+}
+
 // ============================================================================================================================
 // Run - Our entry point for Invocations - [LEGACY] obc-peer 4/25/2016
 // ============================================================================================================================
@@ -125,8 +152,14 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 	fmt.Println("invoke is running " + function)
 
 	// Handle different functions
-	if function == "init" {													//initialize the chaincode state, used as reset
+	if function == "init" {													//initialize the chaincode state
+		err := requireAdmin(stub, "run init")								//only an admin can run it again once deployed
+		if err != nil {
+			return nil, err
+		}
 		return t.Init(stub, "init", args)
+	} else if function == "reset" {											//deletes every marble and empties the index
+		return t.reset(stub, args)
 	} else if function == "delete" {										//deletes an entity from its state
 		res, err := t.Delete(stub, args)
 		cleanTrades(stub)													//lets make sure all open trades are still valid
@@ -189,6 +222,54 @@ func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte,
 	return valAsbytes, nil													//send it onward
 }
 
+// ============================================================================================================================
+// Reset - delete every marble and open trade and empty the index, admin only, takes the place init used to have
+// ============================================================================================================================
+func (t *SimpleChaincode) reset(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+	err := requireAdmin(stub, "reset the chaincode")
+	if err != nil {
+		return nil, err
+	}
+
+	//    0
+	// "RESET"
+	if len(args) != 1 || args[0] != resetConfirmation {
+		return nil, errors.New("reset deletes every marble, pass \"" + resetConfirmation + "\" to confirm")
+	}
+
+	marblesAsBytes, err := stub.GetState(marbleIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get marble index")
+	}
+	var marbleIndex []string
+	json.Unmarshal(marblesAsBytes, &marbleIndex)							//un stringify it aka JSON.parse()
+	for _, name := range marbleIndex {
+		err = stub.DelState(name)
+		if err != nil {
+			return nil, errors.New("Failed to delete " + name)
+		}
+	}
+	jsonAsBytes, _ := json.Marshal([]string{})
+	err = stub.PutState(marbleIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonAsBytes, _ = json.Marshal(AllTrades{})								//trades for marbles that are gone can't be performed
+	err = stub.PutState(openTradesStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- reset deleted " + strconv.Itoa(len(marbleIndex)) + " marbles")
+	payload, _ := json.Marshal(map[string]interface{}{"tx_id": stub.UUID, "deleted": len(marbleIndex)})
+	err = stub.SetEvent(chaincodeResetEvent, payload)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 // ============================================================================================================================
 // Delete - remove a key/value pair from state
 // ============================================================================================================================
@@ -196,9 +277,13 @@ func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byt
 	if len(args) != 1 {
 		return nil, errors.New("Incorrect number of arguments. Expecting 1")
 	}
+	err := requireAdmin(stub, "delete state")								//deletes any key, not just the caller's marbles
+	if err != nil {
+		return nil, err
+	}
 	
 	name := args[0]
-	err := stub.DelState(name)													//remove the key from chaincode state
+	err = stub.DelState(name)													//remove the key from chaincode state
 	if err != nil {
 		return nil, errors.New("Failed to delete state")
 	}
@@ -239,6 +324,10 @@ func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte
 	if len(args) != 2 {
 		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
 	}
+	err = requireAdmin(stub, "write state")								//overwrites any key, marbles and the index included
+	if err != nil {
+		return nil, err
+	}
 
 	name = args[0]															//rename for funsies
 	value = args[1]
@@ -0,0 +1,70 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/chaitanyaamin/marbles-chaincode/marbles"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// SimpleChaincode marbles for Fabric 1.x and later peers, the marbles logic itself lives in the marbles package
+type SimpleChaincode struct {
+	Marbles marbles.Chaincode				//shared handlers, set Marbles.Identify to fake the caller
+}
+
+// ============================================================================================================================
+// Main
+// ============================================================================================================================
+func main() {
+	err := shim.Start(new(SimpleChaincode))
+	if err != nil {
+		fmt.Printf("Error starting Simple chaincode: %s", err)
+	}
+}
+
+// ============================================================================================================================
+// Init - Our entry point for instantiate and upgrade, takes the same args as the "init" function
+// ============================================================================================================================
+func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()								//the function name is ignored, as it was on older peers
+	return respond(t.Marbles.Init(shimState{stub}, args))
+}
+
+// ============================================================================================================================
+// Invoke - Our entry point for Invocations and Queries, both come through here on current peers
+// ============================================================================================================================
+func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	function, args := stub.GetFunctionAndParameters()
+	fmt.Println("invoke is running " + function)
+	return respond(t.Marbles.Call(shimState{stub}, function, args))
+}
+
+// ============================================================================================================================
+// respond - turn a handler's result into a peer response, a 4xx when the caller got the request wrong, 500 otherwise
+// ============================================================================================================================
+func respond(payload []byte, err error) pb.Response {
+	if err == nil {
+		return shim.Success(payload)
+	}
+	return pb.Response{Status: int32(marbles.ErrorStatus(err)), Message: err.Error()}
+}
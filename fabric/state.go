@@ -0,0 +1,149 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+	"github.com/chaitanyaamin/marbles-chaincode/marbles"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+var compositeKeySeparator = "\x00"        //starts every marbles index key, same layout as the shim's CreateCompositeKey
+var peerIndexPrefix = ledger.MaxKeySuffix //stands in for it on the peer, see peerKey
+
+// shimState adapts the peer's stub to marbles.ChaincodeState
+type shimState struct {
+	shim.ChaincodeStubInterface
+}
+
+// rangeIterator hands back the peer's keys as the marbles keys they stand for
+type rangeIterator struct {
+	shim.StateQueryIteratorInterface
+}
+
+// ============================================================================================================================
+// peerKey - the key the peer stores key under
+// ============================================================================================================================
+// Current peers refuse range scans whose bounds start with the composite key separator, so marbles index keys are
+// stored with it swapped for peerIndexPrefix. That keeps them in the same order, after every flat key, and lets
+// GetStateByRange take both bounds of an index scan instead of reading the index from its first key.
+func peerKey(key string) string {
+	if strings.HasPrefix(key, compositeKeySeparator) {
+		return peerIndexPrefix + key[len(compositeKeySeparator):]
+	}
+	return key
+}
+
+// ============================================================================================================================
+// marblesKey - undo peerKey
+// ============================================================================================================================
+func marblesKey(key string) string {
+	if strings.HasPrefix(key, peerIndexPrefix) {
+		return compositeKeySeparator + key[len(peerIndexPrefix):]
+	}
+	return key
+}
+
+// ============================================================================================================================
+// GetState - read key from the peer
+// ============================================================================================================================
+func (s shimState) GetState(key string) ([]byte, error) {
+	return s.ChaincodeStubInterface.GetState(peerKey(key))
+}
+
+// ============================================================================================================================
+// PutState - write key to the peer
+// ============================================================================================================================
+func (s shimState) PutState(key string, value []byte) error {
+	return s.ChaincodeStubInterface.PutState(peerKey(key), value)
+}
+
+// ============================================================================================================================
+// DelState - delete key from the peer
+// ============================================================================================================================
+func (s shimState) DelState(key string) error {
+	return s.ChaincodeStubInterface.DelState(peerKey(key))
+}
+
+// ============================================================================================================================
+// RangeQueryState - scan the keys between startKey and endKey, inclusive
+// ============================================================================================================================
+func (s shimState) RangeQueryState(startKey, endKey string) (marbles.StateIterator, error) {
+	iter, err := s.GetStateByRange(peerKey(startKey), peerKey(endKey)+compositeKeySeparator) //its end is exclusive, ours inclusive
+	if err != nil {
+		return nil, err
+	}
+	return rangeIterator{iter}, nil
+}
+
+// ============================================================================================================================
+// GetCallerCertificate - the submitter's certificate, DER encoded
+// ============================================================================================================================
+func (s shimState) GetCallerCertificate() ([]byte, error) {
+	cert, err := cid.GetX509Certificate(s.ChaincodeStubInterface)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, errors.New("transaction creator has no certificate")
+	}
+	return cert.Raw, nil
+}
+
+// ============================================================================================================================
+// ReadCertAttribute - read an attribute the CA put in the submitter's certificate
+// ============================================================================================================================
+func (s shimState) ReadCertAttribute(attributeName string) ([]byte, error) {
+	value, found, err := cid.GetAttributeValue(s.ChaincodeStubInterface, attributeName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("attribute " + attributeName + " not found")
+	}
+	return []byte(value), nil
+}
+
+// ============================================================================================================================
+// GetTxTime - the transaction timestamp as a time.Time
+// ============================================================================================================================
+func (s shimState) GetTxTime() (time.Time, error) {
+	ts, err := s.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// ============================================================================================================================
+// Next - return the next key/value pair in the range
+// ============================================================================================================================
+func (i rangeIterator) Next() (string, []byte, error) {
+	kv, err := i.StateQueryIteratorInterface.Next()
+	if err != nil {
+		return "", nil, err
+	}
+	return marblesKey(kv.Key), kv.Value, nil
+}
@@ -0,0 +1,151 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// fakeStub keeps state in a map and, like the real shim, refuses range bounds that start with the composite separator
+type fakeStub struct {
+	shim.ChaincodeStubInterface //anything the adapter shouldn't call panics
+	state                       map[string][]byte
+	scanned                     int //keys handed out by GetStateByRange
+}
+
+// fakeIterator walks a snapshot of the keys in a range
+type fakeIterator struct {
+	stub *fakeStub
+	kvs  []*queryresult.KV
+}
+
+func (f *fakeStub) GetState(key string) ([]byte, error) {
+	return f.state[key], nil
+}
+
+func (f *fakeStub) PutState(key string, value []byte) error {
+	f.state[key] = value
+	return nil
+}
+
+func (f *fakeStub) DelState(key string) error {
+	delete(f.state, key)
+	return nil
+}
+
+func (f *fakeStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if (len(startKey) > 0 && startKey[0] == 0) || (len(endKey) > 0 && endKey[0] == 0) {
+		return nil, errors.New("first character of the key contains a null character which is not allowed")
+	}
+	var keys []string
+	for key := range f.state {
+		if key >= startKey && key < endKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	iter := &fakeIterator{stub: f}
+	for _, key := range keys {
+		iter.kvs = append(iter.kvs, &queryresult.KV{Key: key, Value: f.state[key]})
+	}
+	return iter, nil
+}
+
+func (i *fakeIterator) HasNext() bool {
+	return len(i.kvs) > 0
+}
+
+func (i *fakeIterator) Next() (*queryresult.KV, error) {
+	kv := i.kvs[0]
+	i.kvs = i.kvs[1:]
+	i.stub.scanned++
+	return kv, nil
+}
+
+func (i *fakeIterator) Close() error {
+	return nil
+}
+
+func TestRangeQueryStateStaysInRange(t *testing.T) {
+	peer := &fakeStub{state: map[string][]byte{}}
+	stub := shimState{peer}
+	for _, key := range []string{"_marbleindex", "m1"} {
+		stub.PutState(key, []byte(key))
+	}
+	for _, size := range []string{"0000000005", "0000000010", "0000000015", "0000000020", "0000000025"} {
+		key, _ := ledger.CreateCompositeKey("size~name", []string{size, "m" + size})
+		stub.PutState(key, []byte{0})
+	}
+
+	startKey, _ := ledger.CreateCompositeKey("size~name", []string{"0000000010"})
+	endKey, _ := ledger.CreateCompositeKey("size~name", []string{"0000000020" + ledger.MaxKeySuffix})
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, attributes, err := ledger.SplitCompositeKey(key)
+		if err != nil {
+			t.Fatalf("%q came back without its composite layout", key)
+		}
+		found = append(found, attributes[1])
+	}
+	iter.Close()
+	if want := []string{"m0000000010", "m0000000015", "m0000000020"}; !reflect.DeepEqual(found, want) {
+		t.Fatalf("sizes 10 to 20 = %q, want %q", found, want)
+	}
+	if peer.scanned != 3 {
+		t.Errorf("the peer handed out %d keys for 3 in range", peer.scanned)
+	}
+
+	iter, err = stub.RangeQueryState("\x01", ledger.MaxKeySuffix) //what migrate_keyspace scans
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = nil
+	for iter.HasNext() {
+		key, _, _ := iter.Next()
+		found = append(found, key)
+	}
+	if want := []string{"_marbleindex", "m1"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("flat keys = %q, want %q", found, want)
+	}
+
+	value, err := stub.GetState(startKey + "m0000000010\x00")
+	if err != nil || len(value) != 1 {
+		t.Errorf("GetState of an index key = %v, %v", value, err)
+	}
+	stub.DelState(startKey + "m0000000010\x00")
+	if len(peer.state) != 6 {
+		t.Errorf("%d keys left on the peer after deleting one of 7", len(peer.state))
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var accountObject = "account" //account~<id> holds a single Account
+
+var paymentExecuted = "executed" //PaymentTransaction.Status once the funds have moved
+
+// Account per currency balances held by one party
+type Account struct {
+	ID        string           `json:"id"`
+	Balances  map[string]Money `json:"balances"`  //currency code -> balance in that currency
+	CreatedAt int64            `json:"createdAt"` //utc ms, from the transaction that opened it
+}
+
+// ============================================================================================================================
+// accountKey - the ledger key an account is stored under
+// ============================================================================================================================
+func accountKey(id string) (string, error) {
+	return ledger.CreateCompositeKey(accountObject, []string{strings.ToLower(id)})
+}
+
+// ============================================================================================================================
+// findAccount - read an account, nil if there is none
+// ============================================================================================================================
+func findAccount(stub ChaincodeState, id string) (*Account, error) {
+	key, err := accountKey(id)
+	if err != nil {
+		return nil, err
+	}
+	accountAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get account " + id)
+	}
+	if accountAsBytes == nil {
+		return nil, nil
+	}
+	var account Account
+	err = json.Unmarshal(accountAsBytes, &account) //un stringify it aka JSON.parse()
+	if err != nil {
+		return nil, errors.New("account " + id + " is malformed - " + err.Error())
+	}
+	if account.Balances == nil {
+		account.Balances = make(map[string]Money)
+	}
+	return &account, nil
+}
+
+// ============================================================================================================================
+// getAccount - read an account that has to exist
+// ============================================================================================================================
+func getAccount(stub ChaincodeState, id string) (Account, error) {
+	account, err := findAccount(stub, id)
+	if err != nil {
+		return Account{}, err
+	}
+	if account == nil {
+		return Account{}, notFound("account " + id + " does not exist")
+	}
+	return *account, nil
+}
+
+// ============================================================================================================================
+// putAccount - write an account
+// ============================================================================================================================
+func putAccount(stub ChaincodeState, account Account) error {
+	key, err := accountKey(account.ID)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(account)
+	return stub.PutState(key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// balanceOf - what an account holds in a currency, zero if it never held any
+// ============================================================================================================================
+func (a Account) balanceOf(currency string) Money {
+	if balance, ok := a.Balances[currency]; ok {
+		return balance
+	}
+	return Money{Currency: currency}
+}
+
+// ============================================================================================================================
+// moveFunds - debit one account and credit another, refusing to overdraw the debited account
+// ============================================================================================================================
+func moveFunds(stub ChaincodeState, fromID string, toID string, amount Money) error {
+	from, err := getAccount(stub, fromID)
+	if err != nil {
+		return err
+	}
+	debited, err := from.balanceOf(amount.Currency).Sub(amount)
+	if err != nil {
+		return err
+	}
+	if debited.Units < 0 {
+		return conflict("account " + from.ID + " has insufficient " + amount.Currency + " funds")
+	}
+	from.Balances[amount.Currency] = debited
+	err = putAccount(stub, from)
+	if err != nil {
+		return err
+	}
+
+	to, err := getAccount(stub, toID) //read after the debit so paying yourself nets out
+	if err != nil {
+		return err
+	}
+	to.Balances[amount.Currency], err = to.balanceOf(amount.Currency).Add(amount)
+	if err != nil {
+		return err
+	}
+	return putAccount(stub, to)
+}
+
+// ============================================================================================================================
+// Create Account - open an empty account
+// ============================================================================================================================
+func (t *SimpleChaincode) create_account(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &CreateAccountRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "alice"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the account id")
+	}
+	id := strings.ToLower(args[0])
+	err = t.authorize(stub, id, "open an account") //users open their own, admins open them for anyone
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := findAccount(stub, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, conflict("account " + id + " already exists")
+	}
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+
+	fmt.Println("- create account " + id)
+	account := Account{ID: id, Balances: make(map[string]Money), CreatedAt: txTime.UnixNano() / int64(time.Millisecond)}
+	err = putAccount(stub, account)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Deposit - add funds in one currency to an account
+// ============================================================================================================================
+func (t *SimpleChaincode) deposit(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &DepositRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0        1       2
+	// "alice", "100", "usd"
+	if len(args) != 3 {
+		return nil, argError("Incorrect number of arguments. Expecting 3")
+	}
+	amount, err := ParseMoney(args[1], args[2]) //amounts must be exact in their currency, nothing is rounded
+	if err != nil {
+		return nil, argError("2nd and 3rd arguments must be an amount and its currency - " + err.Error())
+	}
+	if amount.Units <= 0 {
+		return nil, argError("2nd argument must be a positive amount")
+	}
+	err = t.requireRoles(stub, "deposit funds", adminRole, funderRole) //a deposit creates money, it must come from off ledger
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := getAccount(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	account.Balances[amount.Currency], err = account.balanceOf(amount.Currency).Add(amount)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- deposit " + amount.String() + " to " + account.ID)
+	err = putAccount(stub, account)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Execute Payment - move a SmartPay transaction's payment from the drawer's account to the payee's
+// ============================================================================================================================
+func (t *SimpleChaincode) execute_payment(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &ExecutePaymentRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "sp1"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the SmartPay transaction id")
+	}
+	smartPay, err := getSmartPay(stub, strings.ToLower(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	payment := smartPay.PaymentTrans
+	err = t.authorize(stub, payment.DrawerID, "execute a payment") //only the drawer's own funds can be sent
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status == paymentExecuted {
+		return nil, conflict("payment " + payment.PaymentTransID + " was already executed")
+	}
+	if payment.Amount.Units <= 0 {
+		return nil, conflict("payment " + payment.PaymentTransID + " has no amount to move")
+	}
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+
+	fmt.Println("- start execute payment " + payment.PaymentTransID)
+	batch := ledger.NewBatch(stub) //nothing is written unless both sides check out
+	err = moveFunds(batch, payment.DrawerID, payment.PayeeID, payment.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	smartPay.PaymentTrans.Status = paymentExecuted
+	smartPay.PaymentTrans.ExecutedAt = txTime.UnixNano() / int64(time.Millisecond)
+	err = putSmartPay(batch, smartPay)
+	if err != nil {
+		return nil, err
+	}
+
+	err = batch.Commit()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end execute payment")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Balance - an account's balances, or its balance in one currency
+// ============================================================================================================================
+func (t *SimpleChaincode) balance(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0        1*
+	// "alice", "usd"
+	if len(args) < 1 || len(args) > 2 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the account id and optionally a currency")
+	}
+	account, err := getAccount(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		currency, _, err := normalizeCurrency(args[1])
+		if err != nil {
+			return nil, err
+		}
+		account.Balances = map[string]Money{currency: account.balanceOf(currency)}
+	}
+	return json.Marshal(account)
+}
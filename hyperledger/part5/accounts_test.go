@@ -0,0 +1,69 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecutePaymentMovesFunds(t *testing.T) {
+	c := seedChain(t)
+	if _, err := c.as(alice).invoke("execute_payment", "sp1"); err == nil || !strings.Contains(err.Error(), "insufficient") {
+		t.Fatalf("execute_payment before alice is funded = %v", err)
+	}
+	c.as(funder).mustInvoke("deposit", `{"accountID":"alice","amount":20,"currency":"usd"}`)
+	c.as(funder).mustInvoke("deposit", "alice", "5", "eur") //a second currency is kept apart
+	c.as(alice).mustInvoke("execute_payment", `{"smartPayTransID":"SP1"}`)
+
+	tests := []struct {
+		id, currency, want string
+	}{
+		{"alice", "usd", "9.50 USD"},
+		{"alice", "eur", "5.00 EUR"},
+		{"bob", "usd", "10.50 USD"},
+		{"bob", "eur", "0.00 EUR"},
+	}
+	for _, tt := range tests {
+		if got := c.balance(tt.id, tt.currency); got != tt.want {
+			t.Errorf("%s has %s, want %s", tt.id, got, tt.want)
+		}
+	}
+	payment := c.smartPay("sp1").PaymentTrans
+	if payment.Status != paymentExecuted || payment.ExecutedAt == 0 {
+		t.Fatalf("payment = %v, want it marked executed", payment)
+	}
+	if _, err := c.as(alice).invoke("execute_payment", "sp1"); err == nil {
+		t.Fatal("the same payment was executed twice")
+	}
+}
+
+func TestExecutePaymentWritesNothingOnFailure(t *testing.T) {
+	c := seedChain(t)
+	c.fund("alice", "20", "usd")
+	key, _ := accountKey("bob")
+	delete(c.st.State, key) //alice can be debited, but there is nowhere to credit
+	if _, err := c.as(alice).invoke("execute_payment", "sp1"); err == nil {
+		t.Fatal("paid into a missing account")
+	}
+	if c.balance("alice", "usd") != "20.00 USD" || c.smartPay("sp1").PaymentTrans.Status == paymentExecuted {
+		t.Fatalf("alice has %s after a failed payment", c.balance("alice", "usd"))
+	}
+}
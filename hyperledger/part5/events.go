@@ -0,0 +1,43 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// chaincode event names, listeners subscribe to these instead of polling the ledger
+var stateWrittenEvent = ledger.StateWrittenEvent     //an admin wrote a value through write or jsonWrite
+var stateDeletedEvent = ledger.StateDeletedEvent     //an admin deleted something through delete
+var chaincodeResetEvent = ledger.ChaincodeResetEvent //an admin ran reset, sent once per call
+
+// ChaincodeEvent a named event and its JSON payload
+type ChaincodeEvent = ledger.ChaincodeEvent
+
+// ============================================================================================================================
+// auditRaw - raise an audit event naming the caller, the peer keeps one event per transaction so raise it last
+// ============================================================================================================================
+func (t *SimpleChaincode) auditRaw(stub ChaincodeState, name string, keys ...string) error {
+	who, err := t.caller(stub)
+	if err != nil {
+		return err
+	}
+	return ledger.Audit(stub, name, who, keys...)
+}
@@ -0,0 +1,60 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import "github.com/chaitanyaamin/marbles-chaincode/ledger"
+
+var adminRole = ledger.AdminRole //role allowed to change the chaincode's settings
+var oracleRole = "oracle"        //role allowed to publish exchange rates
+var funderRole = "funder"        //role allowed to deposit funds into accounts
+
+// Caller who submitted the transaction
+type Caller = ledger.Caller
+
+// CallerResolver works out the Caller from the stub, set SimpleChaincode.Identify to fake one
+type CallerResolver = ledger.CallerResolver
+
+// ============================================================================================================================
+// caller - resolve the identity of whoever submitted this transaction
+// ============================================================================================================================
+func (t *SimpleChaincode) caller(stub ChaincodeState) (Caller, error) {
+	return ledger.ResolveCaller(stub, t.Identify)
+}
+
+// ============================================================================================================================
+// authorize - make sure the caller may act on something belonging to user
+// ============================================================================================================================
+func (t *SimpleChaincode) authorize(stub ChaincodeState, user string, action string) error {
+	return ledger.Authorize(stub, t.Identify, user, action)
+}
+
+// ============================================================================================================================
+// requireRole - make sure the caller holds role
+// ============================================================================================================================
+func (t *SimpleChaincode) requireRole(stub ChaincodeState, role string, action string) error {
+	return t.requireRoles(stub, action, role)
+}
+
+// ============================================================================================================================
+// requireRoles - make sure the caller holds one of roles
+// ============================================================================================================================
+func (t *SimpleChaincode) requireRoles(stub ChaincodeState, action string, roles ...string) error {
+	return ledger.RequireRoles(stub, t.Identify, action, roles...)
+}
@@ -0,0 +1,191 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var drawerIndexName = "smartpay~drawer~id"     //SmartPay transactions by the payment's drawer
+var payeeIndexName = "smartpay~payee~id"       //by the payment's payee
+var borrowerIndexName = "smartpay~borrower~id" //by the loan's borrower
+var lenderIndexName = "smartpay~lender~id"     //by the loan's lender
+var currencyIndexName = "smartpay~currency~id" //by every currency any leg uses
+var createdIndexName = "smartpay~created~id"   //by creation time, time is zero padded so keys sort in order
+
+var indexValue = ledger.IndexValue //index keys carry all their data in the key
+
+// ============================================================================================================================
+// createdAttribute - zero pad a creation time (ms) so the created index sorts in time order
+// ============================================================================================================================
+func createdAttribute(createdAt int64) string {
+	return fmt.Sprintf("%020d", createdAt)
+}
+
+// ============================================================================================================================
+// smartPayIndexKeys - every index key a SmartPay transaction is listed under
+// ============================================================================================================================
+func smartPayIndexKeys(s SmartPayTransaction) ([]string, error) {
+	id := s.SmartPayTransID
+	indexes := [][]string{
+		{drawerIndexName, strings.ToLower(s.PaymentTrans.DrawerID), id},
+		{payeeIndexName, strings.ToLower(s.PaymentTrans.PayeeID), id},
+		{borrowerIndexName, strings.ToLower(s.LendTrans.BorrowerID), id},
+		{lenderIndexName, strings.ToLower(s.LendTrans.LendorID), id},
+		{createdIndexName, createdAttribute(s.CreatedAt), id},
+	}
+	seen := make(map[string]bool)
+	for _, currency := range []string{s.PaymentTrans.Amount.Currency, s.RemitTrans.Amount.Currency, s.RemitTrans.DestinationCurrency, s.LendTrans.LoanAmount.Currency} {
+		currency = strings.ToLower(currency)
+		if currency == "" || seen[currency] {
+			continue
+		}
+		seen[currency] = true
+		indexes = append(indexes, []string{currencyIndexName, currency, id})
+	}
+
+	var keys []string
+	for _, index := range indexes {
+		key, err := ledger.CreateCompositeKey(index[0], index[1:])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ============================================================================================================================
+// indexSmartPay - add a SmartPay transaction to the query indexes
+// ============================================================================================================================
+func indexSmartPay(stub ChaincodeState, s SmartPayTransaction) error {
+	keys, err := smartPayIndexKeys(s)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.PutState(key, indexValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// unindexSmartPay - remove a SmartPay transaction from the query indexes
+// ============================================================================================================================
+func unindexSmartPay(stub ChaincodeState, s SmartPayTransaction) error {
+	keys, err := smartPayIndexKeys(s)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// getSmartPayIndex - the ids listed in _smartpayindex
+// ============================================================================================================================
+func getSmartPayIndex(stub ChaincodeState) ([]string, error) {
+	_, indexAsBytes, err := ledger.GetSystemDoc(stub, smartPayIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get SmartPayTransaction index")
+	}
+	var smartPayIndex []string
+	json.Unmarshal(indexAsBytes, &smartPayIndex) //un stringify it aka JSON.parse()
+	return smartPayIndex, nil
+}
+
+// ============================================================================================================================
+// retireSmartPayIndex - shrink _smartpayindex to the ids still left in it, deleting it once none are
+// ============================================================================================================================
+// Nothing adds to _smartpayindex any more, the composite indexes took over. It is saved under its typed key and the
+// flat copy from before migrate_keyspace is dropped.
+func retireSmartPayIndex(stub ChaincodeState, smartPayIndex []string) error {
+	key, err := ledger.SystemKey(smartPayIndexStr)
+	if err != nil {
+		return err
+	}
+	if len(smartPayIndex) == 0 {
+		err = stub.DelState(key)
+	} else {
+		jsonAsBytes, _ := json.Marshal(smartPayIndex)
+		err = stub.PutState(key, jsonAsBytes)
+	}
+	if err != nil {
+		return err
+	}
+	return stub.DelState(smartPayIndexStr)
+}
+
+// ============================================================================================================================
+// Migrate SmartPay Index - add the transactions listed in _smartpayindex to the query indexes, admin only
+// ============================================================================================================================
+// The composite indexes are authoritative, so each id that gets indexed is dropped from _smartpayindex. What is left
+// are records that don't decode, validate_records lists them.
+func (t *SimpleChaincode) migrate_smartpay_index(stub ChaincodeState, args []string) ([]byte, error) {
+	_, err := requestArgs(args, &MigrateRequest{}) //or a single JSON object, see requests.go, there are no arguments
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireRole(stub, adminRole, "migrate the SmartPay index")
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- start migrate smartpay index")
+	smartPayIndex, err := getSmartPayIndex(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	var left []string
+	for _, id := range smartPayIndex {
+		smartPay, err := getSmartPay(stub, id)
+		if err != nil { //written before json.Marshal, validate_records lists these
+			fmt.Println("! skipping " + id + " - " + err.Error())
+			left = append(left, id)
+			continue
+		}
+		err = indexSmartPay(stub, smartPay)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = retireSmartPayIndex(stub, left)
+	if err != nil {
+		return nil, err
+	}
+	migrated := len(smartPayIndex) - len(left)
+	fmt.Println("- end migrate smartpay index, indexed " + strconv.Itoa(migrated))
+	return []byte(strconv.Itoa(migrated)), nil
+}
@@ -0,0 +1,116 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// Every record lives under a typed key, <namespace>~<name>, see ledger/keys.go for the layout and the system and
+// write namespaces both chaincodes share. Accounts, rates and the indexes were composite keys from the start and
+// keep theirs.
+var smartPayNamespace = "smartpay" //smartpay~<id> holds a SmartPayTransaction
+
+// KeyMigration what one migrate_keyspace call did, see ledger/keys.go
+type KeyMigration = ledger.KeyMigration
+
+// ============================================================================================================================
+// smartPayKey - the key a SmartPay transaction is stored under
+// ============================================================================================================================
+func smartPayKey(id string) (string, error) {
+	return ledger.CreateCompositeKey(smartPayNamespace, []string{id})
+}
+
+// ============================================================================================================================
+// readKey - where read finds a name, reserved names are the chaincode's documents, otherwise a transaction before a value
+// ============================================================================================================================
+func readKey(stub ChaincodeState, name string) (string, error) {
+	if strings.HasPrefix(name, ledger.ReservedPrefix) {
+		return ledger.SystemKey(name)
+	}
+	key, err := smartPayKey(name)
+	if err != nil {
+		return "", err
+	}
+	valAsBytes, err := stub.GetState(key)
+	if err != nil || valAsBytes != nil {
+		return key, err
+	}
+	return ledger.UserKey(name)
+}
+
+// ============================================================================================================================
+// flatKeyTarget - the typed key a key from before namespaces belongs under, listed holds the ids in _smartpayindex
+// ============================================================================================================================
+func flatKeyTarget(key string, value []byte, listed map[string]bool) (string, error) {
+	if strings.HasPrefix(key, ledger.ReservedPrefix) { //_smartpayindex
+		return ledger.SystemKey(key)
+	}
+	if listed[key] { //even one written before json.Marshal, validate_records still needs to find it
+		return smartPayKey(key)
+	}
+	smartPay, err := decodeSmartPay(value)
+	if err == nil && smartPay.SmartPayTransID == key {
+		return smartPayKey(key)
+	}
+	return ledger.UserKey(key) //anything else came from write or jsonWrite
+}
+
+// ============================================================================================================================
+// Migrate Keyspace - move records stored under flat keys to their typed keys, admin only, a page at a time
+// ============================================================================================================================
+func (t *SimpleChaincode) migrate_keyspace(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &PageRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireRole(stub, adminRole, "migrate the keyspace")
+	if err != nil {
+		return nil, err
+	}
+
+	//   0*       1*
+	// "100", "bookmark"
+	limit, bookmark, err := parsePaging(args)
+	if err != nil {
+		return nil, err
+	}
+	_, indexAsBytes, err := ledger.GetSystemDoc(stub, smartPayIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	var smartPayIndex []string
+	json.Unmarshal(indexAsBytes, &smartPayIndex) //un stringify it aka JSON.parse()
+	listed := map[string]bool{}
+	for _, id := range smartPayIndex {
+		listed[id] = true
+	}
+
+	report, err := ledger.MigrateKeyspace(stub, limit, bookmark, func(key string, value []byte) (string, error) {
+		return flatKeyTarget(key, value, listed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(report)
+}
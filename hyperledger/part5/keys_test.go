@@ -0,0 +1,168 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+func TestNamespaces(t *testing.T) {
+	c := seedChain(t)
+	c.mustInvoke("write", "sp1", "hello") //same name as a transaction, kept apart
+	if c.smartPay("sp1").SmartPayTransID != "sp1" {
+		t.Fatal("write clobbered sp1")
+	}
+	args := smartPayArgs()
+	args[19] = "_evil"
+	for _, call := range [][]string{
+		{"write", "_smartpayindex", "x"},
+		{"jsonWrite", "_x", "{}"},
+		{"set_note", "_x", "y"},
+		append([]string{"initSmartPay"}, args...),
+	} {
+		if _, err := c.invoke(call[0], call[1:]...); err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Errorf("%s %q = %v, want a reserved name refused", call[0], call[1], err)
+		}
+	}
+
+	if value, _ := c.query("read", "sp1"); !strings.Contains(string(value), "smartPayTransID") {
+		t.Fatalf("read sp1 = %q, the transaction comes first", value)
+	}
+	if value, _ := c.query("read", "_smartpayindex"); value != nil {
+		t.Fatalf("read _smartpayindex = %q", value)
+	}
+	c.mustInvoke("delete", "sp1")
+	if value, _ := c.query("read", "sp1"); string(value) != "hello" {
+		t.Fatalf("read sp1 = %q after the transaction went", value)
+	}
+}
+
+func TestMigrateKeyspace(t *testing.T) {
+	tests := []struct {
+		name string
+		page func(bookmark string) []string
+	}{
+		{"positional", func(bookmark string) []string { return []string{"2", bookmark} }},
+		{"json", func(bookmark string) []string { return []string{`{"limit":2,"bookmark":"` + bookmark + `"}`} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChain(t)
+			c.st.State[smartPayIndexStr] = []byte(`["sp9","bad"]`)
+			c.st.State["sp9"] = []byte(`{"smartPayTransID":"sp9"}`)
+			c.st.State["bad"] = []byte(`not json`)
+			c.st.State["abc"] = []byte(`1`)
+			key, _ := ledger.UserKey("abc")
+			c.st.State[key] = []byte(`2`)
+
+			var report KeyMigration
+			json.Unmarshal(c.mustInvoke("migrate_keyspace", tt.page("")...), &report)
+			if report.Moved != 1 || !reflect.DeepEqual(report.Conflicts, []string{"abc"}) || report.Bookmark == "" {
+				t.Fatalf("first page = %v, want one moved and abc left alone", report)
+			}
+			bookmark := report.Bookmark
+			report = KeyMigration{}
+			json.Unmarshal(c.mustInvoke("migrate_keyspace", tt.page(bookmark)...), &report)
+			if report.Moved != 2 || report.Bookmark != "" {
+				t.Fatalf("last page = %v, want two more moved", report)
+			}
+			for _, id := range []string{"sp9", "bad"} {
+				if key, _ := smartPayKey(id); c.st.State[key] == nil || c.st.State[id] != nil {
+					t.Errorf("%s was not moved", id)
+				}
+			}
+			if value, _ := c.query("read", "abc"); string(value) != "2" {
+				t.Fatalf("abc = %q, a conflict must not be overwritten", value)
+			}
+
+			var records RecordReport
+			c.mustQuery(&records, "validate_records")
+			if records.Checked != 2 || len(records.Problems) != 2 {
+				t.Fatalf("records = %v, neither moved transaction is whole", records)
+			}
+		})
+	}
+}
+
+func TestValidateRecords(t *testing.T) {
+	c := seedChain(t)
+	args := smartPayArgs()
+	args[0], args[19] = `p"1`, "sp2"
+	c.mustInvoke("initSmartPay", args...)
+	if c.smartPay("sp2").PaymentTrans.PaymentTransID != `p"1` {
+		t.Fatal(`p"1 was not stored as valid JSON`)
+	}
+	key, _ := smartPayKey("sp1")
+	c.st.State[key] = []byte(`{"smartPayTransID":"sp1","paymentTrans":"{bad"}`)
+	var report RecordReport
+	c.mustQuery(&report, "validate_records")
+	if report.Checked != 2 || len(report.Problems) != 1 || report.Problems[0].Key != "sp1" {
+		t.Fatalf("report = %v, want only sp1", report)
+	}
+	if _, err := c.query("get_smartpay", "sp1"); err == nil {
+		t.Fatal("get_smartpay handed out the malformed sp1")
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := seedChain(t)
+	c.as(bob).mustInvoke("set_note", "todo", "milk")
+	c.st.Events = nil
+	if _, err := c.as(admin).invoke("reset"); err == nil {
+		t.Fatal("reset ran without being confirmed")
+	}
+
+	var report ResetReport
+	for calls := 0; calls == 0 || report.More; calls++ {
+		report = ResetReport{}
+		json.Unmarshal(c.mustInvoke("reset", `{"confirm":"RESET","limit":2}`), &report)
+		if report.Deleted > 2 {
+			t.Fatalf("reset deleted %d keys, the limit is 2", report.Deleted)
+		}
+	}
+	for key := range c.st.State {
+		t.Errorf("reset left %q behind", key)
+	}
+	last := c.st.Events[len(c.st.Events)-1]
+	if last.Name != chaincodeResetEvent || !strings.Contains(string(last.Payload), `"by":"admin"`) {
+		t.Fatalf("last event = %s %s", last.Name, last.Payload)
+	}
+
+	c.mustInvoke("init", "1")
+	if _, err := c.as(alice).invoke("initSmartPay", smartPayArgs()...); err == nil {
+		t.Fatal("initSmartPay found a rate after reset")
+	}
+}
+
+func TestInitLeavesLegacyIndexRetired(t *testing.T) {
+	c := seedChain(t)
+	c.mustInvoke("init", "7")
+	if value, _ := c.query("read", smartPayIndexStr); value != nil {
+		t.Fatalf("%s = %q after init", smartPayIndexStr, value)
+	}
+	if value, _ := c.query("read", "abc"); string(value) != "100" {
+		t.Fatalf("abc = %q, init must not overwrite it", value)
+	}
+}
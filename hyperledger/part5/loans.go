@@ -0,0 +1,525 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// loan statuses, a loan that was never disbursed has none
+var loanDisbursed = "disbursed"
+var loanRepaid = "repaid"
+var loanOverdue = "overdue"
+
+// interest methods
+var simpleInterest = "simple"     //interest only on the principal
+var compoundInterest = "compound" //interest compounds daily on principal plus unpaid interest
+
+var compoundPrecision uint = 256 //bits kept while compounding, far more than any currency's minor unit needs
+
+// day count conventions, they decide how many days a period has and how many days make a year
+var dayCountActual365 = "act/365"
+var dayCountActual360 = "act/360"
+var dayCount30360 = "30/360" //every month has 30 days, US bond basis
+
+var dayCountBasis = map[string]int64{dayCountActual365: 365, dayCountActual360: 360, dayCount30360: 360} //days in a year
+
+// Repayment one payment made against a loan
+type Repayment struct {
+	Amount    Money  `json:"amount"`
+	Interest  Money  `json:"interest"`  //part of Amount that settled accrued interest
+	Principal Money  `json:"principal"` //part of Amount that reduced the principal
+	PaidAt    int64  `json:"paidAt"`    //utc ms, from the transaction
+	TxID      string `json:"txID"`
+}
+
+// LoanBalance what is owed on a loan as of a point in time
+type LoanBalance struct {
+	SmartPayTransID string `json:"smartPayTransID"`
+	Status          string `json:"status"`
+	Principal       Money  `json:"principal"`
+	Interest        Money  `json:"interest"` //accrued and unpaid, including what accrued since the last transaction
+	Outstanding     Money  `json:"outstanding"`
+	AsOf            int64  `json:"asOf"`  //utc ms
+	DueAt           int64  `json:"dueAt"` //utc ms
+	Overdue         bool   `json:"overdue"`
+}
+
+// ============================================================================================================================
+// dayCount - days between two times under a convention, and the number of days in its year
+// ============================================================================================================================
+func dayCount(convention string, from time.Time, to time.Time) (int64, int64, error) {
+	basis, ok := dayCountBasis[convention]
+	if !ok {
+		return 0, 0, errors.New("unknown day count convention " + convention)
+	}
+	from, to = from.UTC(), to.UTC()
+	if !to.After(from) {
+		return 0, basis, nil
+	}
+	if convention == dayCount30360 {
+		d1, d2 := from.Day(), to.Day()
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 && d1 == 30 {
+			d2 = 30
+		}
+		return int64(360*(to.Year()-from.Year()) + 30*(int(to.Month())-int(from.Month())) + (d2 - d1)), basis, nil
+	}
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return (end.Unix() - start.Unix()) / (24 * 60 * 60), basis, nil //calendar days crossed, so accruing often loses nothing
+}
+
+// ============================================================================================================================
+// period - when the loan's current interest period began and the interest booked since, loans stored before
+// periods existed start theirs at their last accrual
+// ============================================================================================================================
+func period(loan LendingTransacation) (time.Time, Money) {
+	start := loan.PeriodStart
+	if start == 0 {
+		start = loan.AccruedAt
+	}
+	booked := Money{Currency: loan.LoanAmount.Currency}
+	if loan.PeriodInterest != nil {
+		booked = *loan.PeriodInterest
+	}
+	return time.Unix(0, start*int64(time.Millisecond)), booked
+}
+
+// ============================================================================================================================
+// periodInterest - interest on base for days, unrounded, as a fraction num/den of the currency's minor unit
+// ============================================================================================================================
+func periodInterest(method string, base int64, rate Rate, days int64, basis int64) (*big.Int, *big.Int) {
+	//LoanRate is percent per year, so one day's interest on units is units * rate / (100 * 10^rateDigits * basis)
+	den := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(rateDigits)), nil)
+	den.Mul(den, big.NewInt(100*basis))
+
+	if method != compoundInterest {
+		num := new(big.Int).Mul(big.NewInt(base), big.NewInt(int64(rate)))
+		return num.Mul(num, big.NewInt(days)), den
+	}
+	//base * ((den + rate) / den)^days - base, in closed form so a far off date costs no more than a near one.
+	//big.Float is exact integer arithmetic underneath, every peer gets the same bits
+	daily := new(big.Float).SetPrec(compoundPrecision).SetInt(new(big.Int).Add(den, big.NewInt(int64(rate))))
+	daily.Quo(daily, new(big.Float).SetPrec(compoundPrecision).SetInt(den))
+	growth := new(big.Float).SetPrec(compoundPrecision).SetInt64(1)
+	for n := days; n > 0; n >>= 1 { //square and multiply
+		if n&1 == 1 {
+			growth.Mul(growth, daily)
+		}
+		daily.Mul(daily, daily)
+	}
+	growth.Sub(growth, big.NewFloat(1))
+	growth.Mul(growth, new(big.Float).SetPrec(compoundPrecision).SetInt64(base))
+	interest, _ := growth.Rat(nil)
+	return interest.Num(), interest.Denom()
+}
+
+// ============================================================================================================================
+// accrue - interest on a loan between its last accrual and asOf. The whole period since the last repayment is rounded
+// once, half even to the currency's minor unit, and what was already booked is taken off, so the total doesn't
+// depend on how often interest is accrued
+// ============================================================================================================================
+func accrue(loan LendingTransacation, asOf time.Time) (Money, error) {
+	interest := Money{Currency: loan.LoanAmount.Currency}
+	if loan.Principal == nil || loan.Interest == nil {
+		return interest, conflict("loan " + loan.LendingTransID + " was never disbursed")
+	}
+	if ledger.UnixMillis(asOf) <= loan.AccruedAt {
+		return interest, nil
+	}
+	start, booked := period(loan)
+	days, basis, err := dayCount(loan.DayCount, start, asOf)
+	if err != nil || days == 0 {
+		return interest, err
+	}
+	base := loan.Principal.Units
+	if loan.InterestMethod == compoundInterest {
+		base += loan.Interest.Units - booked.Units //interest left unpaid when the period began compounds too
+	}
+	num, den := periodInterest(loan.InterestMethod, base, loan.LoanRate, days, basis)
+	total, err := roundQuotient(num, den, RoundHalfEven)
+	if err != nil {
+		return interest, err
+	}
+	if total > booked.Units {
+		interest.Units = total - booked.Units
+	}
+	return interest, nil
+}
+
+// ============================================================================================================================
+// accrueTo - add the interest accrued up to asOf to the loan and move its accrual point there
+// ============================================================================================================================
+func accrueTo(loan *LendingTransacation, asOf time.Time) error {
+	interest, err := accrue(*loan, asOf)
+	if err != nil {
+		return err
+	}
+	total, err := loan.Interest.Add(interest)
+	if err != nil {
+		return err
+	}
+	start, booked := period(*loan)
+	booked, err = booked.Add(interest)
+	if err != nil {
+		return err
+	}
+	loan.Interest = &total
+	loan.PeriodStart = ledger.UnixMillis(start)
+	loan.PeriodInterest = &booked
+	if millis := ledger.UnixMillis(asOf); millis > loan.AccruedAt {
+		loan.AccruedAt = millis
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// startPeriod - begin a new interest period at millis, the balance interest runs on has just changed
+// ============================================================================================================================
+func startPeriod(loan *LendingTransacation, millis int64) {
+	booked := Money{Currency: loan.LoanAmount.Currency}
+	loan.PeriodStart = millis
+	loan.PeriodInterest = &booked
+}
+
+// ============================================================================================================================
+// getLoan - read the SmartPay transaction that holds a running loan
+// ============================================================================================================================
+func getLoan(stub ChaincodeState, id string) (SmartPayTransaction, error) {
+	smartPay, err := getSmartPay(stub, strings.ToLower(id))
+	if err != nil {
+		return smartPay, err
+	}
+	if smartPay.LendTrans.Status == "" {
+		return smartPay, conflict("loan " + smartPay.LendTrans.LendingTransID + " has not been disbursed")
+	}
+	return smartPay, nil
+}
+
+// ============================================================================================================================
+// Disburse Loan - pay a SmartPay loan out from the lender's account to the borrower's and start accruing interest
+// ============================================================================================================================
+func (t *SimpleChaincode) disburse_loan(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &DisburseLoanRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0        1*          2*
+	// "sp1", "compound", "act/360"
+	if len(args) < 1 || len(args) > 3 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the SmartPay transaction id, then optionally the interest method and day count")
+	}
+	method := simpleInterest
+	if len(args) > 1 && len(args[1]) > 0 {
+		method = strings.ToLower(args[1])
+	}
+	if method != simpleInterest && method != compoundInterest {
+		return nil, argError("2nd argument must be " + simpleInterest + " or " + compoundInterest)
+	}
+	convention := dayCountActual365
+	if len(args) > 2 && len(args[2]) > 0 {
+		convention = strings.ToLower(args[2])
+	}
+	if _, ok := dayCountBasis[convention]; !ok {
+		return nil, argError("3rd argument must be " + dayCountActual365 + ", " + dayCountActual360 + " or " + dayCount30360)
+	}
+
+	smartPay, err := getSmartPay(stub, strings.ToLower(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	loan := smartPay.LendTrans
+	err = t.authorize(stub, loan.LendorID, "disburse a loan") //the lender's funds pay it out
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != "" {
+		return nil, conflict("loan " + loan.LendingTransID + " was already disbursed")
+	}
+	txTime, now, err := ledger.TxMillis(stub)
+	if err != nil {
+		return nil, err
+	}
+	due, err := parseDate(strings.ToUpper(loan.LoanReturnDate), true)
+	if err != nil {
+		return nil, errors.New("loan " + loan.LendingTransID + " has no usable return date " + loan.LoanReturnDate)
+	}
+	if !due.After(txTime) {
+		return nil, errors.New("loan " + loan.LendingTransID + " was due before it was disbursed")
+	}
+
+	fmt.Println("- start disburse loan " + loan.LendingTransID)
+	batch := ledger.NewBatch(stub) //the loan only starts if the lender can fund it
+	err = moveFunds(batch, loan.LendorID, loan.BorrowerID, loan.LoanAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := loan.LoanAmount
+	interest := Money{Currency: principal.Currency}
+	loan.InterestMethod = method
+	loan.DayCount = convention
+	loan.Status = loanDisbursed
+	loan.DisbursedAt = now
+	loan.DueAt = ledger.UnixMillis(due)
+	loan.AccruedAt = now
+	loan.Principal = &principal
+	loan.Interest = &interest
+	startPeriod(&loan, now)
+	smartPay.LendTrans = loan
+	err = putSmartPay(batch, smartPay)
+	if err != nil {
+		return nil, err
+	}
+	err = batch.Commit()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end disburse loan")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Repay Loan - pay towards a loan from the borrower's account, accrued interest is settled before principal
+// ============================================================================================================================
+func (t *SimpleChaincode) repay_loan(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &RepayLoanRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0      1
+	// "sp1", "250.00"
+	if len(args) != 2 {
+		return nil, argError("Incorrect number of arguments. Expecting 2")
+	}
+	smartPay, err := getLoan(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	loan := smartPay.LendTrans
+	err = t.authorize(stub, loan.BorrowerID, "repay a loan") //the borrower's funds pay it back
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status == loanRepaid {
+		return nil, conflict("loan " + loan.LendingTransID + " is already repaid")
+	}
+	amount, err := ParseMoney(args[1], loan.LoanAmount.Currency) //always in the loan's currency
+	if err != nil {
+		return nil, argError("2nd argument must be an amount - " + err.Error())
+	}
+	if amount.Units <= 0 {
+		return nil, argError("2nd argument must be a positive amount")
+	}
+	txTime, now, err := ledger.TxMillis(stub)
+	if err != nil {
+		return nil, err
+	}
+	err = accrueTo(&loan, txTime)
+	if err != nil {
+		return nil, err
+	}
+
+	owed := loan.Principal.Units + loan.Interest.Units
+	if amount.Units > owed {
+		return nil, argError("repayment of " + amount.String() + " is more than the " + Money{Units: owed, Currency: amount.Currency}.String() + " owed")
+	}
+	repayment := Repayment{Amount: amount, Interest: amount, Principal: Money{Currency: amount.Currency}, PaidAt: now, TxID: stub.GetTxID()}
+	if amount.Units > loan.Interest.Units {
+		repayment.Interest.Units = loan.Interest.Units
+		repayment.Principal.Units = amount.Units - loan.Interest.Units
+	}
+	interest, _ := loan.Interest.Sub(repayment.Interest)
+	principal, _ := loan.Principal.Sub(repayment.Principal)
+	loan.Interest = &interest
+	loan.Principal = &principal
+	loan.Repayments = append(loan.Repayments, repayment)
+	startPeriod(&loan, now) //what is owed changed, interest from here on is a new period
+	if interest.Units == 0 && principal.Units == 0 {
+		loan.Status = loanRepaid
+	}
+
+	fmt.Println("- start repay loan " + loan.LendingTransID + " " + amount.String())
+	batch := ledger.NewBatch(stub)
+	err = moveFunds(batch, loan.BorrowerID, loan.LendorID, amount)
+	if err != nil {
+		return nil, err
+	}
+	smartPay.LendTrans = loan
+	err = putSmartPay(batch, smartPay)
+	if err != nil {
+		return nil, err
+	}
+	err = batch.Commit()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end repay loan, status " + loan.Status)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Accrue Interest - book the interest a loan has accrued up to this transaction
+// ============================================================================================================================
+func (t *SimpleChaincode) accrue_interest(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &LoanRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "sp1"
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting the SmartPay transaction id")
+	}
+	err = t.requireRoles(stub, "accrue interest", adminRole, oracleRole) //housekeeping run by the operator or a scheduler
+	if err != nil {
+		return nil, err
+	}
+	smartPay, err := getLoan(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if smartPay.LendTrans.Status == loanRepaid {
+		return nil, conflict("loan " + smartPay.LendTrans.LendingTransID + " is already repaid")
+	}
+	txTime, _, err := ledger.TxMillis(stub)
+	if err != nil {
+		return nil, err
+	}
+	err = accrueTo(&smartPay.LendTrans, txTime)
+	if err != nil {
+		return nil, err
+	}
+	err = putSmartPay(stub, smartPay)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Mark Overdue - flag a loan that is past its return date and still owes money
+// ============================================================================================================================
+func (t *SimpleChaincode) mark_overdue(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &LoanRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "sp1"
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting the SmartPay transaction id")
+	}
+	err = t.requireRoles(stub, "mark a loan overdue", adminRole, oracleRole) //housekeeping run by the operator or a scheduler
+	if err != nil {
+		return nil, err
+	}
+	smartPay, err := getLoan(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	loan := smartPay.LendTrans
+	if loan.Status != loanDisbursed {
+		return nil, conflict("loan " + loan.LendingTransID + " is already " + loan.Status)
+	}
+	txTime, now, err := ledger.TxMillis(stub)
+	if err != nil {
+		return nil, err
+	}
+	if now <= loan.DueAt {
+		return nil, conflict("loan " + loan.LendingTransID + " is not due yet")
+	}
+	err = accrueTo(&loan, txTime)
+	if err != nil {
+		return nil, err
+	}
+	loan.Status = loanOverdue
+	smartPay.LendTrans = loan
+	err = putSmartPay(stub, smartPay)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Loan Balance - what is owed on a loan as of a date, or as of this transaction when no date is given
+// ============================================================================================================================
+func (t *SimpleChaincode) loan_balance(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0         1*
+	// "sp1", "2016-12-31"
+	if len(args) < 1 || len(args) > 2 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the SmartPay transaction id and optionally a date")
+	}
+	smartPay, err := getLoan(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	var asOf time.Time
+	if len(args) == 2 {
+		asOf, err = parseDate(args[1], true)
+		if err != nil {
+			return nil, argError("2nd argument must be a date, 2006-01-02 or RFC 3339")
+		}
+	} else {
+		asOf, _, err = ledger.TxMillis(stub)
+		if err != nil {
+			return nil, argError("No transaction timestamp, pass the date to compute the balance at")
+		}
+	}
+
+	loan := smartPay.LendTrans
+	if loan.Status != loanRepaid {
+		err = accrueTo(&loan, asOf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	outstanding, err := loan.Principal.Add(*loan.Interest)
+	if err != nil {
+		return nil, err
+	}
+	balance := LoanBalance{
+		SmartPayTransID: smartPay.SmartPayTransID,
+		Status:          loan.Status,
+		Principal:       *loan.Principal,
+		Interest:        *loan.Interest,
+		Outstanding:     outstanding,
+		AsOf:            ledger.UnixMillis(asOf),
+		DueAt:           loan.DueAt,
+		Overdue:         outstanding.Units > 0 && ledger.UnixMillis(asOf) > loan.DueAt,
+	}
+	return json.Marshal(balance)
+}
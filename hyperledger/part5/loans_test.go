@@ -0,0 +1,174 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// loan - what is owed on sp1, as of this transaction when no date is given
+func (c *testChain) loan(date ...string) LoanBalance {
+	c.t.Helper()
+	var loan LoanBalance
+	c.mustQuery(&loan, "loan_balance", append([]string{"sp1"}, date...)...)
+	return loan
+}
+
+func TestLoanLifecycle(t *testing.T) {
+	c := seedChain(t)
+	c.at(time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC))
+	disbursed(c)
+	if _, err := c.as(bank).invoke("disburse_loan", "sp1"); err == nil {
+		t.Fatal("the same loan was disbursed twice")
+	}
+	if loan := c.loan("2016-03-14"); loan.Interest.String() != "10.00 USD" || loan.Outstanding.String() != "1010.00 USD" {
+		t.Fatalf("balance on 2016-03-14 = %v, want 73 days at 5%% on 1000, 10.00", loan)
+	}
+
+	c.at(time.Date(2016, 3, 14, 9, 0, 0, 0, time.UTC))
+	c.as(bob).mustInvoke("repay_loan", "sp1", "110") //interest first, then principal
+	if loan := c.loan(); loan.Principal.String() != "900.00 USD" || loan.Interest.Units != 0 || loan.Status != loanDisbursed {
+		t.Fatalf("balance after repaying 110 = %v", loan)
+	}
+	if c.balance("bank", "usd") != "4110.00 USD" {
+		t.Fatalf("bank has %s, want its 110 back", c.balance("bank", "usd"))
+	}
+
+	c.at(time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC))
+	c.as(oracle).mustInvoke("mark_overdue", "sp1")
+	loan := c.loan()
+	if loan.Status != loanOverdue || !loan.Overdue {
+		t.Fatalf("balance after the due date = %v, want it overdue", loan)
+	}
+	if _, err := c.as(oracle).invoke("mark_overdue", "sp1"); err == nil {
+		t.Fatal("an overdue loan was marked overdue again")
+	}
+
+	c.fund("bob", "500", "usd")
+	c.as(bob).mustInvoke("repay_loan", `{"smartPayTransID":"sp1","amount":`+loan.Outstanding.String()[:len(loan.Outstanding.String())-4]+`}`)
+	if loan := c.loan(); loan.Status != loanRepaid || loan.Outstanding.Units != 0 {
+		t.Fatalf("balance after repaying everything = %v", loan)
+	}
+	if _, err := c.as(oracle).invoke("accrue_interest", "sp1"); err == nil {
+		t.Fatal("interest accrued on a repaid loan")
+	}
+}
+
+func TestLoanInterest(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string //disburse_loan arguments after the id
+		want string   //interest on 1000 USD at 5% by 2016-12-31
+	}{
+		{"simple act/365", nil, "50.00 USD"},
+		{"simple act/360", []string{"simple", "act/360"}, "50.69 USD"},
+		{"compound 30/360", []string{"compound", "30/360"}, "51.27 USD"}, //1000 * ((1 + 0.05/360)^360 - 1)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			c.fund("bank", "5000", "usd")
+			c.as(bank).mustInvoke("disburse_loan", append([]string{"sp1"}, tt.args...)...)
+			if loan := c.loan("2016-12-31"); loan.Interest.String() != tt.want {
+				t.Fatalf("interest = %s, want %s", loan.Interest, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccrueInterestBooksToNow(t *testing.T) {
+	c := seedChain(t)
+	disbursed(c)
+	c.at(time.Date(2016, 3, 14, 12, 0, 0, 0, time.UTC))
+	c.as(oracle).mustInvoke("accrue_interest", `{"smartPayTransID":"sp1"}`)
+	loan := c.smartPay("sp1").LendTrans
+	if loan.Interest == nil || loan.Interest.String() != "10.00 USD" {
+		t.Fatalf("booked interest = %v, want 10.00 USD", loan.Interest)
+	}
+	if balance := c.loan("2016-03-14"); balance.Interest.String() != "10.00 USD" {
+		t.Fatalf("balance = %v, booked interest must not be counted twice", balance)
+	}
+}
+
+func TestAccrualFrequencyDoesNotChangeInterest(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string //disburse_loan arguments after the id
+	}{
+		{"simple act/360", []string{"simple", "act/360"}},
+		{"compound act/365", []string{"compound", "act/365"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once := seedChain(t)
+			daily := seedChain(t)
+			for _, c := range []*testChain{once, daily} {
+				c.fund("bank", "5000", "usd")
+				c.as(bank).mustInvoke("disburse_loan", append([]string{"sp1"}, tt.args...)...)
+			}
+			for day := time.Date(2016, 1, 2, 12, 0, 0, 0, time.UTC); day.Year() == 2016; day = day.AddDate(0, 0, 1) {
+				daily.at(day)
+				daily.as(oracle).mustInvoke("accrue_interest", "sp1")
+			}
+			if a, b := once.loan("2016-12-31").Interest, daily.loan("2016-12-31").Interest; a != b {
+				t.Fatalf("interest accrued once = %s, accrued daily = %s", a, b)
+			}
+		})
+	}
+}
+
+func TestLoanBalanceFarAhead(t *testing.T) {
+	c := seedChain(t)
+	c.fund("bank", "5000", "usd")
+	c.as(bank).mustInvoke("disburse_loan", "sp1", "compound")
+	var loan LoanBalance
+	c.mustQuery(&loan, "loan_balance", "sp1", "2115-12-31") //compounding is closed form, a century is no slower than a day
+	if loan.Interest.String() != "147830.49 USD" {
+		t.Fatalf("interest by 2115-12-31 = %s, want 147830.49 USD", loan.Interest)
+	}
+	if _, err := c.query("loan_balance", "sp1", "9999-12-31"); err == nil || !strings.Contains(err.Error(), "overflows") {
+		t.Fatalf("loan_balance for 9999-12-31 = %v, want an overflow", err)
+	}
+}
+
+func TestDayCount(t *testing.T) {
+	tests := []struct {
+		convention string
+		from, to   time.Time
+		days, year int64
+	}{
+		{"act/365", time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2016, 3, 14, 0, 0, 0, 0, time.UTC), 73, 365},
+		{"act/360", time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2016, 3, 14, 0, 0, 0, 0, time.UTC), 73, 360},
+		{"30/360", time.Date(2016, 1, 31, 0, 0, 0, 0, time.UTC), time.Date(2016, 3, 31, 0, 0, 0, 0, time.UTC), 60, 360},
+		{"30/360", time.Date(2016, 2, 15, 0, 0, 0, 0, time.UTC), time.Date(2017, 2, 15, 0, 0, 0, 0, time.UTC), 360, 360},
+		{"act/365", time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), 2916095, 365}, //longer than a time.Duration
+	}
+	for _, tt := range tests {
+		days, year, err := dayCount(tt.convention, tt.from, tt.to)
+		if err != nil || days != tt.days || year != tt.year {
+			t.Errorf("dayCount(%s, %s, %s) = %d/%d, %v, want %d/%d", tt.convention, tt.from.Format("2006-01-02"), tt.to.Format("2006-01-02"), days, year, err, tt.days, tt.year)
+		}
+	}
+	if _, _, err := dayCount("act/366", time.Now(), time.Now()); err == nil {
+		t.Error("dayCount accepted act/366")
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money an exact amount of one currency, counted in that currency's minor units (cents for USD, yen for JPY).
+// Amounts are never held as floats so every peer computes the same balances.
+type Money struct {
+	Units    int64  `json:"units"`    //minor units, 1050 is 10.50 USD
+	Currency string `json:"currency"` //ISO 4217 code, upper case
+}
+
+// Rate an exact decimal such as an exchange rate or an interest rate, with rateDigits digits after the point.
+// It is written to JSON as a decimal string so it survives clients that parse numbers as floats.
+type Rate int64
+
+// RoundingMode how a computed amount that falls between two minor units is settled
+type RoundingMode int
+
+const (
+	RoundHalfEven RoundingMode = iota //to the nearest unit, ties to the even one, used for anything the chaincode derives
+	RoundHalfUp                       //to the nearest unit, ties away from zero
+	RoundDown                         //towards zero
+)
+
+var rateDigits = 8 //a rate carries at most this many decimal places
+
+// currencyExponents minor unit digits per supported ISO 4217 currency
+var currencyExponents = map[string]int{
+	"AUD": 2, "BHD": 3, "CAD": 2, "CHF": 2, "CLP": 0, "CNY": 2, "EUR": 2, "GBP": 2, "HKD": 2, "INR": 2,
+	"ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "MXN": 2, "NZD": 2, "OMR": 3, "SGD": 2, "USD": 2,
+}
+
+// ============================================================================================================================
+// normalizeCurrency - upper case a currency code and check we know its exponent
+// ============================================================================================================================
+func normalizeCurrency(currency string) (string, int, error) {
+	code := strings.ToUpper(strings.TrimSpace(currency))
+	exponent, ok := currencyExponents[code]
+	if !ok {
+		return "", 0, errors.New("unsupported currency " + strconv.Quote(currency))
+	}
+	return code, exponent, nil
+}
+
+// ============================================================================================================================
+// parseDecimal - read a plain decimal string as an integer scaled by 10^digits, more digits than that is an error
+// ============================================================================================================================
+func parseDecimal(value string, digits int) (int64, error) {
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	if negative || strings.HasPrefix(value, "+") {
+		value = value[1:]
+	}
+	whole, fraction := value, ""
+	if dot := strings.Index(value, "."); dot >= 0 {
+		whole, fraction = value[:dot], value[dot+1:]
+	}
+	if whole == "" && fraction == "" {
+		return 0, errors.New("not a decimal number")
+	}
+	if len(fraction) > digits {
+		return 0, errors.New("more than " + strconv.Itoa(digits) + " decimal places")
+	}
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return 0, errors.New("not a decimal number")
+		}
+	}
+	scaled := strings.TrimLeft(whole+fraction+strings.Repeat("0", digits-len(fraction)), "0")
+	if scaled == "" {
+		return 0, nil
+	}
+	result, err := strconv.ParseInt(scaled, 10, 64)
+	if err != nil {
+		return 0, errors.New("too large")
+	}
+	if negative {
+		result = -result
+	}
+	return result, nil
+}
+
+// ============================================================================================================================
+// formatDecimal - write an integer scaled by 10^digits as a plain decimal string
+// ============================================================================================================================
+func formatDecimal(value int64, digits int) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	s := strconv.FormatInt(value, 10)
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// ============================================================================================================================
+// ParseMoney - read a decimal string such as "10.50" in a currency, it must not be more precise than the currency
+// ============================================================================================================================
+func ParseMoney(value string, currency string) (Money, error) {
+	code, exponent, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	units, err := parseDecimal(value, exponent)
+	if err != nil {
+		return Money{}, errors.New("amount " + strconv.Quote(value) + " is not a valid " + code + " amount: " + err.Error())
+	}
+	return Money{Units: units, Currency: code}, nil
+}
+
+// ============================================================================================================================
+// String - the amount as a decimal followed by its currency, e.g. "10.50 USD"
+// ============================================================================================================================
+func (m Money) String() string {
+	return formatDecimal(m.Units, currencyExponents[m.Currency]) + " " + m.Currency
+}
+
+// ============================================================================================================================
+// Add - sum two amounts of the same currency
+// ============================================================================================================================
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return m, errors.New("cannot add " + other.Currency + " to " + m.Currency)
+	}
+	sum := m.Units + other.Units
+	if (other.Units > 0 && sum < m.Units) || (other.Units < 0 && sum > m.Units) {
+		return m, errors.New("amount overflows")
+	}
+	return Money{Units: sum, Currency: m.Currency}, nil
+}
+
+// ============================================================================================================================
+// Sub - take an amount of the same currency away
+// ============================================================================================================================
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(Money{Units: -other.Units, Currency: other.Currency})
+}
+
+// ============================================================================================================================
+// Convert - multiply by a rate into another currency, e.g. USD to INR at the exchange rate, rounded with mode
+// ============================================================================================================================
+func (m Money) Convert(rate Rate, currency string, mode RoundingMode) (Money, error) {
+	code, exponent, err := normalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	//units * rate * 10^exponent / (10^rateDigits * 10^fromExponent)
+	num := new(big.Int).Mul(big.NewInt(m.Units), big.NewInt(int64(rate)))
+	num.Mul(num, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil))
+	den := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(rateDigits+currencyExponents[m.Currency])), nil)
+	units, err := roundQuotient(num, den, mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Units: units, Currency: code}, nil
+}
+
+// ============================================================================================================================
+// roundQuotient - divide num by a positive den and round the result to an integer with mode
+// ============================================================================================================================
+func roundQuotient(num *big.Int, den *big.Int, mode RoundingMode) (int64, error) {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int)) //q truncated towards zero, r has num's sign
+	if r.Sign() != 0 && mode != RoundDown {
+		twice := new(big.Int).Abs(r)
+		twice.Mul(twice, big.NewInt(2))
+		cmp := twice.Cmp(den)
+		if cmp > 0 || (cmp == 0 && (mode == RoundHalfUp || q.Bit(0) == 1)) {
+			q.Add(q, big.NewInt(int64(num.Sign())))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, errors.New("amount overflows")
+	}
+	return q.Int64(), nil
+}
+
+// ============================================================================================================================
+// ParseRate - read a decimal string such as "65.2" as a Rate
+// ============================================================================================================================
+func ParseRate(value string) (Rate, error) {
+	scaled, err := parseDecimal(value, rateDigits)
+	if err != nil {
+		return 0, errors.New("rate " + strconv.Quote(value) + " is not valid: " + err.Error())
+	}
+	return Rate(scaled), nil
+}
+
+// ============================================================================================================================
+// String - the rate as a plain decimal string
+// ============================================================================================================================
+func (r Rate) String() string {
+	return strings.TrimRight(strings.TrimRight(formatDecimal(int64(r), rateDigits), "0"), ".")
+}
+
+// ============================================================================================================================
+// MarshalJSON - write the rate as a decimal string
+// ============================================================================================================================
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// ============================================================================================================================
+// UnmarshalJSON - read a rate from a decimal string or a plain JSON number
+// ============================================================================================================================
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	rate, err := ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value, currency string
+		want            string //empty when it must be refused
+	}{
+		{"10.5", "usd", "10.50 USD"},
+		{"0.01", "USD", "0.01 USD"},
+		{".5", "eur", "0.50 EUR"},
+		{"0", "usd", "0.00 USD"},
+		{"1000", "jpy", "1000 JPY"},
+		{"1.234", "kwd", "1.234 KWD"},
+		{"10.505", "usd", ""},
+		{"1.5", "jpy", ""},
+		{"abc", "usd", ""},
+		{"", "usd", ""},
+		{"1e3", "usd", ""},
+		{"99999999999999999999", "usd", ""},
+		{"1", "xyz", ""},
+	}
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.value, tt.currency)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseMoney(%q, %q) = %s, want an error", tt.value, tt.currency, m)
+			}
+			continue
+		}
+		if err != nil || m.String() != tt.want {
+			t.Errorf("ParseMoney(%q, %q) = %s, %v, want %s", tt.value, tt.currency, m, err, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value, from, rate, to string
+		mode                  RoundingMode
+		want                  string
+	}{
+		{"100", "usd", "65.2", "inr", RoundHalfEven, "6520.00 INR"},
+		{"0.05", "usd", "0.5", "usd", RoundHalfEven, "0.02 USD"},
+		{"0.05", "usd", "0.5", "usd", RoundHalfUp, "0.03 USD"},
+		{"0.05", "usd", "0.5", "usd", RoundDown, "0.02 USD"},
+		{"0.07", "usd", "0.5", "usd", RoundHalfEven, "0.04 USD"},
+		{"1", "jpy", "0.0067", "usd", RoundHalfEven, "0.01 USD"},
+	}
+	for _, tt := range tests {
+		m, _ := ParseMoney(tt.value, tt.from)
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := m.Convert(rate, tt.to, tt.mode)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%s at %s to %s = %s, %v, want %s", m, tt.rate, tt.to, got, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	usd, _ := ParseMoney("10", "usd")
+	inr, _ := ParseMoney("10", "inr")
+	if _, err := usd.Add(inr); err == nil {
+		t.Error("added USD to INR")
+	}
+	if _, err := usd.Sub(inr); err == nil {
+		t.Error("took INR from USD")
+	}
+	cents, _ := ParseMoney("0.01", "usd")
+	if sum, err := usd.Add(cents); err != nil || sum.String() != "10.01 USD" {
+		t.Errorf("10.00 + 0.01 = %s, %v", sum, err)
+	}
+	if rate, _ := ParseRate("65.20"); rate.String() != "65.2" {
+		t.Errorf("rate 65.20 prints as %s", rate)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestNotes(t *testing.T) {
+	c := newTestChain(t)
+	c.as(bob).mustInvoke("set_note", "todo", "milk")
+	c.as(bob).mustInvoke("set_note", `{"name":"todo","value":"eggs"}`)
+	c.as(alice).mustInvoke("set_note", "mine", "a")
+
+	tests := []struct {
+		name     string
+		caller   Caller
+		function string
+		args     []string
+	}{
+		{"overwrite", alice, "set_note", []string{"todo", "nope"}},
+		{"admin overwrite", admin, "set_note", []string{"todo", "nope"}},
+		{"delete", alice, "delete_note", []string{"todo"}},
+		{"admin delete", admin, "delete_note", []string{"todo"}},
+	}
+	for _, tt := range tests {
+		if _, err := c.as(tt.caller).invoke(tt.function, tt.args...); err == nil {
+			t.Errorf("%s: %s changed bob's note", tt.name, tt.caller.User)
+		}
+	}
+
+	var note Note
+	c.mustQuery(&note, "get_note", "todo")
+	if note.Value != "eggs" || note.Owner != "bob" || note.TxID != "tx2" {
+		t.Fatalf("todo = %v, want bob's eggs from tx2", note)
+	}
+	var notes []Note
+	c.mustQuery(&notes, "notes_by_owner", "Bob")
+	if len(notes) != 1 || notes[0].Key != "todo" {
+		t.Fatalf("bob's notes = %v", notes)
+	}
+
+	c.as(bob).mustInvoke("delete_note", `{"name":"todo"}`)
+	c.mustQuery(&notes, "notes_by_owner", "bob")
+	if len(notes) != 0 {
+		t.Fatalf("bob's notes = %v after the delete", notes)
+	}
+	if _, err := c.query("get_note", "todo"); err == nil {
+		t.Fatal("todo is still there")
+	}
+}
+
+func TestRawWritesAreAudited(t *testing.T) {
+	c := newTestChain(t)
+	c.mustInvoke("write", "x", "1")
+	c.mustInvoke("jsonWrite", "y", `{"a":1}`)
+	c.mustInvoke("delete", "x")
+
+	tests := []struct {
+		name, payload string
+	}{
+		{stateWrittenEvent, `{"tx_id":"tx1","by":"admin","keys":["x"]}`},
+		{stateWrittenEvent, `{"tx_id":"tx2","by":"admin","keys":["y"]}`},
+		{stateDeletedEvent, `{"tx_id":"tx3","by":"admin","keys":["x"]}`},
+	}
+	if len(c.st.Events) != len(tests) {
+		t.Fatalf("%d events, want %d", len(c.st.Events), len(tests))
+	}
+	for i, tt := range tests {
+		if event := c.st.Events[i]; event.Name != tt.name || string(event.Payload) != tt.payload {
+			t.Errorf("event %d = %s %s, want %s %s", i, event.Name, event.Payload, tt.name, tt.payload)
+		}
+	}
+}
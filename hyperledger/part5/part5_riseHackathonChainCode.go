@@ -25,46 +25,62 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
 // SimpleChaincode example simple Chaincode implementation
 type SimpleChaincode struct {
+	Identify CallerResolver //who is calling, nil reads it from the transaction certificate
 }
 
-var smartPayIndexStr = "_smartpayindex" //name for the key/value that will store a list of all known marbles
-var paymentIndexStr = "_paymentindex"
+var smartPayIndexStr = "_smartpayindex" //legacy list of every SmartPay id, retired by migrate_smartpay_index
 
 // PaymentTransaction simple Payment Transaction Schema
 type PaymentTransaction struct {
-	PaymentTransID string  `json:"paymentTransID"` //the fieldtags are needed to keep case from bouncing around
-	DrawerID       string  `json:"drawerID"`
-	PayeeID        string  `json:"payeeID"`
-	Amount         float64 `json:"amount"`
-	Currency       string  `json:"currency"`
+	PaymentTransID string `json:"paymentTransID"` //the fieldtags are needed to keep case from bouncing around
+	DrawerID       string `json:"drawerID"`
+	PayeeID        string `json:"payeeID"`
+	Amount         Money  `json:"amount"`
+	Status         string `json:"status,omitempty"`     //"executed" once execute_payment has moved the funds
+	ExecutedAt     int64  `json:"executedAt,omitempty"` //utc ms, from the executing transaction
 }
 
 // RemittanceTransaction simple Remittance Transation Schema
 type RemittanceTransaction struct {
-	RemittanceTransID   string  `json:"remittanceTransID"` //the fieldtags are needed to keep case from bouncing around
-	SourceID            string  `json:"sourceID"`
-	SourceCurrency      string  `json:"sourceCurrency"`
-	DestinationID       string  `json:"destinationID"`
-	DestinationCurrency string  `json:"destinationCurrency"`
-	Amount              float64 `json:"amount"`
-	ExchangeRate        float64 `json:"ExchangeRate"`
+	RemittanceTransID   string `json:"remittanceTransID"` //the fieldtags are needed to keep case from bouncing around
+	SourceID            string `json:"sourceID"`
+	DestinationID       string `json:"destinationID"`
+	DestinationCurrency string `json:"destinationCurrency"`
+	Amount              Money  `json:"amount"`                    //what the source sends, in the source currency
+	ExchangeRate        Rate   `json:"ExchangeRate"`              //destination currency per unit of source currency
+	RateEffectiveAt     int64  `json:"rateEffectiveAt,omitempty"` //utc ms, when the published rate it was checked against took effect
+	DestinationAmount   Money  `json:"destinationAmount"`         //what the destination receives, Amount converted at ExchangeRate
 }
 
 // LendingTransacation simple Lending Transaction Schema
 type LendingTransacation struct {
-	LendingTransID string  `json:"lendingTransID"` //the fieldtags are needed to keep case from bouncing around
-	LendorID       string  `json:"lendorID"`
-	BorrowerID     string  `json:"borrowerID"`
-	LoanAmount     float64 `json:"loanAmount"`
-	Currency       string  `json:"currency"`
-	LoanRate       float64 `json:"loanRate"`
-	LoanReturnDate string  `json:"loanReturnDate"`
+	LendingTransID string `json:"lendingTransID"` //the fieldtags are needed to keep case from bouncing around
+	LendorID       string `json:"lendorID"`
+	BorrowerID     string `json:"borrowerID"`
+	LoanAmount     Money  `json:"loanAmount"`
+	LoanRate       Rate   `json:"loanRate"` //percent per year
+	LoanReturnDate string `json:"loanReturnDate"`
+
+	//filled in once the loan is disbursed, see loans.go
+	InterestMethod string      `json:"interestMethod,omitempty"` //simple or compound
+	DayCount       string      `json:"dayCount,omitempty"`       //act/365, act/360 or 30/360
+	Status         string      `json:"status,omitempty"`         //disbursed, overdue or repaid
+	DisbursedAt    int64       `json:"disbursedAt,omitempty"`    //utc ms
+	DueAt          int64       `json:"dueAt,omitempty"`          //utc ms, end of the LoanReturnDate day
+	AccruedAt      int64       `json:"accruedAt,omitempty"`      //utc ms, interest is booked up to here
+	Principal      *Money      `json:"principal,omitempty"`      //principal still owed
+	Interest       *Money      `json:"interest,omitempty"`       //interest booked and not yet paid
+	PeriodStart    int64       `json:"periodStart,omitempty"`    //utc ms, the interest period running since the last repayment
+	PeriodInterest *Money      `json:"periodInterest,omitempty"` //interest booked since PeriodStart
+	Repayments     []Repayment `json:"repayments,omitempty"`
 }
 
 // SmartPayTransaction simple SmartPay Transaction Schema
@@ -73,6 +89,7 @@ type SmartPayTransaction struct {
 	PaymentTrans    PaymentTransaction    `json:"paymentTrans"`    //description of desired marble
 	RemitTrans      RemittanceTransaction `json:"remitTrans"`      //array of marbles willing to trade away
 	LendTrans       LendingTransacation   `json:"lentTrans"`
+	CreatedAt       int64                 `json:"createdAt"` //utc ms, from the transaction that created it
 }
 
 // ============================================================================================================================
@@ -86,38 +103,47 @@ func main() {
 }
 
 // ============================================================================================================================
-// Init - reset all the things
+// Init - Our entry point for deploys, the peer's stub is wrapped so the handlers only see ChaincodeState
 // ============================================================================================================================
 func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return t.init(shimState{stub}, args)
+}
+
+// ============================================================================================================================
+// init - set up the chaincode's keys that are missing, safe to run again on upgrade, see reset to start over
+// ============================================================================================================================
+func (t *SimpleChaincode) init(stub ChaincodeState, args []string) ([]byte, error) {
 	var Aval int
 	var err error
 
+	args, err = requestArgs(args, &InitRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
 	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+		return nil, argError("Incorrect number of arguments. Expecting 1")
 	}
 
 	// Initialize the chaincode
 	Aval, err = strconv.Atoi(args[0])
 	if err != nil {
-		return nil, errors.New("Expecting integer value for asset holding")
+		return nil, argError("Expecting integer value for asset holding")
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState("abc", []byte(strconv.Itoa(Aval))) //making a test var "abc", I find it handy to read/write to it right away to test the network
+	key, err := ledger.UserKey("abc")
 	if err != nil {
 		return nil, err
 	}
-
-	var empty []string
-	jsonAsBytes, _ := json.Marshal(empty) //marshal an emtpy array of strings to clear the index
-	err = stub.PutState(smartPayIndexStr, jsonAsBytes)
+	valAsBytes, err := stub.GetState(key)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("Failed to get state for abc")
 	}
-
-	err = stub.PutState(paymentIndexStr, jsonAsBytes)
-	if err != nil {
-		return nil, err
+	if valAsBytes == nil { //set up by an earlier init otherwise, leave it be
+		err = stub.PutState(key, []byte(strconv.Itoa(Aval))) //making a test var "abc", I find it handy to read/write to it right away to test the network
+		if err != nil {
+			return nil, err
+		}
 	}
 	return nil, nil
 }
@@ -134,11 +160,20 @@ func (t *SimpleChaincode) Run(stub *shim.ChaincodeStub, function string, args []
 // Invoke - Our entry point for Invocations
 // ============================================================================================================================
 func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return t.invoke(shimState{stub}, function, args)
+}
+
+// ============================================================================================================================
+// invoke - route an invocation to its handler
+// ============================================================================================================================
+func (t *SimpleChaincode) invoke(stub ChaincodeState, function string, args []string) ([]byte, error) {
 	fmt.Println("invoke is running " + function)
 
 	// Handle different functions
-	if function == "init" { //initialize the chaincode state, used as reset
-		return t.Init(stub, "init", args)
+	if function == "init" { //initialize the chaincode state, only adds what is missing
+		return t.init(stub, args)
+	} else if function == "reset" { //delete everything the chaincode stored, admin only
+		return t.reset(stub, args)
 	} else if function == "delete" { //deletes an entity from its state
 		res, err := t.Delete(stub, args) //lets make sure all open trades are still valid
 		return res, err
@@ -148,40 +183,105 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 		return t.initSmartPay(stub, args)
 	} else if function == "jsonWrite" { //writes a value to the chaincode state
 		return t.JsonWrite(stub, args)
+	} else if function == "set_note" { //keep a value only you can change
+		return t.set_note(stub, args)
+	} else if function == "delete_note" { //remove one of your notes
+		return t.delete_note(stub, args)
+	} else if function == "create_account" { //open an empty account
+		return t.create_account(stub, args)
+	} else if function == "deposit" { //add funds to an account
+		return t.deposit(stub, args)
+	} else if function == "execute_payment" { //move a payment's funds from drawer to payee
+		return t.execute_payment(stub, args)
+	} else if function == "disburse_loan" { //pay a loan out to the borrower
+		return t.disburse_loan(stub, args)
+	} else if function == "repay_loan" { //pay towards a loan
+		return t.repay_loan(stub, args)
+	} else if function == "accrue_interest" { //book a loan's interest up to now
+		return t.accrue_interest(stub, args)
+	} else if function == "mark_overdue" { //flag a loan that is past due
+		return t.mark_overdue(stub, args)
+	} else if function == "set_rate" { //publish an exchange rate, oracle only
+		return t.set_rate(stub, args)
+	} else if function == "set_rate_tolerance" { //how far a caller's exchange rate may stray, admin only
+		return t.set_rate_tolerance(stub, args)
+	} else if function == "migrate_smartpay_index" { //index transactions created before the smartpay_by_* queries
+		return t.migrate_smartpay_index(stub, args)
+	} else if function == "migrate_keyspace" { //move records off the flat keys used before namespaces, admin only
+		return t.migrate_keyspace(stub, args)
 	}
 	fmt.Println("invoke did not find func: " + function) //error
 
-	return nil, errors.New("Received unknown function invocation")
+	return nil, argError("Received unknown function invocation")
 }
 
 // ============================================================================================================================
 // Query - Our entry point for Queries
 // ============================================================================================================================
 func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return t.query(shimState{stub}, function, args)
+}
+
+// ============================================================================================================================
+// query - route a query to its handler
+// ============================================================================================================================
+func (t *SimpleChaincode) query(stub ChaincodeState, function string, args []string) ([]byte, error) {
 	fmt.Println("query is running " + function)
 
 	// Handle different functions
 	if function == "read" { //read a variable
 		return t.read(stub, args)
+	} else if function == "validate_records" { //report stored transactions that don't decode
+		return t.validate_records(stub, args)
+	} else if function == "balance" { //read an account's balances
+		return t.balance(stub, args)
+	} else if function == "loan_balance" { //what is owed on a loan
+		return t.loan_balance(stub, args)
+	} else if function == "get_rate" { //the exchange rate in effect for a currency pair
+		return t.get_rate(stub, args)
+	} else if function == "get_note" { //read one note
+		return t.get_note(stub, args)
+	} else if function == "notes_by_owner" { //list a user's notes
+		return t.notes_by_owner(stub, args)
+	} else if function == "get_smartpay" { //read one SmartPay transaction
+		return t.get_smartpay(stub, args)
+	} else if function == "list_smartpay" { //list every SmartPay transaction, a page at a time
+		return t.list_smartpay(stub, args)
+	} else if function == "smartpay_by_drawer" { //list a drawer's transactions
+		return t.smartpay_by_drawer(stub, args)
+	} else if function == "smartpay_by_payee" { //list a payee's transactions
+		return t.smartpay_by_payee(stub, args)
+	} else if function == "smartpay_by_borrower" { //list a borrower's transactions
+		return t.smartpay_by_borrower(stub, args)
+	} else if function == "smartpay_by_lender" { //list a lender's transactions
+		return t.smartpay_by_lender(stub, args)
+	} else if function == "smartpay_by_currency" { //list transactions using a currency
+		return t.smartpay_by_currency(stub, args)
+	} else if function == "smartpay_by_date" { //list transactions created between two dates
+		return t.smartpay_by_date(stub, args)
 	}
 	fmt.Println("query did not find func: " + function) //error
 
-	return nil, errors.New("Received unknown function query")
+	return nil, argError("Received unknown function query")
 }
 
 // ============================================================================================================================
 // Read - read a variable from chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) read(stub ChaincodeState, args []string) ([]byte, error) {
 	var name, jsonResp string
 	var err error
 
 	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting name of the var to query")
+		return nil, argError("Incorrect number of arguments. Expecting name of the var to query")
 	}
 
 	name = args[0]
-	valAsbytes, err := stub.GetState(name) //get the var from chaincode state
+	key, err := readKey(stub, name)
+	if err != nil {
+		return nil, err
+	}
+	valAsbytes, err := stub.GetState(key) //get the var from chaincode state
 	if err != nil {
 		jsonResp = "{\"Error\":\"Failed to get state for " + name + "\"}"
 		return nil, errors.New(jsonResp)
@@ -191,262 +291,345 @@ func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte,
 }
 
 // ============================================================================================================================
-// Delete - remove a key/value pair from state
+// Delete - remove a key/value pair from state, admin only
 // ============================================================================================================================
-func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Delete(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &NameRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
 	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+		return nil, argError("Incorrect number of arguments. Expecting 1")
 	}
 
+	err = t.requireRole(stub, adminRole, "delete raw state") //users keep their own values with set_note
+	if err != nil {
+		return nil, err
+	}
 	name := args[0]
-	err := stub.DelState(name) //remove the key from chaincode state
+	err = ledger.CheckName("name", name) //the chaincode's own documents can't be deleted from outside
+	if err != nil {
+		return nil, err
+	}
+	key, err := smartPayKey(name)
+	if err != nil {
+		return nil, err
+	}
+	smartPayAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if smartPayAsBytes == nil { //not a transaction, a value from write or jsonWrite then
+		key, err = ledger.UserKey(name)
+		if err != nil {
+			return nil, err
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return nil, errors.New("Failed to delete state")
+		}
+		return nil, t.auditRaw(stub, stateDeletedEvent, name)
+	}
+	smartPay, getErr := getSmartPay(stub, name) //one written before json.Marshal has no index entries
+	err = stub.DelState(key)                    //remove the key from chaincode state
 	if err != nil {
 		return nil, errors.New("Failed to delete state")
 	}
+	if getErr == nil {
+		err = unindexSmartPay(stub, smartPay)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	//get the smartPay index
-	smartPayTransactionAsBytes, err := stub.GetState(smartPayIndexStr)
+	//drop it from the legacy index too, if migrate_smartpay_index hasn't already
+	smartPayIndex, err := getSmartPayIndex(stub)
 	if err != nil {
-		return nil, errors.New("Failed to get SmartPayTransaction index")
+		return nil, err
 	}
-	var smartPayIndex []string
-	json.Unmarshal(smartPayTransactionAsBytes, &smartPayIndex) //un stringify it aka JSON.parse()
-
-	//remove marble from index
 	for i, val := range smartPayIndex {
-		fmt.Println(strconv.Itoa(i) + " - looking at " + val + " for " + name)
-		if val == name { //find the correct marble
+		if val == name { //find the correct transaction
 			fmt.Println("Found SmartPay Transaction")
-			smartPayIndex = append(smartPayIndex[:i], smartPayIndex[i+1:]...) //remove it
-			for x := range smartPayIndex {                                    //debug prints...
-				fmt.Println(string(x) + " - " + smartPayIndex[x])
+			err = retireSmartPayIndex(stub, append(smartPayIndex[:i], smartPayIndex[i+1:]...)) //save new index
+			if err != nil {
+				return nil, err
 			}
 			break
 		}
 	}
-	jsonAsBytes, _ := json.Marshal(smartPayIndex) //save new index
-	err = stub.PutState(smartPayIndexStr, jsonAsBytes)
-	return nil, nil
+	return nil, t.auditRaw(stub, stateDeletedEvent, name)
 }
 
 // ============================================================================================================================
-// Write - write variable into chaincode state
+// Write - write variable into chaincode state, admin only
 // ============================================================================================================================
-func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Write(stub ChaincodeState, args []string) ([]byte, error) {
 	var name, value string // Entities
 	var err error
 	fmt.Println("running write()")
 
+	args, err = requestArgs(args, &WriteRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
 	if len(args) != 2 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
+		return nil, argError("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
 	}
 
+	err = t.requireRole(stub, adminRole, "write raw state") //users keep their own values with set_note
+	if err != nil {
+		return nil, err
+	}
 	name = args[0] //rename for funsies
 	value = args[1]
-	err = stub.PutState(name, []byte(value)) //write the variable into the chaincode state
+	key, err := ledger.WriteKey(name)
 	if err != nil {
 		return nil, err
 	}
-	return nil, nil
+	err = stub.PutState(key, []byte(value)) //write the variable into the chaincode state
+	if err != nil {
+		return nil, err
+	}
+	return nil, t.auditRaw(stub, stateWrittenEvent, name)
 }
 
 // ============================================================================================================================
-// Ecrire - Prepend 9999: and write variable into chaincode state
+// JsonWrite - Prepend JsonWrite77: and write variable into chaincode state, admin only
 // ============================================================================================================================
-func (t *SimpleChaincode) JsonWrite(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) JsonWrite(stub ChaincodeState, args []string) ([]byte, error) {
 	var name, value string // Entities
 	var err error
 	fmt.Println("running JsonWrite()")
 
+	args, err = requestArgs(args, &WriteRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
 	if len(args) != 2 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
+		return nil, argError("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
 	}
 
+	err = t.requireRole(stub, adminRole, "write raw state") //users keep their own values with set_note
+	if err != nil {
+		return nil, err
+	}
 	name = args[0] //rename for funsies
 	value = "JsonWrite77:" + args[1]
-	err = stub.PutState(name, []byte(value)) //write the variable into the chaincode state
+	key, err := ledger.WriteKey(name)
 	if err != nil {
 		return nil, err
 	}
-	return nil, nil
+	err = stub.PutState(key, []byte(value)) //write the variable into the chaincode state
+	if err != nil {
+		return nil, err
+	}
+	return nil, t.auditRaw(stub, stateWrittenEvent, name)
 }
 
 // ============================================================================================================================
 // Init Payment - create a new marble, store into chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) initSmartPay(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) initSmartPay(stub ChaincodeState, args []string) ([]byte, error) {
 	var err error
 	//   0       1          2          3       4
 	// "asdf", "blue", "35", "bob"
 	// TransId  DrawerID   PayeeID   Amount   Currency
 
+	args, err = requestArgs(args, &SmartPayRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if Correct Number of arguments are passed
-	if len(args) < 15 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 15")
+	if len(args) != 20 {
+		return nil, argError("Incorrect number of arguments. Expecting 20")
 	}
 
 	// ------------------ Payment input sanitation ------------------------------
 	fmt.Println("--Payment Trans Data")
 	if len(args[0]) <= 0 {
-		return nil, errors.New("1st argument must be a non-empty string")
+		return nil, argError("1st argument must be a non-empty string")
 	}
 	if len(args[1]) <= 0 {
-		return nil, errors.New("2nd argument must be a non-empty string")
+		return nil, argError("2nd argument must be a non-empty string")
 	}
 	if len(args[2]) <= 0 {
-		return nil, errors.New("3rd argument must be a non-empty string")
+		return nil, argError("3rd argument must be a non-empty string")
 	}
 	if len(args[3]) <= 0 {
-		return nil, errors.New("4th argument must be a non-empty string")
+		return nil, argError("4th argument must be a non-empty string")
 	}
 	if len(args[4]) <= 0 {
-		return nil, errors.New("5th argument must be a non-empty string")
+		return nil, argError("5th argument must be a non-empty string")
 	}
 
 	ptransID := strings.ToLower(args[0])
 	drawerID := strings.ToLower(args[1])
 	payeeID := strings.ToLower(args[2])
-	pAmount, err := strconv.ParseFloat(args[3], 64)
+	pAmount, err := ParseMoney(args[3], args[4]) //amounts must be exact in their currency, nothing is rounded
 	if err != nil {
-		return nil, errors.New("3rd argument must be a Floating Point")
+		return nil, argError("4th and 5th arguments must be an amount and its currency - " + err.Error())
+	}
+	if pAmount.Units <= 0 {
+		return nil, argError("4th argument must be a positive amount")
 	}
-	currency := strings.ToLower(args[4])
 
 	// ------------------ Remittance input sanitation ------------------------------
 	fmt.Println("--Remittance Trans Data")
 	if len(args[5]) <= 0 {
-		return nil, errors.New("6th argument must be a non-empty string")
+		return nil, argError("6th argument must be a non-empty string")
 	}
 	if len(args[6]) <= 0 {
-		return nil, errors.New("7th argument must be a non-empty string")
+		return nil, argError("7th argument must be a non-empty string")
 	}
 	if len(args[7]) <= 0 {
-		return nil, errors.New("8th argument must be a non-empty string")
+		return nil, argError("8th argument must be a non-empty string")
 	}
 	if len(args[8]) <= 0 {
-		return nil, errors.New("9th argument must be a non-empty string")
+		return nil, argError("9th argument must be a non-empty string")
 	}
 	if len(args[9]) <= 0 {
-		return nil, errors.New("10th argument must be a non-empty string")
+		return nil, argError("10th argument must be a non-empty string")
 	}
 	if len(args[10]) <= 0 {
-		return nil, errors.New("11th argument must be a non-empty string")
-	}
-	if len(args[11]) <= 0 {
-		return nil, errors.New("12th argument must be a non-empty string")
+		return nil, argError("11th argument must be a non-empty string")
 	}
 
 	rtransID := strings.ToLower(args[5])
 	sourceID := strings.ToLower(args[6])
-	sourceCurrency := strings.ToLower(args[7])
 	destinationID := strings.ToLower(args[8])
-	destinationCurrency := strings.ToLower(args[9])
-	rAmount, err := strconv.ParseFloat(args[10], 64)
+	destinationCurrency, _, err := normalizeCurrency(args[9])
+	if err != nil {
+		return nil, argError("10th argument must be a currency - " + err.Error())
+	}
+	rAmount, err := ParseMoney(args[10], args[7])
+	if err != nil {
+		return nil, argError("11th and 8th arguments must be an amount and its currency - " + err.Error())
+	}
+	if rAmount.Units <= 0 {
+		return nil, argError("11th argument must be a positive amount")
+	}
+	exchangeRate, rateEffectiveAt, err := remittanceRate(stub, rAmount.Currency, destinationCurrency, args[11]) //empty takes the published rate, see rates.go
 	if err != nil {
-		return nil, errors.New("10 argument must be a Floating Point")
+		return nil, err
 	}
-	exchangeRate, err := strconv.ParseFloat(args[11], 64)
+	destinationAmount, err := rAmount.Convert(exchangeRate, destinationCurrency, RoundHalfEven)
 	if err != nil {
-		return nil, errors.New("11 argument must be a Floating Point")
+		return nil, errors.New("Failed to convert the remittance - " + err.Error())
 	}
 
 	// ------------------ Lending input sanitation ------------------------------
 	fmt.Println("--Lending Trans Data")
 	if len(args[12]) <= 0 {
-		return nil, errors.New("13th argument must be a non-empty string")
+		return nil, argError("13th argument must be a non-empty string")
 	}
 	if len(args[13]) <= 0 {
-		return nil, errors.New("14th argument must be a non-empty string")
+		return nil, argError("14th argument must be a non-empty string")
 	}
 	if len(args[14]) <= 0 {
-		return nil, errors.New("15th argument must be a non-empty string")
+		return nil, argError("15th argument must be a non-empty string")
 	}
 	if len(args[15]) <= 0 {
-		return nil, errors.New("16th argument must be a non-empty string")
+		return nil, argError("16th argument must be a non-empty string")
 	}
 	if len(args[16]) <= 0 {
-		return nil, errors.New("17th argument must be a non-empty string")
+		return nil, argError("17th argument must be a non-empty string")
 	}
 	if len(args[17]) <= 0 {
-		return nil, errors.New("18th argument must be a non-empty string")
+		return nil, argError("18th argument must be a non-empty string")
 	}
 	if len(args[18]) <= 0 {
-		return nil, errors.New("19th argument must be a non-empty string")
+		return nil, argError("19th argument must be a non-empty string")
 	}
 
 	ltransID := strings.ToLower(args[12])
 	lendorID := strings.ToLower(args[13])
 	borrowerID := strings.ToLower(args[14])
-	loanAmount, err := strconv.ParseFloat(args[15], 64)
+	loanAmount, err := ParseMoney(args[15], args[16])
 	if err != nil {
-		return nil, errors.New("15 argument must be a Floating Point")
+		return nil, argError("16th and 17th arguments must be an amount and its currency - " + err.Error())
 	}
-	lcurrency := strings.ToLower(args[16])
-	loanRate, err := strconv.ParseFloat(args[17], 64)
-	if err != nil {
-		return nil, errors.New("17 argument must be a Floating Point")
+	if loanAmount.Units <= 0 {
+		return nil, argError("16th argument must be a positive amount")
+	}
+	loanRate, err := ParseRate(args[17])
+	if err != nil || loanRate < 0 {
+		return nil, argError("18th argument must be a non-negative decimal rate")
 	}
 	loanReturnDate := strings.ToLower(args[18])
 
 	// ------------------ Lending input sanitation ------------------------------
 	fmt.Println("--SmartPay Data")
 	if len(args[19]) <= 0 {
-		return nil, errors.New("20th argument must be a non-empty string")
+		return nil, argError("20th argument must be a non-empty string")
 	}
 
 	smartPayID := strings.ToLower(args[19])
+	err = ledger.CheckName("20th argument", smartPayID)
+	if err != nil {
+		return nil, err
+	}
 
 	//----------------------------------------------------------------------------------------------------------------
 	//check if Payment already exists
 
-	smartPayAsBytes, err := stub.GetState(smartPayID)
+	key, err := smartPayKey(smartPayID)
+	if err != nil {
+		return nil, err
+	}
+	smartPayAsBytes, err := stub.GetState(key)
 	if err != nil {
 		return nil, errors.New("Failed to get Transaction name")
 	}
 
-	/*
-		pRes := PaymentTransaction{}
-		tRes := RemittanceTransaction{}
-		lRes := LendingTransacation{}
-	*/
-	sRes := SmartPayTransaction{}
-
-	json.Unmarshal(smartPayAsBytes, &sRes)
-	if sRes.SmartPayTransID == smartPayID {
+	if smartPayAsBytes != nil { //records written before json.Marshal don't decode, so any value under this id counts
 		fmt.Println("This SmartPay Transaction arleady exists: " + smartPayID)
-		fmt.Println(sRes)
-		return nil, errors.New("This smartPay Tranaction arleady exists") //all stop a marble by this name exists
+		return nil, conflict("This smartPay Tranaction arleady exists") //all stop a transaction by this id exists
 	}
 
-	//build the Payment json string manually
-	strPmt := `{"paymentTransID": "` + ptransID + `", "drawerID": "` + drawerID + `", "payeeID": "` + payeeID + `", "amount": ` + strconv.FormatFloat(pAmount, 'f', -1, 64) + `, "currency": "` + currency + `"}`
-	fmt.Println(strPmt)
-
-	strRem := `{"remittanceTransID": "` + rtransID + `", "sourceID": "` + sourceID + `", "sourceCurrency": "` + sourceCurrency + `", "destinationID": "` + destinationID + `", "destinationCurrency": "` + destinationCurrency + `","amount": ` + strconv.FormatFloat(rAmount, 'f', -1, 64) + `, "ExchangeRate": ` + strconv.FormatFloat(exchangeRate, 'f', -1, 64) + `"}`
-	fmt.Println(strRem)
-
-	strLen := `{"lendingTransID": "` + ltransID + `", "lendorID": "` + lendorID + `", "borrowerID": "` + borrowerID + `", "loanAmount": ` + strconv.FormatFloat(loanAmount, 'f', -1, 64) + `, "currency": "` + lcurrency + `","loanRate": ` + strconv.FormatFloat(loanRate, 'f', -1, 64) + `, "loanReturnDate": "` + loanReturnDate + `"}`
-	fmt.Println(strLen)
-
-	strSmPay := `{"SmartPayTransID": "` + smartPayID + `", "PaymentTrans": "` + strPmt + `", "RemitTrans": "` + strRem + `", "LendTrans": "` + strLen + `"}`
-
-	err = stub.PutState(smartPayID, []byte(strSmPay)) //store marble with id as key
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+
+	smartPay := SmartPayTransaction{
+		SmartPayTransID: smartPayID,
+		CreatedAt:       txTime.UnixNano() / int64(time.Millisecond),
+		PaymentTrans: PaymentTransaction{
+			PaymentTransID: ptransID,
+			DrawerID:       drawerID,
+			PayeeID:        payeeID,
+			Amount:         pAmount,
+		},
+		RemitTrans: RemittanceTransaction{
+			RemittanceTransID:   rtransID,
+			SourceID:            sourceID,
+			DestinationID:       destinationID,
+			DestinationCurrency: destinationCurrency,
+			Amount:              rAmount,
+			ExchangeRate:        exchangeRate,
+			RateEffectiveAt:     rateEffectiveAt,
+			DestinationAmount:   destinationAmount,
+		},
+		LendTrans: LendingTransacation{
+			LendingTransID: ltransID,
+			LendorID:       lendorID,
+			BorrowerID:     borrowerID,
+			LoanAmount:     loanAmount,
+			LoanRate:       loanRate,
+			LoanReturnDate: loanReturnDate,
+		},
+	}
+	jsonAsBytes, _ := json.Marshal(smartPay)
+	fmt.Println(string(jsonAsBytes))
+	err = putSmartPay(stub, smartPay) //store the transaction under its id
 	if err != nil {
 		return nil, err
 	}
-	//get the Payment index
-	smartPayAsBytes, err = stub.GetState(smartPayIndexStr)
+	err = indexSmartPay(stub, smartPay) //list it for list_smartpay and the smartpay_by_* queries, _smartpayindex is retired
 	if err != nil {
-		return nil, errors.New("Failed to get marble index")
+		return nil, err
 	}
-	var smartPayIndex []string
-	json.Unmarshal(smartPayAsBytes, &smartPayIndex) //un stringify it aka JSON.parse()
-
-	//append
-	smartPayIndex = append(smartPayIndex, smartPayID) //add marble name to index list
-	fmt.Println("! Payment index: ", smartPayIndex)
-	jsonAsBytes, _ := json.Marshal(smartPayIndex)
-	err = stub.PutState(smartPayIndexStr, jsonAsBytes) //store name of marble
 
 	fmt.Println("- End init SmartPay")
 	return nil, nil
@@ -0,0 +1,460 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var admin = Caller{User: "admin", Role: adminRole}
+var oracle = Caller{User: "fx", Role: oracleRole}
+var funder = Caller{User: "mint", Role: funderRole}
+var alice = Caller{User: "alice"}
+var bob = Caller{User: "bob"}
+var bank = Caller{User: "bank"}
+
+// testChain runs a SimpleChaincode over a MemState the way a peer would, every invoke is its own transaction
+type testChain struct {
+	t      *testing.T
+	cc     *SimpleChaincode
+	st     *ledger.MemState
+	caller Caller //who the next call comes from
+	tx     int
+}
+
+// ============================================================================================================================
+// newTestChain - an empty ledger whose first transaction runs at 2016-01-01T00:00:01Z, called by an admin
+// ============================================================================================================================
+func newTestChain(t *testing.T) *testChain {
+	c := &testChain{t: t, st: ledger.NewMemState(), caller: admin}
+	c.cc = &SimpleChaincode{Identify: func(ChaincodeState) (Caller, error) { return c.caller, nil }}
+	c.st.TxTime = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	return c
+}
+
+// ============================================================================================================================
+// seedChain - the ledger most tests start from, a USD/INR rate of 65.2, empty accounts for alice, bob and bank and
+// SmartPay sp1 from smartPayArgs
+// ============================================================================================================================
+func seedChain(t *testing.T) *testChain {
+	c := newTestChain(t)
+	c.mustInvoke("init", "100")
+	c.as(oracle).mustInvoke("set_rate", "usd", "inr", "65.2")
+	c.as(admin)
+	for _, id := range []string{"alice", "bob", "bank"} {
+		c.mustInvoke("create_account", id)
+	}
+	c.mustInvoke("initSmartPay", smartPayArgs()...)
+	return c
+}
+
+// ============================================================================================================================
+// smartPayArgs - initSmartPay arguments for sp1, alice pays bob 10.50 USD, sends carl 100 USD as INR at 65.2 and
+// bank lends bob 1000 USD at 5% until 2017-01-01
+// ============================================================================================================================
+func smartPayArgs() []string {
+	return []string{
+		"p1", "alice", "bob", "10.50", "usd",
+		"r1", "alice", "usd", "carl", "inr", "100", "65.2",
+		"l1", "bank", "bob", "1000", "usd", "5", "2017-01-01",
+		"sp1",
+	}
+}
+
+// as - make the next calls as caller
+func (c *testChain) as(caller Caller) *testChain {
+	c.caller = caller
+	return c
+}
+
+// at - move the clock to when, the next transaction runs a second after it
+func (c *testChain) at(when time.Time) {
+	c.st.TxTime = when
+}
+
+func (c *testChain) invoke(function string, args ...string) ([]byte, error) {
+	c.tx++
+	c.st.TxID = "tx" + strconv.Itoa(c.tx)
+	c.st.TxTime = c.st.TxTime.Add(time.Second)
+	return c.cc.invoke(c.st, function, args)
+}
+
+func (c *testChain) mustInvoke(function string, args ...string) []byte {
+	c.t.Helper()
+	res, err := c.invoke(function, args...)
+	if err != nil {
+		c.t.Fatalf("%s %q: %s", function, args, err)
+	}
+	return res
+}
+
+func (c *testChain) query(function string, args ...string) ([]byte, error) {
+	return c.cc.query(c.st, function, args)
+}
+
+// mustQuery - run a query and decode its JSON answer into v
+func (c *testChain) mustQuery(v interface{}, function string, args ...string) {
+	c.t.Helper()
+	res, err := c.query(function, args...)
+	if err != nil {
+		c.t.Fatalf("%s %q: %s", function, args, err)
+	}
+	err = json.Unmarshal(res, v)
+	if err != nil {
+		c.t.Fatalf("%s %q answered %q: %s", function, args, res, err)
+	}
+}
+
+// balance - what an account holds in currency, as "9.50 USD"
+func (c *testChain) balance(id string, currency string) string {
+	c.t.Helper()
+	var account Account
+	c.mustQuery(&account, "balance", id, currency)
+	return account.Balances[strings.ToUpper(currency)].String()
+}
+
+// smartPay - the stored SmartPay transaction
+func (c *testChain) smartPay(id string) SmartPayTransaction {
+	c.t.Helper()
+	smartPay, err := getSmartPay(c.st, id)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return smartPay
+}
+
+// fund - deposit into accounts as an admin, "bank", "5000", "usd", ...
+func (c *testChain) fund(deposits ...string) {
+	c.t.Helper()
+	caller := c.caller
+	for i := 0; i+2 < len(deposits); i += 3 {
+		c.as(admin).mustInvoke("deposit", deposits[i:i+3]...)
+	}
+	c.as(caller)
+}
+
+// ============================================================================================================================
+// TestInvoke - every invoke function, run against a fresh seedChain
+// ============================================================================================================================
+func TestInvoke(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(c *testChain) //runs before the call
+		caller   Caller
+		function string
+		args     []string
+		err      string //part of the error, empty when the call must succeed
+		check    func(t *testing.T, c *testChain)
+	}{
+		{"init again keeps abc", nil, admin, "init", []string{"5"}, "", func(t *testing.T, c *testChain) {
+			if value, _ := c.query("read", "abc"); string(value) != "100" {
+				t.Errorf("abc = %q, want 100", value)
+			}
+		}},
+		{"init json", nil, admin, "init", []string{`{"value":5}`}, "", nil},
+		{"init not a number", nil, admin, "init", []string{"lots"}, "integer", nil},
+		{"init no value", nil, admin, "init", []string{`{}`}, "value", nil},
+
+		{"reset", nil, admin, "reset", []string{"RESET"}, "", func(t *testing.T, c *testChain) {
+			if value, _ := c.query("read", "sp1"); value != nil {
+				t.Errorf("sp1 = %q after reset", value)
+			}
+		}},
+		{"reset unconfirmed", nil, admin, "reset", []string{"yes"}, "RESET", nil},
+		{"reset by a user", nil, alice, "reset", []string{"RESET"}, "admin", nil},
+
+		{"delete", nil, admin, "delete", []string{"sp1"}, "", func(t *testing.T, c *testChain) {
+			if _, err := getSmartPay(c.st, "sp1"); err == nil {
+				t.Error("sp1 still exists")
+			}
+		}},
+		{"delete by a user", nil, alice, "delete", []string{"sp1"}, "admin", nil},
+		{"delete reserved", nil, admin, "delete", []string{"_smartpayindex"}, "reserved", nil},
+
+		{"write", nil, admin, "write", []string{"hello", "world"}, "", func(t *testing.T, c *testChain) {
+			if value, _ := c.query("read", "hello"); string(value) != "world" {
+				t.Errorf("hello = %q, want world", value)
+			}
+		}},
+		{"write by a user", nil, alice, "write", []string{"hello", "world"}, "admin", nil},
+		{"write reserved", nil, admin, "write", []string{"_smartpayindex", "x"}, "reserved", nil},
+		{"jsonWrite", nil, admin, "jsonWrite", []string{"hello", `{"a":1}`}, "", nil},
+		{"jsonWrite by a user", nil, alice, "jsonWrite", []string{"hello", `{"a":1}`}, "admin", nil},
+
+		{"initSmartPay", nil, alice, "initSmartPay", []string{`{"smartPayTransID":"sp2",
+			"paymentTrans":{"paymentTransID":"p2","drawerID":"alice","payeeID":"bob","amount":10.5,"currency":"usd"},
+			"remitTrans":{"remittanceTransID":"r2","sourceID":"alice","sourceCurrency":"usd","destinationID":"carl","destinationCurrency":"inr","amount":100},
+			"lentTrans":{"lendingTransID":"l2","lendorID":"bank","borrowerID":"bob","loanAmount":1000,"currency":"usd","loanRate":5,"loanReturnDate":"2017-01-01"}}`}, "", func(t *testing.T, c *testChain) {
+			remit := c.smartPay("sp2").RemitTrans
+			if remit.ExchangeRate.String() != "65.2" || remit.DestinationAmount.String() != "6520.00 INR" {
+				t.Errorf("remittance = %v, want the published rate", remit)
+			}
+		}},
+		{"initSmartPay taken id", nil, alice, "initSmartPay", smartPayArgs(), "exists", nil},
+		{"initSmartPay short", nil, alice, "initSmartPay", smartPayArgs()[:15], "arguments", nil},
+		{"initSmartPay missing fields", nil, alice, "initSmartPay", []string{`{"smartPayTransID":"sp2","paymentTrans":{"amount":1}}`}, "paymentTrans.drawerID", nil},
+
+		{"set_note", nil, bob, "set_note", []string{"todo", "milk"}, "", nil},
+		{"set_note someone else's", func(c *testChain) { c.as(alice).mustInvoke("set_note", "todo", "milk") }, bob, "set_note", []string{"todo", "eggs"}, "belongs to alice", nil},
+		{"set_note reserved", nil, bob, "set_note", []string{"_todo", "milk"}, "reserved", nil},
+		{"delete_note", func(c *testChain) { c.as(bob).mustInvoke("set_note", "todo", "milk") }, bob, "delete_note", []string{"todo"}, "", nil},
+		{"delete_note someone else's", func(c *testChain) { c.as(alice).mustInvoke("set_note", "todo", "milk") }, bob, "delete_note", []string{"todo"}, "belongs to alice", nil},
+
+		{"create_account", nil, Caller{User: "carl"}, "create_account", []string{`{"id":"carl"}`}, "", func(t *testing.T, c *testChain) {
+			if c.balance("carl", "usd") != "0.00 USD" {
+				t.Errorf("carl has %s, want an empty account", c.balance("carl", "usd"))
+			}
+		}},
+		{"create_account taken", nil, admin, "create_account", []string{"Alice"}, "already exists", nil},
+		{"create_account for someone else", nil, bob, "create_account", []string{"carl"}, "not allowed", nil},
+
+		{"deposit", nil, funder, "deposit", []string{"alice", "20", "usd"}, "", func(t *testing.T, c *testChain) {
+			if c.balance("alice", "usd") != "20.00 USD" {
+				t.Errorf("alice has %s, want 20.00 USD", c.balance("alice", "usd"))
+			}
+		}},
+		{"deposit json", nil, admin, "deposit", []string{`{"accountID":"alice","amount":20,"currency":"usd"}`}, "", nil},
+		{"deposit by a user", nil, alice, "deposit", []string{"alice", "20", "usd"}, "deposit funds", nil},
+		{"deposit negative", nil, admin, "deposit", []string{"alice", "-1", "usd"}, "positive", nil},
+		{"deposit too precise", nil, admin, "deposit", []string{"alice", "1.005", "usd"}, "amount", nil},
+		{"deposit no account", nil, admin, "deposit", []string{"carl", "1", "usd"}, "carl", nil},
+
+		{"execute_payment", func(c *testChain) { c.fund("alice", "20", "usd") }, alice, "execute_payment", []string{"sp1"}, "", func(t *testing.T, c *testChain) {
+			if c.balance("alice", "usd") != "9.50 USD" || c.balance("bob", "usd") != "10.50 USD" {
+				t.Errorf("alice has %s and bob %s", c.balance("alice", "usd"), c.balance("bob", "usd"))
+			}
+			if c.smartPay("sp1").PaymentTrans.Status != paymentExecuted {
+				t.Error("the payment is not marked executed")
+			}
+		}},
+		{"execute_payment unfunded", nil, alice, "execute_payment", []string{"sp1"}, "insufficient", nil},
+		{"execute_payment twice", func(c *testChain) {
+			c.fund("alice", "40", "usd")
+			c.as(alice).mustInvoke("execute_payment", "sp1")
+		}, alice, "execute_payment", []string{"sp1"}, "already executed", nil},
+		{"execute_payment by the payee", func(c *testChain) { c.fund("alice", "20", "usd") }, bob, "execute_payment", []string{"sp1"}, "not allowed", nil},
+
+		{"disburse_loan", func(c *testChain) { c.fund("bank", "5000", "usd") }, bank, "disburse_loan", []string{"sp1"}, "", func(t *testing.T, c *testChain) {
+			if c.balance("bob", "usd") != "1000.00 USD" || c.balance("bank", "usd") != "4000.00 USD" {
+				t.Errorf("bob has %s and bank %s", c.balance("bob", "usd"), c.balance("bank", "usd"))
+			}
+		}},
+		{"disburse_loan unfunded", nil, bank, "disburse_loan", []string{"sp1"}, "insufficient", nil},
+		{"disburse_loan bad method", func(c *testChain) { c.fund("bank", "5000", "usd") }, bank, "disburse_loan", []string{"sp1", "banana"}, "simple or compound", nil},
+		{"disburse_loan by the borrower", func(c *testChain) { c.fund("bank", "5000", "usd") }, bob, "disburse_loan", []string{"sp1"}, "not allowed", nil},
+
+		{"repay_loan", disbursed, bob, "repay_loan", []string{`{"smartPayTransID":"sp1","amount":100}`}, "", func(t *testing.T, c *testChain) {
+			if c.balance("bob", "usd") != "900.00 USD" {
+				t.Errorf("bob has %s, want 900.00 USD", c.balance("bob", "usd"))
+			}
+		}},
+		{"repay_loan too much", func(c *testChain) {
+			disbursed(c)
+			c.fund("bob", "2000", "usd")
+		}, bob, "repay_loan", []string{"sp1", "2000"}, "more than", nil},
+		{"repay_loan by the lender", disbursed, bank, "repay_loan", []string{"sp1", "100"}, "not allowed", nil},
+		{"repay_loan not disbursed", nil, bob, "repay_loan", []string{"sp1", "100"}, "not been disbursed", nil},
+
+		{"accrue_interest", disbursed, oracle, "accrue_interest", []string{"sp1"}, "", func(t *testing.T, c *testChain) {
+			if c.smartPay("sp1").LendTrans.AccruedAt == c.smartPay("sp1").LendTrans.DisbursedAt {
+				t.Error("no interest was booked")
+			}
+		}},
+		{"accrue_interest by a user", disbursed, bob, "accrue_interest", []string{"sp1"}, "accrue interest", nil},
+		{"mark_overdue", func(c *testChain) {
+			disbursed(c)
+			c.at(time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC))
+		}, oracle, "mark_overdue", []string{"sp1"}, "", func(t *testing.T, c *testChain) {
+			if c.smartPay("sp1").LendTrans.Status != loanOverdue {
+				t.Errorf("loan status = %s, want overdue", c.smartPay("sp1").LendTrans.Status)
+			}
+		}},
+		{"mark_overdue not due", disbursed, oracle, "mark_overdue", []string{"sp1"}, "not due", nil},
+		{"mark_overdue by a user", disbursed, bank, "mark_overdue", []string{"sp1"}, "overdue", nil},
+
+		{"set_rate", nil, oracle, "set_rate", []string{`{"from":"usd","to":"inr","rate":70,"effectiveAt":"2016-08-01"}`}, "", nil},
+		{"set_rate by an admin", nil, admin, "set_rate", []string{"usd", "inr", "65"}, "oracle", nil},
+		{"set_rate backdated", nil, oracle, "set_rate", []string{"usd", "inr", "66", "2015-12-01"}, "before it is published", nil},
+		{"set_rate_tolerance", nil, admin, "set_rate_tolerance", []string{"2"}, "", nil},
+		{"set_rate_tolerance by the oracle", nil, oracle, "set_rate_tolerance", []string{"2"}, "admin", nil},
+
+		{"migrate_smartpay_index", nil, admin, "migrate_smartpay_index", nil, "", nil},
+		{"migrate_smartpay_index by a user", nil, alice, "migrate_smartpay_index", nil, "admin", nil},
+		{"migrate_keyspace", nil, admin, "migrate_keyspace", []string{`{"limit":10}`}, "", nil},
+		{"migrate_keyspace by a user", nil, alice, "migrate_keyspace", nil, "admin", nil},
+		{"migrate_keyspace bad limit", nil, admin, "migrate_keyspace", []string{`{"limit":0}`}, "limit", nil},
+
+		{"unknown function", nil, admin, "steal", nil, "unknown function", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			before := len(c.st.State)
+			_, err := c.as(tt.caller).invoke(tt.function, tt.args...)
+			if tt.err == "" && err != nil {
+				t.Fatalf("%s %q: %s", tt.function, tt.args, err)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("%s %q = %v, want an error about %q", tt.function, tt.args, err, tt.err)
+				}
+				if len(c.st.State) != before {
+					t.Fatalf("%s %q failed but changed the ledger", tt.function, tt.args)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+// disbursed - fund bank and pay sp1's loan out to bob
+func disbursed(c *testChain) {
+	c.fund("bank", "5000", "usd")
+	c.as(bank).mustInvoke("disburse_loan", "sp1")
+}
+
+// ============================================================================================================================
+// TestQuery - every query function, run against a seedChain with some history
+// ============================================================================================================================
+func TestQuery(t *testing.T) {
+	c := seedChain(t)
+	c.fund("bank", "5000", "usd")
+	c.as(bank).mustInvoke("disburse_loan", "sp1")
+	c.as(bob).mustInvoke("set_note", "todo", "milk")
+
+	var account Account
+	var loan LoanBalance
+	var rate RateEntry
+	var note Note
+	var notes []Note
+	var smartPay SmartPayTransaction
+	var page SmartPayPage
+	var report RecordReport
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		err      string          //part of the error, empty when the query must succeed
+		want     interface{}     //decode the answer into this
+		check    func() []string //problems with want, if any
+	}{
+		{"read", "read", []string{"abc"}, "", nil, nil},
+		{"read smartpay", "read", []string{"sp1"}, "", &smartPay, func() []string {
+			return expect(smartPay.SmartPayTransID == "sp1", "want sp1")
+		}},
+		{"read no name", "read", nil, "arguments", nil, nil},
+		{"validate_records", "validate_records", nil, "", &report, func() []string {
+			return expect(report.Checked == 1 && len(report.Problems) == 0, "want one clean transaction")
+		}},
+		{"balance", "balance", []string{"bob"}, "", &account, func() []string {
+			return expect(account.Balances["USD"].String() == "1000.00 USD", "bob has the loan")
+		}},
+		{"balance no account", "balance", []string{"carl"}, "carl", nil, nil},
+		{"loan_balance", "loan_balance", []string{"sp1", "2016-03-14"}, "", &loan, func() []string {
+			return expect(loan.Interest.String() == "10.00 USD" && loan.Outstanding.String() == "1010.00 USD", "73 days at 5% on 1000 is 10.00")
+		}},
+		{"loan_balance bad date", "loan_balance", []string{"sp1", "soon"}, "date", nil, nil},
+		{"get_rate", "get_rate", []string{"USD", "inr"}, "", &rate, func() []string {
+			return expect(rate.Rate.String() == "65.2" && rate.SetBy == "fx", "want the oracle's 65.2")
+		}},
+		{"get_rate before any", "get_rate", []string{"usd", "inr", "2015-12-31"}, "USD/INR", nil, nil},
+		{"get_note", "get_note", []string{"todo"}, "", &note, func() []string {
+			return expect(note.Owner == "bob" && note.Value == "milk", "want bob's todo")
+		}},
+		{"get_note missing", "get_note", []string{"nope"}, "nope", nil, nil},
+		{"notes_by_owner", "notes_by_owner", []string{"Bob"}, "", &notes, func() []string {
+			return expect(len(notes) == 1, "bob has one note")
+		}},
+		{"get_smartpay", "get_smartpay", []string{"SP1"}, "", &smartPay, func() []string {
+			return expect(smartPay.LendTrans.Status == loanDisbursed, "the loan was disbursed")
+		}},
+		{"get_smartpay missing", "get_smartpay", []string{"sp9"}, "sp9", nil, nil},
+		{"list_smartpay", "list_smartpay", nil, "", &page, func() []string {
+			return expect(len(page.Transactions) == 1, "want sp1")
+		}},
+		{"list_smartpay bad bookmark", "list_smartpay", []string{"10", "zz"}, "bookmark", nil, nil},
+		{"smartpay_by_drawer", "smartpay_by_drawer", []string{"alice"}, "", &page, func() []string {
+			return expect(len(page.Transactions) == 1, "alice drew sp1")
+		}},
+		{"smartpay_by_payee", "smartpay_by_payee", []string{"alice"}, "", &page, func() []string {
+			return expect(len(page.Transactions) == 0, "alice is paid nothing")
+		}},
+		{"smartpay_by_borrower", "smartpay_by_borrower", []string{"BOB"}, "", &page, func() []string {
+			return expect(len(page.Transactions) == 1, "bob borrowed on sp1")
+		}},
+		{"smartpay_by_lender", "smartpay_by_lender", []string{"bank"}, "", &page, func() []string {
+			return expect(len(page.Transactions) == 1, "bank lent on sp1")
+		}},
+		{"smartpay_by_currency", "smartpay_by_currency", []string{"inr"}, "", &page, func() []string {
+			return expect(len(page.Transactions) == 1, "sp1 remits in INR")
+		}},
+		{"smartpay_by_date", "smartpay_by_date", []string{"2016-01-01", "2016-01-01"}, "", &page, func() []string {
+			return expect(len(page.Transactions) == 1, "sp1 was created on the first")
+		}},
+		{"smartpay_by_date later", "smartpay_by_date", []string{"2016-01-02", "2016-12-31"}, "", &page, func() []string {
+			return expect(len(page.Transactions) == 0, "nothing was created after the first")
+		}},
+		{"unknown query", "steal", nil, "unknown function", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := c.query(tt.function, tt.args...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("%s %q = %v, want an error about %q", tt.function, tt.args, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s %q: %s", tt.function, tt.args, err)
+			}
+			if tt.want != nil {
+				err = json.Unmarshal(res, tt.want)
+				if err != nil {
+					t.Fatalf("%s %q answered %q: %s", tt.function, tt.args, res, err)
+				}
+			}
+			if tt.check != nil {
+				for _, problem := range tt.check() {
+					t.Errorf("%s %q answered %s: %s", tt.function, tt.args, res, problem)
+				}
+			}
+		})
+	}
+}
+
+// expect - problem when ok is false
+func expect(ok bool, problem string) []string {
+	if ok {
+		return nil
+	}
+	return []string{problem}
+}
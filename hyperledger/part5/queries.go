@@ -0,0 +1,299 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var defaultPageSize = 50 //transactions per page when the caller doesn't say
+var maxPageSize = 500    //keeps a single query from walking the whole ledger
+
+// SmartPayPage one page of a SmartPay listing, pass Bookmark back to get the next page
+type SmartPayPage struct {
+	Transactions []SmartPayTransaction `json:"transactions"`
+	Bookmark     string                `json:"bookmark"` //empty on the last page
+}
+
+// ============================================================================================================================
+// getSmartPay - read a SmartPay transaction, anything stored under the id that doesn't decode is an error
+// ============================================================================================================================
+func getSmartPay(stub ChaincodeState, id string) (SmartPayTransaction, error) {
+	key, err := smartPayKey(id)
+	if err != nil {
+		return SmartPayTransaction{}, err
+	}
+	smartPayAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return SmartPayTransaction{}, errors.New("Failed to get SmartPay transaction " + id)
+	}
+	if smartPayAsBytes == nil {
+		return SmartPayTransaction{}, notFound("SmartPay transaction " + id + " does not exist")
+	}
+	smartPay, err := decodeSmartPay(smartPayAsBytes)
+	if err != nil {
+		return smartPay, errors.New("SmartPay transaction " + id + " is malformed - " + err.Error())
+	}
+	if smartPay.SmartPayTransID != id {
+		return smartPay, notFound("SmartPay transaction " + id + " does not exist")
+	}
+	return smartPay, nil
+}
+
+// ============================================================================================================================
+// putSmartPay - write back a SmartPay transaction, its indexed fields must not have changed
+// ============================================================================================================================
+func putSmartPay(stub ChaincodeState, smartPay SmartPayTransaction) error {
+	key, err := smartPayKey(smartPay.SmartPayTransID)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(smartPay)
+	return stub.PutState(key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// parsePaging - read the optional limit and bookmark that trail a query's arguments
+// ============================================================================================================================
+func parsePaging(args []string) (int, string, error) {
+	limit := defaultPageSize
+	bookmark := ""
+	if len(args) > 2 {
+		return 0, "", argError("Incorrect number of arguments. Expecting at most a limit and a bookmark")
+	}
+	if len(args) > 0 && len(args[0]) > 0 {
+		var err error
+		limit, err = strconv.Atoi(args[0])
+		if err != nil || limit <= 0 {
+			return 0, "", argError("limit must be a positive numeric string")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+	if len(args) > 1 {
+		bookmark = args[1]
+	}
+	return limit, bookmark, nil
+}
+
+// ============================================================================================================================
+// pageSmartPay - read up to limit transactions from the index keys between startKey and endKey, resuming after bookmark
+// ============================================================================================================================
+func pageSmartPay(stub ChaincodeState, startKey string, endKey string, limit int, bookmark string) (SmartPayPage, error) {
+	page := SmartPayPage{Transactions: []SmartPayTransaction{}}
+
+	if bookmark != "" {
+		lastKey, err := hex.DecodeString(bookmark)
+		if err != nil || string(lastKey) < startKey || string(lastKey) > endKey {
+			return page, argError("bookmark does not belong to this query")
+		}
+		startKey = string(lastKey) + ledger.KeySeparator //smallest key after the last one we handed out
+	}
+
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return page, errors.New("Failed to scan SmartPay index")
+	}
+	defer iter.Close()
+
+	lastKey := ""
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return page, errors.New("Failed to read SmartPay index")
+		}
+		if len(page.Transactions) == limit { //there is at least one more, hand out a bookmark
+			page.Bookmark = hex.EncodeToString([]byte(lastKey))
+			break
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) == 0 {
+			continue
+		}
+
+		id := attrs[len(attrs)-1] //every SmartPay index ends with the id
+		smartPay, err := getSmartPay(stub, id)
+		lastKey = key
+		if err != nil {
+			fmt.Println("! skipping " + id + ", " + err.Error()) //index entry outlived its transaction
+			continue
+		}
+		page.Transactions = append(page.Transactions, smartPay)
+	}
+	return page, nil
+}
+
+// ============================================================================================================================
+// smartPayPageResponse - run a paged index scan and marshal the page
+// ============================================================================================================================
+func smartPayPageResponse(stub ChaincodeState, startKey string, endKey string, paging []string) ([]byte, error) {
+	limit, bookmark, err := parsePaging(paging)
+	if err != nil {
+		return nil, err
+	}
+	page, err := pageSmartPay(stub, startKey, endKey, limit, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(page)
+}
+
+// ============================================================================================================================
+// smartPayByParty - page through one of the per party or per currency indexes
+// ============================================================================================================================
+func smartPayByParty(stub ChaincodeState, indexName string, what string, args []string) ([]byte, error) {
+
+	//   0        1*      2*
+	// "alice", "10", "bookmark"
+	if len(args) < 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the " + what)
+	}
+	startKey, endKey, err := ledger.PrefixRange(indexName, []string{strings.ToLower(args[0])})
+	if err != nil {
+		return nil, err
+	}
+	return smartPayPageResponse(stub, startKey, endKey, args[1:])
+}
+
+// ============================================================================================================================
+// parseDate - read an RFC 3339 time or a plain 2006-01-02 date, a plain end date covers that whole day
+// ============================================================================================================================
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return date, nil
+	}
+	date, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return date, err
+	}
+	if endOfDay {
+		date = date.Add(24*time.Hour - time.Millisecond)
+	}
+	return date, nil
+}
+
+// ============================================================================================================================
+// Get SmartPay - read one SmartPay transaction
+// ============================================================================================================================
+func (t *SimpleChaincode) get_smartpay(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0
+	// "sp1"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the SmartPay transaction id")
+	}
+	smartPay, err := getSmartPay(stub, strings.ToLower(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(smartPay)
+}
+
+// ============================================================================================================================
+// List SmartPay - every SmartPay transaction, oldest first
+// ============================================================================================================================
+func (t *SimpleChaincode) list_smartpay(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0*      1*
+	// "10", "bookmark"
+	startKey, endKey, err := ledger.PrefixRange(createdIndexName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return smartPayPageResponse(stub, startKey, endKey, args)
+}
+
+// ============================================================================================================================
+// SmartPay By Drawer - transactions whose payment is drawn by a user
+// ============================================================================================================================
+func (t *SimpleChaincode) smartpay_by_drawer(stub ChaincodeState, args []string) ([]byte, error) {
+	return smartPayByParty(stub, drawerIndexName, "drawer", args)
+}
+
+// ============================================================================================================================
+// SmartPay By Payee - transactions whose payment goes to a user
+// ============================================================================================================================
+func (t *SimpleChaincode) smartpay_by_payee(stub ChaincodeState, args []string) ([]byte, error) {
+	return smartPayByParty(stub, payeeIndexName, "payee", args)
+}
+
+// ============================================================================================================================
+// SmartPay By Borrower - transactions whose loan is taken by a user
+// ============================================================================================================================
+func (t *SimpleChaincode) smartpay_by_borrower(stub ChaincodeState, args []string) ([]byte, error) {
+	return smartPayByParty(stub, borrowerIndexName, "borrower", args)
+}
+
+// ============================================================================================================================
+// SmartPay By Lender - transactions whose loan is made by a user
+// ============================================================================================================================
+func (t *SimpleChaincode) smartpay_by_lender(stub ChaincodeState, args []string) ([]byte, error) {
+	return smartPayByParty(stub, lenderIndexName, "lender", args)
+}
+
+// ============================================================================================================================
+// SmartPay By Currency - transactions where any leg uses a currency
+// ============================================================================================================================
+func (t *SimpleChaincode) smartpay_by_currency(stub ChaincodeState, args []string) ([]byte, error) {
+	return smartPayByParty(stub, currencyIndexName, "currency", args)
+}
+
+// ============================================================================================================================
+// SmartPay By Date - transactions created between two dates, inclusive, oldest first
+// ============================================================================================================================
+func (t *SimpleChaincode) smartpay_by_date(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//       0             1          2*      3*
+	// "2016-07-01", "2016-07-31", "10", "bookmark"
+	if len(args) < 2 {
+		return nil, argError("Incorrect number of arguments. Expecting the from and to dates")
+	}
+	from, err := parseDate(args[0], false)
+	if err != nil {
+		return nil, argError("1st argument must be a date, 2006-01-02 or RFC 3339")
+	}
+	to, err := parseDate(args[1], true)
+	if err != nil || to.Before(from) {
+		return nil, argError("2nd argument must be a date no earlier than the 1st")
+	}
+	fromMillis := ledger.UnixMillis(from)
+	if fromMillis < 0 {
+		fromMillis = 0 //nothing was created before 1970, and negative times would not sort
+	}
+	startKey, _, err := ledger.PrefixRange(createdIndexName, []string{createdAttribute(fromMillis)})
+	if err != nil {
+		return nil, err
+	}
+	_, endKey, err := ledger.PrefixRange(createdIndexName, []string{createdAttribute(ledger.UnixMillis(to))})
+	if err != nil {
+		return nil, err
+	}
+	return smartPayPageResponse(stub, startKey, endKey, args[2:])
+}
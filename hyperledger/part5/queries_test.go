@@ -0,0 +1,111 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// page - decode a SmartPayPage query
+func (c *testChain) page(function string, args ...string) SmartPayPage {
+	c.t.Helper()
+	var page SmartPayPage
+	c.mustQuery(&page, function, args...)
+	return page
+}
+
+func TestSmartPayQueries(t *testing.T) {
+	c := seedChain(t)
+	for i, id := range []string{"sp2", "sp3"} {
+		c.at(time.Date(2016, 1, 11+i*10, 12, 0, 0, 0, time.UTC))
+		args := smartPayArgs()
+		args[19] = id
+		if id == "sp2" {
+			args[1], args[16] = "dave", "eur"
+		}
+		c.mustInvoke("initSmartPay", args...)
+	}
+
+	tests := []struct {
+		function string
+		args     []string
+		want     int
+	}{
+		{"list_smartpay", nil, 3},
+		{"smartpay_by_drawer", []string{"alice"}, 2},
+		{"smartpay_by_drawer", []string{"Dave"}, 1},
+		{"smartpay_by_payee", []string{"bob"}, 3},
+		{"smartpay_by_lender", []string{"bank"}, 3},
+		{"smartpay_by_borrower", []string{"bob"}, 3},
+		{"smartpay_by_currency", []string{"eur"}, 1},
+		{"smartpay_by_currency", []string{"INR"}, 3},
+		{"smartpay_by_date", []string{"2016-01-01", "2016-01-11"}, 2},
+		{"smartpay_by_date", []string{"2016-01-12", "2016-02-01"}, 1},
+	}
+	for _, tt := range tests {
+		if got := len(c.page(tt.function, tt.args...).Transactions); got != tt.want {
+			t.Errorf("%s %q = %d transactions, want %d", tt.function, tt.args, got, tt.want)
+		}
+	}
+
+	first := c.page("list_smartpay", "2")
+	if len(first.Transactions) != 2 || first.Bookmark == "" {
+		t.Fatalf("first page = %v, want two and a bookmark", first)
+	}
+	if last := c.page("list_smartpay", "2", first.Bookmark); len(last.Transactions) != 1 || last.Bookmark != "" {
+		t.Fatalf("last page = %v, want the third", last)
+	}
+
+	c.mustInvoke("delete", "sp2")
+	if got := len(c.page("smartpay_by_currency", "eur").Transactions); got != 0 {
+		t.Fatalf("%d EUR transactions after sp2 was deleted", got)
+	}
+}
+
+func TestMigrateSmartPayIndex(t *testing.T) {
+	c := seedChain(t)
+	args := smartPayArgs()
+	args[19] = "sp3"
+	c.mustInvoke("initSmartPay", args...)
+	for key := range c.st.State { //drop every index entry, as if the transactions predate them
+		if objectType, _, err := ledger.SplitCompositeKey(key); err == nil && strings.HasPrefix(objectType, smartPayNamespace+"~") {
+			delete(c.st.State, key)
+		}
+	}
+	if got := len(c.page("list_smartpay").Transactions); got != 0 {
+		t.Fatalf("%d transactions listed before the migration", got)
+	}
+	key, _ := ledger.SystemKey(smartPayIndexStr)
+	c.st.State[key] = []byte(`["sp1","sp3","gone"]`)
+
+	if res := c.mustInvoke("migrate_smartpay_index"); string(res) != "2" {
+		t.Fatalf("migrate_smartpay_index = %s, want 2", res)
+	}
+	if got := len(c.page("list_smartpay").Transactions); got != 2 {
+		t.Fatalf("%d transactions listed after the migration, want 2", got)
+	}
+	if string(c.st.State[key]) != `["gone"]` {
+		t.Fatalf("legacy index = %s, want only what could not be migrated", c.st.State[key])
+	}
+}
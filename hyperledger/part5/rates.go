@@ -0,0 +1,312 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var rateIndexName = "rate~from~to~effective" //one entry per published rate, sorted by when it takes effect
+var configObject = "config"                  //config~<name> holds a chaincode setting
+var rateToleranceSetting = "rate_tolerance"  //how far a caller's exchange rate may stray from the registry, in percent
+
+var defaultRateTolerance = Rate(100000000) //1 percent, used until an admin sets one
+
+// RateEntry an exchange rate published by an oracle
+type RateEntry struct {
+	From        string `json:"from"` //ISO 4217 codes
+	To          string `json:"to"`
+	Rate        Rate   `json:"rate"`        //units of To per unit of From
+	EffectiveAt int64  `json:"effectiveAt"` //utc ms, the rate applies from here until the next entry
+	SetBy       string `json:"setBy"`
+	TxID        string `json:"txID"`
+}
+
+// ============================================================================================================================
+// currencyPair - normalize both sides of a currency pair
+// ============================================================================================================================
+func currencyPair(from string, to string) (string, string, error) {
+	fromCode, _, err := normalizeCurrency(from)
+	if err != nil {
+		return "", "", err
+	}
+	toCode, _, err := normalizeCurrency(to)
+	if err != nil {
+		return "", "", err
+	}
+	return fromCode, toCode, nil
+}
+
+// ============================================================================================================================
+// lookupRate - the rate for a currency pair in effect at asOf, nil if none was published by then
+// ============================================================================================================================
+func lookupRate(stub ChaincodeState, from string, to string, asOf time.Time) (*RateEntry, error) {
+	startKey, _, err := ledger.PrefixRange(rateIndexName, []string{from, to})
+	if err != nil {
+		return nil, err
+	}
+	_, endKey, err := ledger.PrefixRange(rateIndexName, []string{from, to, createdAttribute(ledger.UnixMillis(asOf))})
+	if err != nil {
+		return nil, err
+	}
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return nil, errors.New("Failed to scan exchange rates")
+	}
+	defer iter.Close()
+
+	var entry *RateEntry
+	for iter.HasNext() { //ascending, so the last one is the rate in effect
+		_, entryAsBytes, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read exchange rates")
+		}
+		var next RateEntry
+		if json.Unmarshal(entryAsBytes, &next) != nil {
+			continue
+		}
+		entry = &next
+	}
+	return entry, nil
+}
+
+// ============================================================================================================================
+// rateTolerance - the configured tolerance for caller supplied exchange rates, in percent
+// ============================================================================================================================
+func rateTolerance(stub ChaincodeState) (Rate, error) {
+	key, err := ledger.CreateCompositeKey(configObject, []string{rateToleranceSetting})
+	if err != nil {
+		return 0, err
+	}
+	toleranceAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return 0, errors.New("Failed to get rate tolerance")
+	}
+	if toleranceAsBytes == nil {
+		return defaultRateTolerance, nil
+	}
+	var tolerance Rate
+	err = json.Unmarshal(toleranceAsBytes, &tolerance)
+	if err != nil {
+		return 0, errors.New("rate tolerance is malformed - " + err.Error())
+	}
+	return tolerance, nil
+}
+
+// ============================================================================================================================
+// withinTolerance - true if rate is no more than tolerance percent away from reference
+// ============================================================================================================================
+func withinTolerance(rate Rate, reference Rate, tolerance Rate) bool {
+	//|rate - reference| * 100 * 10^rateDigits <= reference * tolerance, all in integers
+	diff := new(big.Int).Sub(big.NewInt(int64(rate)), big.NewInt(int64(reference)))
+	diff.Abs(diff)
+	diff.Mul(diff, new(big.Int).Mul(big.NewInt(100), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(rateDigits)), nil)))
+	limit := new(big.Int).Mul(big.NewInt(int64(reference)), big.NewInt(int64(tolerance)))
+	return diff.Cmp(limit) <= 0
+}
+
+// ============================================================================================================================
+// remittanceRate - settle the exchange rate for a remittance, a caller rate must agree with the registry
+// ============================================================================================================================
+func remittanceRate(stub ChaincodeState, from string, to string, callerRate string) (Rate, int64, error) {
+	if from == to {
+		one := Rate(100000000)
+		if callerRate != "" {
+			rate, err := ParseRate(callerRate)
+			if err != nil || rate != one {
+				return 0, 0, argError("a remittance within " + from + " must use a rate of 1")
+			}
+		}
+		return one, 0, nil
+	}
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return 0, 0, errors.New("Failed to get transaction timestamp")
+	}
+	entry, err := lookupRate(stub, from, to, txTime)
+	if err != nil {
+		return 0, 0, err
+	}
+	if entry == nil {
+		return 0, 0, notFound("no " + from + "/" + to + " exchange rate has been published")
+	}
+	if callerRate == "" {
+		return entry.Rate, entry.EffectiveAt, nil
+	}
+
+	rate, err := ParseRate(callerRate)
+	if err != nil || rate <= 0 {
+		return 0, 0, argError("exchange rate must be a positive decimal")
+	}
+	tolerance, err := rateTolerance(stub)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !withinTolerance(rate, entry.Rate, tolerance) {
+		return 0, 0, argError("exchange rate " + rate.String() + " is more than " + tolerance.String() + "% away from the published " + from + "/" + to + " rate " + entry.Rate.String())
+	}
+	return rate, entry.EffectiveAt, nil
+}
+
+// ============================================================================================================================
+// Set Rate - publish an exchange rate, oracle only
+// ============================================================================================================================
+func (t *SimpleChaincode) set_rate(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &SetRateRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0      1       2            3*
+	// "usd", "inr", "65.2", "2016-07-01T00:00:00Z"
+	if len(args) < 3 || len(args) > 4 {
+		return nil, argError("Incorrect number of arguments. Expecting 3 or 4")
+	}
+	err = t.requireRole(stub, oracleRole, "publish exchange rates")
+	if err != nil {
+		return nil, err
+	}
+	who, err := t.caller(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, err := currencyPair(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return nil, argError("1st and 2nd arguments must be different currencies")
+	}
+	rate, err := ParseRate(args[2])
+	if err != nil || rate <= 0 {
+		return nil, argError("3rd argument must be a positive decimal rate")
+	}
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+	effective := txTime
+	if len(args) == 4 && len(args[3]) > 0 {
+		effective, err = parseDate(args[3], false)
+		if err != nil {
+			return nil, argError("4th argument must be a date, 2006-01-02 or RFC 3339")
+		}
+		if effective.Before(txTime) { //remittances already priced off the old rate must stay reproducible
+			return nil, argError("a rate cannot take effect before it is published")
+		}
+	}
+
+	entry := RateEntry{
+		From:        from,
+		To:          to,
+		Rate:        rate,
+		EffectiveAt: ledger.UnixMillis(effective),
+		SetBy:       who.User,
+		TxID:        stub.GetTxID(),
+	}
+	key, err := ledger.CreateCompositeKey(rateIndexName, []string{from, to, createdAttribute(entry.EffectiveAt)})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- set rate " + from + "/" + to + " " + rate.String())
+	jsonAsBytes, _ := json.Marshal(entry)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set Rate Tolerance - how far, in percent, a caller's exchange rate may be from the published one, admin only
+// ============================================================================================================================
+func (t *SimpleChaincode) set_rate_tolerance(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &RateToleranceRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "0.5"
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting 1")
+	}
+	err = t.requireRole(stub, adminRole, "change the rate tolerance")
+	if err != nil {
+		return nil, err
+	}
+	tolerance, err := ParseRate(args[0])
+	if err != nil || tolerance < 0 {
+		return nil, argError("1st argument must be a non-negative percentage")
+	}
+	key, err := ledger.CreateCompositeKey(configObject, []string{rateToleranceSetting})
+	if err != nil {
+		return nil, err
+	}
+	jsonAsBytes, _ := json.Marshal(tolerance)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Get Rate - the exchange rate in effect for a currency pair at a date, or at this transaction
+// ============================================================================================================================
+func (t *SimpleChaincode) get_rate(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0      1          2*
+	// "usd", "inr", "2016-07-01"
+	if len(args) < 2 || len(args) > 3 {
+		return nil, argError("Incorrect number of arguments. Expecting the two currencies and optionally a date")
+	}
+	from, to, err := currencyPair(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	var asOf time.Time
+	if len(args) == 3 {
+		asOf, err = parseDate(args[2], true)
+		if err != nil {
+			return nil, argError("3rd argument must be a date, 2006-01-02 or RFC 3339")
+		}
+	} else {
+		asOf, err = stub.GetTxTime()
+		if err != nil {
+			return nil, argError("No transaction timestamp, pass the date to look the rate up at")
+		}
+	}
+	entry, err := lookupRate(stub, from, to, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, notFound("no " + from + "/" + to + " exchange rate in effect at " + asOf.Format(time.RFC3339))
+	}
+	return json.Marshal(entry)
+}
@@ -0,0 +1,115 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateHistory(t *testing.T) {
+	c := seedChain(t)
+	c.as(oracle).mustInvoke("set_rate", `{"from":"usd","to":"inr","rate":70,"effectiveAt":"2016-08-01"}`)
+
+	tests := []struct {
+		args []string
+		want string //empty when there is no rate
+	}{
+		{[]string{"usd", "inr"}, "65.2"},
+		{[]string{"USD", "INR", "2016-07-31"}, "65.2"},
+		{[]string{"usd", "inr", "2016-08-01"}, "70"},
+		{[]string{"usd", "inr", "2015-12-31"}, ""},
+		{[]string{"inr", "usd"}, ""},
+	}
+	for _, tt := range tests {
+		res, err := c.query("get_rate", tt.args...)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("get_rate %q = %s, want no rate", tt.args, res)
+			}
+			continue
+		}
+		var rate RateEntry
+		c.mustQuery(&rate, "get_rate", tt.args...)
+		if rate.Rate.String() != tt.want || rate.SetBy != "fx" {
+			t.Errorf("get_rate %q = %s, want %s set by fx", tt.args, res, tt.want)
+		}
+	}
+}
+
+func TestRemittanceRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  string
+		rate      string //the caller's rate, empty uses the published one
+		tolerance string //set_rate_tolerance first, empty keeps the default 1%
+		want      string //what carl receives
+		err       string //part of the error, empty when it must succeed
+	}{
+		{"published", "usd", "inr", "", "", "6520.00 INR", ""},
+		{"within 1%", "usd", "inr", "65.5", "", "6550.00 INR", ""},
+		{"outside 1%", "usd", "inr", "66", "", "", "more than 1% away"},
+		{"within a wider tolerance", "usd", "inr", "66", "2", "6600.00 INR", ""},
+		{"no published rate", "eur", "gbp", "", "", "", "EUR/GBP"},
+		{"same currency", "eur", "eur", "", "", "100.00 EUR", ""},
+		{"same currency at a rate", "eur", "eur", "1.01", "", "", "EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			if tt.tolerance != "" {
+				c.as(admin).mustInvoke("set_rate_tolerance", tt.tolerance)
+			}
+			args := smartPayArgs()
+			args[7], args[9], args[11], args[19] = tt.from, tt.to, tt.rate, "sp2"
+			_, err := c.as(alice).invoke("initSmartPay", args...)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("initSmartPay = %v, want an error about %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.smartPay("sp2").RemitTrans.DestinationAmount.String(); got != tt.want {
+				t.Fatalf("carl receives %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateChangesApplyFromWhenTheyTakeEffect(t *testing.T) {
+	c := seedChain(t)
+	c.as(oracle).mustInvoke("set_rate", "usd", "inr", "70", "2016-01-02")
+	args := smartPayArgs()
+	args[11], args[19] = "", "sp2"
+	c.as(alice).mustInvoke("initSmartPay", args...)
+	if remit := c.smartPay("sp2").RemitTrans; remit.ExchangeRate.String() != "65.2" {
+		t.Fatalf("rate = %s before the new one takes effect", remit.ExchangeRate)
+	}
+	c.at(time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC))
+	args[19] = "sp3"
+	c.as(alice).mustInvoke("initSmartPay", args...)
+	if remit := c.smartPay("sp3").RemitTrans; remit.ExchangeRate.String() != "70" || remit.DestinationAmount.String() != "7000.00 INR" {
+		t.Fatalf("remittance = %v after the new rate took effect", remit)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// RecordProblem a stored record that failed validation
+type RecordProblem struct {
+	Key     string `json:"key"`
+	Problem string `json:"problem"`
+}
+
+// RecordReport the result of validate_records
+type RecordReport struct {
+	Checked  int             `json:"checked"`
+	Problems []RecordProblem `json:"problems"`
+}
+
+// ============================================================================================================================
+// decodeSmartPay - unmarshal a stored SmartPay transaction and check every field is filled in
+// ============================================================================================================================
+func decodeSmartPay(smartPayAsBytes []byte) (SmartPayTransaction, error) {
+	var smartPay SmartPayTransaction
+	if smartPayAsBytes == nil {
+		return smartPay, errors.New("record is missing")
+	}
+	err := json.Unmarshal(smartPayAsBytes, &smartPay)
+	if err != nil {
+		return smartPay, errors.New("record is not valid JSON: " + err.Error())
+	}
+
+	var v ValidationError
+	v.requireString("smartPayTransID", smartPay.SmartPayTransID)
+	v.requireString("paymentTrans.paymentTransID", smartPay.PaymentTrans.PaymentTransID)
+	v.requireString("paymentTrans.drawerID", smartPay.PaymentTrans.DrawerID)
+	v.requireString("paymentTrans.payeeID", smartPay.PaymentTrans.PayeeID)
+	v.requireMoney("paymentTrans.amount", smartPay.PaymentTrans.Amount)
+	v.requireString("remitTrans.remittanceTransID", smartPay.RemitTrans.RemittanceTransID)
+	v.requireString("remitTrans.sourceID", smartPay.RemitTrans.SourceID)
+	v.requireString("remitTrans.destinationID", smartPay.RemitTrans.DestinationID)
+	v.requireString("remitTrans.destinationCurrency", smartPay.RemitTrans.DestinationCurrency)
+	v.requireMoney("remitTrans.amount", smartPay.RemitTrans.Amount)
+	v.requireString("lentTrans.lendingTransID", smartPay.LendTrans.LendingTransID)
+	v.requireString("lentTrans.lendorID", smartPay.LendTrans.LendorID)
+	v.requireString("lentTrans.borrowerID", smartPay.LendTrans.BorrowerID)
+	v.requireMoney("lentTrans.loanAmount", smartPay.LendTrans.LoanAmount)
+	v.requireString("lentTrans.loanReturnDate", smartPay.LendTrans.LoanReturnDate)
+	if len(v) > 0 {
+		return smartPay, v
+	}
+	return smartPay, nil
+}
+
+// ============================================================================================================================
+// requireMoney - note an amount that isn't positive or isn't in a supported currency
+// ============================================================================================================================
+func (v *ValidationError) requireMoney(field string, value Money) {
+	_, _, err := normalizeCurrency(value.Currency)
+	if err != nil || value.Currency != strings.ToUpper(value.Currency) {
+		*v = append(*v, FieldError{field + ".currency", "must be a supported ISO 4217 code"})
+	}
+	if value.Units <= 0 {
+		*v = append(*v, FieldError{field + ".units", "must be positive"})
+	}
+}
+
+// ============================================================================================================================
+// checkSmartPay - decode one stored SmartPay transaction into the report
+// ============================================================================================================================
+func (report *RecordReport) checkSmartPay(id string, smartPayAsBytes []byte) {
+	report.Checked++
+	smartPay, err := decodeSmartPay(smartPayAsBytes)
+	if err == nil && smartPay.SmartPayTransID != id {
+		err = errors.New("record is stored under the wrong id " + smartPay.SmartPayTransID)
+	}
+	if err != nil {
+		report.Problems = append(report.Problems, RecordProblem{Key: id, Problem: err.Error()})
+	}
+}
+
+// ============================================================================================================================
+// Validate Records - decode every stored SmartPay transaction and report the ones that are malformed
+// ============================================================================================================================
+// Ids still listed in the legacy _smartpayindex are checked too, migrate_smartpay_index leaves the ones that don't decode.
+func (t *SimpleChaincode) validate_records(stub ChaincodeState, args []string) ([]byte, error) {
+	report := RecordReport{Problems: []RecordProblem{}}
+
+	startKey, endKey, err := ledger.PrefixRange(smartPayNamespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return nil, errors.New("Failed to scan SmartPay transactions")
+	}
+	defer iter.Close()
+
+	seen := make(map[string]bool)
+	for iter.HasNext() {
+		key, smartPayAsBytes, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read SmartPay transactions")
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 1 {
+			continue
+		}
+		seen[attrs[0]] = true
+		report.checkSmartPay(attrs[0], smartPayAsBytes)
+	}
+
+	smartPayIndex, err := getSmartPayIndex(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range smartPayIndex {
+		if seen[id] {
+			continue
+		}
+		key, err := smartPayKey(id)
+		if err != nil {
+			report.Problems = append(report.Problems, RecordProblem{Key: id, Problem: err.Error()})
+			continue
+		}
+		smartPayAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return nil, errors.New("Failed to get SmartPay transaction " + id)
+		}
+		report.checkSmartPay(id, smartPayAsBytes)
+	}
+	return json.Marshal(report)
+}
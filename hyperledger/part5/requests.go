@@ -0,0 +1,443 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// Every invoke accepts either its positional string arguments or a single JSON object matching one of the
+// request structs below. A JSON request is validated field by field and then handed to the handler in the
+// positional form, so both forms go through the same code.
+
+// FieldError what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError every problem found in a request
+type ValidationError []FieldError
+
+// the ledger.RequestError each handler failure is reported as, the same ones the marbles chaincode uses
+var argError = ledger.ArgError //400, the arguments are missing, extra or malformed
+var denied = ledger.Denied     //403, the caller is not allowed to do this
+var notFound = ledger.NotFound //404, the account, transaction, rate or note it names does not exist
+var conflict = ledger.Conflict //409, it clashes with the ledger, like a loan that was already disbursed
+
+// request a typed invoke argument
+type request interface {
+	validate() ValidationError
+	args() []string //the positional form the handler expects
+}
+
+// InitRequest arguments for init
+type InitRequest struct {
+	Value *int `json:"value"` //test value stored under "abc"
+}
+
+// NameRequest arguments for delete and delete_note
+type NameRequest struct {
+	Name string `json:"name"`
+}
+
+// WriteRequest arguments for write, jsonWrite and set_note
+type WriteRequest struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PaymentRequest the payment leg of initSmartPay
+type PaymentRequest struct {
+	PaymentTransID string      `json:"paymentTransID"`
+	DrawerID       string      `json:"drawerID"`
+	PayeeID        string      `json:"payeeID"`
+	Amount         json.Number `json:"amount"`
+	Currency       string      `json:"currency"`
+}
+
+// RemittanceRequest the remittance leg of initSmartPay
+type RemittanceRequest struct {
+	RemittanceTransID   string      `json:"remittanceTransID"`
+	SourceID            string      `json:"sourceID"`
+	SourceCurrency      string      `json:"sourceCurrency"`
+	DestinationID       string      `json:"destinationID"`
+	DestinationCurrency string      `json:"destinationCurrency"`
+	Amount              json.Number `json:"amount"`
+	ExchangeRate        json.Number `json:"ExchangeRate"` //optional, the published rate is used when left out
+}
+
+// LendingRequest the lending leg of initSmartPay
+type LendingRequest struct {
+	LendingTransID string      `json:"lendingTransID"`
+	LendorID       string      `json:"lendorID"`
+	BorrowerID     string      `json:"borrowerID"`
+	LoanAmount     json.Number `json:"loanAmount"`
+	Currency       string      `json:"currency"`
+	LoanRate       json.Number `json:"loanRate"`
+	LoanReturnDate string      `json:"loanReturnDate"`
+}
+
+// SmartPayRequest arguments for initSmartPay, same field names as the stored SmartPayTransaction
+type SmartPayRequest struct {
+	SmartPayTransID string            `json:"smartPayTransID"`
+	PaymentTrans    PaymentRequest    `json:"paymentTrans"`
+	RemitTrans      RemittanceRequest `json:"remitTrans"`
+	LendTrans       LendingRequest    `json:"lentTrans"`
+}
+
+// CreateAccountRequest arguments for create_account
+type CreateAccountRequest struct {
+	ID string `json:"id"`
+}
+
+// DepositRequest arguments for deposit
+type DepositRequest struct {
+	AccountID string      `json:"accountID"`
+	Amount    json.Number `json:"amount"`
+	Currency  string      `json:"currency"`
+}
+
+// ExecutePaymentRequest arguments for execute_payment
+type ExecutePaymentRequest struct {
+	SmartPayTransID string `json:"smartPayTransID"`
+}
+
+// DisburseLoanRequest arguments for disburse_loan
+type DisburseLoanRequest struct {
+	SmartPayTransID string `json:"smartPayTransID"`
+	InterestMethod  string `json:"interestMethod"` //optional, simple by default
+	DayCount        string `json:"dayCount"`       //optional, act/365 by default
+}
+
+// RepayLoanRequest arguments for repay_loan
+type RepayLoanRequest struct {
+	SmartPayTransID string      `json:"smartPayTransID"`
+	Amount          json.Number `json:"amount"` //in the loan's currency
+}
+
+// LoanRequest arguments for accrue_interest and mark_overdue
+type LoanRequest struct {
+	SmartPayTransID string `json:"smartPayTransID"`
+}
+
+// SetRateRequest arguments for set_rate
+type SetRateRequest struct {
+	From        string      `json:"from"`
+	To          string      `json:"to"`
+	Rate        json.Number `json:"rate"`
+	EffectiveAt string      `json:"effectiveAt"` //optional, takes effect straight away by default
+}
+
+// RateToleranceRequest arguments for set_rate_tolerance
+type RateToleranceRequest struct {
+	Percent json.Number `json:"percent"`
+}
+
+// ResetRequest arguments for reset
+type ResetRequest struct {
+	Confirm string `json:"confirm"` //must be "RESET"
+	Limit   *int   `json:"limit"`   //optional, most keys deleted in one call
+}
+
+// PageRequest arguments for migrate_keyspace, which works through the ledger a page at a time
+type PageRequest struct {
+	Limit    *int   `json:"limit"`    //optional, most keys looked at in one call
+	Bookmark string `json:"bookmark"` //optional, from the previous call
+}
+
+// MigrateRequest arguments for migrate_smartpay_index, they take none
+type MigrateRequest struct{}
+
+// ============================================================================================================================
+// Error - list every field problem in one message
+// ============================================================================================================================
+func (v ValidationError) Error() string {
+	var problems []string
+	for _, e := range v {
+		problems = append(problems, e.Field+": "+e.Message)
+	}
+	return "Invalid request - " + strings.Join(problems, "; ")
+}
+
+// ============================================================================================================================
+// requireString - note a missing string field
+// ============================================================================================================================
+func (v *ValidationError) requireString(field string, value string) {
+	if len(strings.TrimSpace(value)) <= 0 {
+		*v = append(*v, FieldError{field, "must be a non-empty string"})
+	}
+}
+
+// ============================================================================================================================
+// requireNumber - note a missing numeric field, numbers are kept as written so amounts are never rounded through a float
+// ============================================================================================================================
+func (v *ValidationError) requireNumber(field string, value json.Number) {
+	if value == "" {
+		*v = append(*v, FieldError{field, "is required"})
+	}
+}
+
+// ============================================================================================================================
+// requireLimit - note a page size that is given but not positive
+// ============================================================================================================================
+func (v *ValidationError) requireLimit(field string, value *int) {
+	if value != nil && *value <= 0 {
+		*v = append(*v, FieldError{field, "must be a positive number"})
+	}
+}
+
+// ============================================================================================================================
+// limitArgs - the optional page size in positional form, nothing when it wasn't given
+// ============================================================================================================================
+func limitArgs(limit *int) []string {
+	if limit == nil {
+		return nil
+	}
+	return []string{strconv.Itoa(*limit)}
+}
+
+// ============================================================================================================================
+// requestArgs - turn a single JSON object argument into the positional args, anything else is positional
+// ============================================================================================================================
+func requestArgs(args []string, req request) ([]string, error) {
+	if len(args) != 1 || !isJSONObject(args[0]) {
+		return args, nil //so an id starting with "{" can still be given positionally
+	}
+	decoder := json.NewDecoder(strings.NewReader(args[0]))
+	decoder.DisallowUnknownFields() //a misspelt field is an error, not a silently missing value
+	err := decoder.Decode(req)
+	if err != nil {
+		return nil, ValidationError{{"request", "does not match the request: " + err.Error()}}
+	}
+	problems := req.validate()
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return req.args(), nil
+}
+
+// ============================================================================================================================
+// isJSONObject - true when arg is one whole JSON object and nothing else
+// ============================================================================================================================
+func isJSONObject(arg string) bool {
+	arg = strings.TrimSpace(arg)
+	return strings.HasPrefix(arg, "{") && json.Valid([]byte(arg))
+}
+
+func (r *InitRequest) validate() ValidationError {
+	var v ValidationError
+	if r.Value == nil {
+		v = append(v, FieldError{"value", "is required"})
+	}
+	return v
+}
+
+func (r *InitRequest) args() []string {
+	if r.Value == nil {
+		return []string{""}
+	}
+	return []string{strconv.Itoa(*r.Value)}
+}
+
+func (r *NameRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("name", r.Name)
+	return v
+}
+
+func (r *NameRequest) args() []string {
+	return []string{r.Name}
+}
+
+func (r *WriteRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("name", r.Name)
+	return v
+}
+
+func (r *WriteRequest) args() []string {
+	return []string{r.Name, r.Value}
+}
+
+func (r *SmartPayRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("smartPayTransID", r.SmartPayTransID)
+
+	p := r.PaymentTrans
+	v.requireString("paymentTrans.paymentTransID", p.PaymentTransID)
+	v.requireString("paymentTrans.drawerID", p.DrawerID)
+	v.requireString("paymentTrans.payeeID", p.PayeeID)
+	v.requireNumber("paymentTrans.amount", p.Amount)
+	v.requireString("paymentTrans.currency", p.Currency)
+
+	m := r.RemitTrans
+	v.requireString("remitTrans.remittanceTransID", m.RemittanceTransID)
+	v.requireString("remitTrans.sourceID", m.SourceID)
+	v.requireString("remitTrans.sourceCurrency", m.SourceCurrency)
+	v.requireString("remitTrans.destinationID", m.DestinationID)
+	v.requireString("remitTrans.destinationCurrency", m.DestinationCurrency)
+	v.requireNumber("remitTrans.amount", m.Amount)
+
+	l := r.LendTrans
+	v.requireString("lentTrans.lendingTransID", l.LendingTransID)
+	v.requireString("lentTrans.lendorID", l.LendorID)
+	v.requireString("lentTrans.borrowerID", l.BorrowerID)
+	v.requireNumber("lentTrans.loanAmount", l.LoanAmount)
+	v.requireString("lentTrans.currency", l.Currency)
+	v.requireNumber("lentTrans.loanRate", l.LoanRate)
+	v.requireString("lentTrans.loanReturnDate", l.LoanReturnDate)
+	return v
+}
+
+func (r *SmartPayRequest) args() []string {
+	p, m, l := r.PaymentTrans, r.RemitTrans, r.LendTrans
+	return []string{
+		p.PaymentTransID, p.DrawerID, p.PayeeID, p.Amount.String(), p.Currency,
+		m.RemittanceTransID, m.SourceID, m.SourceCurrency, m.DestinationID, m.DestinationCurrency, m.Amount.String(), m.ExchangeRate.String(),
+		l.LendingTransID, l.LendorID, l.BorrowerID, l.LoanAmount.String(), l.Currency, l.LoanRate.String(), l.LoanReturnDate,
+		r.SmartPayTransID,
+	}
+}
+
+func (r *CreateAccountRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("id", r.ID)
+	return v
+}
+
+func (r *CreateAccountRequest) args() []string {
+	return []string{r.ID}
+}
+
+func (r *DepositRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("accountID", r.AccountID)
+	v.requireNumber("amount", r.Amount)
+	v.requireString("currency", r.Currency)
+	return v
+}
+
+func (r *DepositRequest) args() []string {
+	return []string{r.AccountID, r.Amount.String(), r.Currency}
+}
+
+func (r *ExecutePaymentRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("smartPayTransID", r.SmartPayTransID)
+	return v
+}
+
+func (r *ExecutePaymentRequest) args() []string {
+	return []string{r.SmartPayTransID}
+}
+
+func (r *DisburseLoanRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("smartPayTransID", r.SmartPayTransID)
+	return v
+}
+
+func (r *DisburseLoanRequest) args() []string {
+	return []string{r.SmartPayTransID, r.InterestMethod, r.DayCount}
+}
+
+func (r *RepayLoanRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("smartPayTransID", r.SmartPayTransID)
+	v.requireNumber("amount", r.Amount)
+	return v
+}
+
+func (r *RepayLoanRequest) args() []string {
+	return []string{r.SmartPayTransID, r.Amount.String()}
+}
+
+func (r *LoanRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("smartPayTransID", r.SmartPayTransID)
+	return v
+}
+
+func (r *LoanRequest) args() []string {
+	return []string{r.SmartPayTransID}
+}
+
+func (r *SetRateRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("from", r.From)
+	v.requireString("to", r.To)
+	v.requireNumber("rate", r.Rate)
+	return v
+}
+
+func (r *SetRateRequest) args() []string {
+	return []string{r.From, r.To, r.Rate.String(), r.EffectiveAt}
+}
+
+func (r *RateToleranceRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireNumber("percent", r.Percent)
+	return v
+}
+
+func (r *RateToleranceRequest) args() []string {
+	return []string{r.Percent.String()}
+}
+
+func (r *ResetRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("confirm", r.Confirm)
+	v.requireLimit("limit", r.Limit)
+	return v
+}
+
+func (r *ResetRequest) args() []string {
+	return append([]string{r.Confirm}, limitArgs(r.Limit)...)
+}
+
+func (r *PageRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireLimit("limit", r.Limit)
+	return v
+}
+
+func (r *PageRequest) args() []string {
+	if r.Bookmark == "" {
+		return limitArgs(r.Limit)
+	}
+	limit := "" //parsePaging reads an empty limit as the default page size
+	if r.Limit != nil {
+		limit = strconv.Itoa(*r.Limit)
+	}
+	return []string{limit, r.Bookmark}
+}
+
+func (r *MigrateRequest) validate() ValidationError {
+	return nil
+}
+
+func (r *MigrateRequest) args() []string {
+	return nil
+}
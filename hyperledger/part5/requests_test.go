@@ -0,0 +1,135 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+func TestRequestArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    request
+		args   []string
+		want   []string //positional form, when the request is valid
+		fields []string //fields reported, when it isn't
+	}{
+		{"positional passes through", &DepositRequest{}, []string{"alice", "1", "usd"}, []string{"alice", "1", "usd"}, nil},
+		{"not json is positional", &DepositRequest{}, []string{`{"accountID":`}, []string{`{"accountID":`}, nil},
+		{"unknown field", &DepositRequest{}, []string{`{"account":"a1"}`}, nil, []string{"request"}},
+		{"init", &InitRequest{}, []string{`{"value":5}`}, []string{"5"}, nil},
+		{"init value", &InitRequest{}, []string{`{}`}, nil, []string{"value"}},
+		{"name", &NameRequest{}, []string{`{"name":"sp1"}`}, []string{"sp1"}, nil},
+		{"write", &WriteRequest{}, []string{`{"name":"k","value":""}`}, []string{"k", ""}, nil},
+		{"write name", &WriteRequest{}, []string{`{"value":"v"}`}, nil, []string{"name"}},
+		{"initSmartPay", &SmartPayRequest{}, []string{`{"smartPayTransID":"sp1",
+			"paymentTrans":{"paymentTransID":"p1","drawerID":"alice","payeeID":"bob","amount":10.50,"currency":"usd"},
+			"remitTrans":{"remittanceTransID":"r1","sourceID":"alice","sourceCurrency":"usd","destinationID":"carl","destinationCurrency":"inr","amount":100,"ExchangeRate":65.2},
+			"lentTrans":{"lendingTransID":"l1","lendorID":"bank","borrowerID":"bob","loanAmount":1000,"currency":"usd","loanRate":5,"loanReturnDate":"2017-01-01"}}`},
+			smartPayArgs(), nil},
+		{"initSmartPay every leg", &SmartPayRequest{}, []string{`{"smartPayTransID":"sp1","paymentTrans":{"paymentTransID":"p1","drawerID":"alice","payeeID":"bob","currency":"usd"},
+			"remitTrans":{"remittanceTransID":"r1","sourceID":"alice","sourceCurrency":"usd","destinationID":"carl","destinationCurrency":"inr"},
+			"lentTrans":{"lendingTransID":"l1","lendorID":"bank","borrowerID":"bob","loanAmount":1000,"currency":"usd","loanRate":5}}`},
+			nil, []string{"paymentTrans.amount", "remitTrans.amount", "lentTrans.loanReturnDate"}},
+		{"create_account", &CreateAccountRequest{}, []string{`{"id":"alice"}`}, []string{"alice"}, nil},
+		{"deposit", &DepositRequest{}, []string{`{"accountID":"alice","amount":20.00,"currency":"usd"}`}, []string{"alice", "20.00", "usd"}, nil},
+		{"deposit every field", &DepositRequest{}, []string{`{}`}, nil, []string{"accountID", "amount", "currency"}},
+		{"execute_payment", &ExecutePaymentRequest{}, []string{`{"smartPayTransID":"sp1"}`}, []string{"sp1"}, nil},
+		{"disburse_loan", &DisburseLoanRequest{}, []string{`{"smartPayTransID":"sp1","interestMethod":"compound"}`}, []string{"sp1", "compound", ""}, nil},
+		{"repay_loan", &RepayLoanRequest{}, []string{`{"smartPayTransID":"sp1","amount":110}`}, []string{"sp1", "110"}, nil},
+		{"repay_loan not a number", &RepayLoanRequest{}, []string{`{"smartPayTransID":"sp1","amount":"lots"}`}, nil, []string{"request"}},
+		{"repay_loan amount", &RepayLoanRequest{}, []string{`{"smartPayTransID":"sp1"}`}, nil, []string{"amount"}},
+		{"mark_overdue", &LoanRequest{}, []string{`{"smartPayTransID":"sp1"}`}, []string{"sp1"}, nil},
+		{"set_rate", &SetRateRequest{}, []string{`{"from":"usd","to":"inr","rate":65.2}`}, []string{"usd", "inr", "65.2", ""}, nil},
+		{"set_rate rate", &SetRateRequest{}, []string{`{"from":"usd","to":"inr"}`}, nil, []string{"rate"}},
+		{"set_rate_tolerance", &RateToleranceRequest{}, []string{`{"percent":2}`}, []string{"2"}, nil},
+		{"reset", &ResetRequest{}, []string{`{"confirm":"RESET","limit":10}`}, []string{"RESET", "10"}, nil},
+		{"reset limit", &ResetRequest{}, []string{`{"confirm":"RESET","limit":0}`}, nil, []string{"limit"}},
+		{"page", &PageRequest{}, []string{`{"limit":10}`}, []string{"10"}, nil},
+		{"page bookmark", &PageRequest{}, []string{`{"bookmark":"ab"}`}, []string{"", "ab"}, nil},
+		{"migrate", &MigrateRequest{}, []string{`{}`}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := requestArgs(tt.args, tt.req)
+			if tt.fields == nil {
+				if err != nil || !reflect.DeepEqual(args, tt.want) {
+					t.Fatalf("requestArgs(%q) = %q, %v, want %q", tt.args, args, err, tt.want)
+				}
+				return
+			}
+			problems, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("requestArgs(%q) = %q, %v, want a ValidationError", tt.args, args, err)
+			}
+			var fields []string
+			for _, problem := range problems {
+				fields = append(fields, problem.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Fatalf("requestArgs(%q) reported %q, want %q: %s", tt.args, fields, tt.fields, err)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   Caller
+		function string
+		args     []string
+		query    bool
+		want     int
+	}{
+		{"short arguments", alice, "initSmartPay", smartPayArgs()[:15], false, 400},
+		{"unknown invoke", alice, "nope", nil, false, 400},
+		{"bad limit", alice, "list_smartpay", []string{"many"}, true, 400},
+		{"dates out of order", alice, "smartpay_by_date", []string{"2016-02-01", "2016-01-01"}, true, 400},
+		{"reset by a user", alice, "reset", []string{"RESET"}, false, 403},
+		{"deposit by a user", alice, "deposit", []string{"alice", "1", "usd"}, false, 403},
+		{"someone else's payment", bob, "execute_payment", []string{"sp1"}, false, 403},
+		{"missing account", admin, "deposit", []string{"carl", "1", "usd"}, false, 404},
+		{"missing transaction", alice, "get_smartpay", []string{"sp9"}, true, 404},
+		{"missing note", alice, "get_note", []string{"todo"}, true, 404},
+		{"unpublished rate", alice, "get_rate", []string{"usd", "eur"}, true, 404},
+		{"taken account", admin, "create_account", []string{"alice"}, false, 409},
+		{"taken transaction", alice, "initSmartPay", smartPayArgs(), false, 409},
+		{"insufficient funds", alice, "execute_payment", []string{"sp1"}, false, 409},
+		{"loan not disbursed", bob, "repay_loan", []string{"sp1", "10"}, false, 409},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			var err error
+			if tt.query {
+				_, err = c.as(tt.caller).query(tt.function, tt.args...)
+			} else {
+				_, err = c.as(tt.caller).invoke(tt.function, tt.args...)
+			}
+			if got := ledger.ErrorStatus(err); err == nil || got != tt.want {
+				t.Fatalf("%s %q = %v, status %d, want %d", tt.function, tt.args, err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// ResetReport what one reset call deleted
+type ResetReport = ledger.ResetReport
+
+// every namespace and index the chaincode writes, reset clears them in this order, then the notes and values
+// ledger/reset.go clears for every chaincode. Add new ones here.
+var resetObjectTypes = []string{
+	drawerIndexName, payeeIndexName, borrowerIndexName, lenderIndexName, currencyIndexName, createdIndexName, smartPayNamespace,
+	accountObject, rateIndexName, configObject,
+}
+
+// ============================================================================================================================
+// Reset - delete every transaction, account, rate, setting, note and value the chaincode stored, admin only, a page at a time
+// ============================================================================================================================
+// Keys written before migrate_keyspace other than _smartpayindex are left alone, migrate first.
+func (t *SimpleChaincode) reset(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &ResetRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireRole(stub, adminRole, "reset the chaincode")
+	if err != nil {
+		return nil, err
+	}
+
+	//    0       1*
+	// "RESET", "100"
+	if len(args) < 1 || len(args) > 2 {
+		return nil, argError("Incorrect number of arguments. Expecting the confirmation and optionally a limit")
+	}
+	limit, _, err := parsePaging(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	report, err := ledger.Reset(stub, args[0], resetObjectTypes, []string{smartPayIndexStr}, limit) //the index still on its flat key
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- reset deleted " + strconv.Itoa(report.Deleted) + " keys")
+	err = t.auditRaw(stub, chaincodeResetEvent)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(report)
+}
@@ -0,0 +1,175 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Batch buffers writes in front of a ChaincodeState so a multi step change can be validated first and then
+// committed together. Reads through the batch see the buffered writes, GetState and RangeQueryState alike, which
+// also gives read-your-writes on peers that don't have it, such as Fabric 1.x.
+type Batch struct {
+	ChaincodeState
+	values  map[string][]byte //pending value per key, nil means delete
+	changed []string          //keys in the order they were first touched, keeps commit deterministic
+}
+
+// batchIterator merges a ledger range with the writes a Batch held for it when the scan started
+type batchIterator struct {
+	ledger  StateIterator
+	pending []string          //buffered keys in the range, sorted, deletes left out
+	values  map[string][]byte //what the batch held for every key in the range, deletes included
+	key     string            //next ledger key not shadowed by the batch, valid while ahead is set
+	value   []byte
+	ahead   bool
+	err     error
+}
+
+// ============================================================================================================================
+// NewBatch - start buffering writes for stub
+// ============================================================================================================================
+func NewBatch(stub ChaincodeState) *Batch {
+	return &Batch{ChaincodeState: stub, values: make(map[string][]byte)}
+}
+
+// ============================================================================================================================
+// GetState - read a key, pending writes win over the ledger
+// ============================================================================================================================
+func (b *Batch) GetState(key string) ([]byte, error) {
+	if value, ok := b.values[key]; ok {
+		return value, nil
+	}
+	return b.ChaincodeState.GetState(key)
+}
+
+// ============================================================================================================================
+// RangeQueryState - scan the keys between startKey and endKey, inclusive, pending writes win over the ledger
+// ============================================================================================================================
+func (b *Batch) RangeQueryState(startKey, endKey string) (StateIterator, error) {
+	iter, err := b.ChaincodeState.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	merged := &batchIterator{ledger: iter, values: make(map[string][]byte)}
+	for key, value := range b.values {
+		if key < startKey || key > endKey {
+			continue
+		}
+		merged.values[key] = value
+		if value != nil {
+			merged.pending = append(merged.pending, key)
+		}
+	}
+	sort.Strings(merged.pending)
+	return merged, nil
+}
+
+// ============================================================================================================================
+// PutState - buffer a write
+// ============================================================================================================================
+func (b *Batch) PutState(key string, value []byte) error {
+	b.touch(key)
+	b.values[key] = value
+	return nil
+}
+
+// ============================================================================================================================
+// DelState - buffer a delete
+// ============================================================================================================================
+func (b *Batch) DelState(key string) error {
+	b.touch(key)
+	b.values[key] = nil
+	return nil
+}
+
+// ============================================================================================================================
+// touch - remember the first time a key is written
+// ============================================================================================================================
+func (b *Batch) touch(key string) {
+	if _, ok := b.values[key]; !ok {
+		b.changed = append(b.changed, key)
+	}
+}
+
+// ============================================================================================================================
+// Commit - flush the buffered writes to the ledger
+// ============================================================================================================================
+func (b *Batch) Commit() error {
+	var err error
+	for _, key := range b.changed {
+		if b.values[key] == nil {
+			err = b.ChaincodeState.DelState(key)
+		} else {
+			err = b.ChaincodeState.PutState(key, b.values[key])
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to commit %s: %s", key, err) //the peer drops the whole tx when we return an error
+		}
+	}
+	b.values = make(map[string][]byte)
+	b.changed = nil
+	return nil
+}
+
+// ============================================================================================================================
+// HasNext - true while either the ledger or the batch has keys left
+// ============================================================================================================================
+func (i *batchIterator) HasNext() bool {
+	for !i.ahead && i.err == nil && i.ledger.HasNext() {
+		key, value, err := i.ledger.Next()
+		if err != nil {
+			i.err = err
+		} else if _, buffered := i.values[key]; !buffered { //the batch's copy, or its delete, comes from pending
+			i.key, i.value, i.ahead = key, value, true
+		}
+	}
+	return i.ahead || i.err != nil || len(i.pending) > 0
+}
+
+// ============================================================================================================================
+// Next - return the next key/value pair, in key order across the ledger and the batch
+// ============================================================================================================================
+func (i *batchIterator) Next() (string, []byte, error) {
+	if !i.HasNext() {
+		return "", nil, errors.New("no more results in range")
+	}
+	if len(i.pending) > 0 && (!i.ahead || i.pending[0] < i.key) {
+		key := i.pending[0]
+		i.pending = i.pending[1:]
+		return key, i.values[key], nil
+	}
+	if i.err != nil {
+		err := i.err
+		i.err = nil
+		return "", nil, err
+	}
+	i.ahead = false
+	return i.key, i.value, nil
+}
+
+// ============================================================================================================================
+// Close - release the ledger iterator
+// ============================================================================================================================
+func (i *batchIterator) Close() error {
+	return i.ledger.Close()
+}
@@ -0,0 +1,119 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// failingState a MemState whose writes fail for one key
+type failingState struct {
+	*MemState
+	badKey string
+}
+
+func (f failingState) PutState(key string, value []byte) error {
+	if key == f.badKey {
+		return errors.New("disk full")
+	}
+	return f.MemState.PutState(key, value)
+}
+
+func TestBatchReadsItsOwnWrites(t *testing.T) {
+	m := NewMemState()
+	m.PutState("a", []byte("1"))
+	m.PutState("b", []byte("2"))
+	b := NewBatch(m)
+
+	b.PutState("a", []byte("10"))
+	b.DelState("b")
+	b.PutState("c", []byte("3"))
+	tests := []struct {
+		key, batch, ledger string
+	}{
+		{"a", "10", "1"},
+		{"b", "", "2"},
+		{"c", "3", ""},
+	}
+	for _, tt := range tests {
+		if value, _ := b.GetState(tt.key); string(value) != tt.batch {
+			t.Errorf("batch %s = %q, want %q", tt.key, value, tt.batch)
+		}
+		if value, _ := m.GetState(tt.key); string(value) != tt.ledger {
+			t.Errorf("ledger %s = %q before commit, want %q", tt.key, value, tt.ledger)
+		}
+	}
+
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{"a": []byte("10"), "c": []byte("3")}
+	if !reflect.DeepEqual(m.State, want) {
+		t.Fatalf("ledger after commit = %q, want %q", m.State, want)
+	}
+	if err := b.Commit(); err != nil || !reflect.DeepEqual(m.State, want) {
+		t.Fatalf("second commit = %v, ledger %q", err, m.State)
+	}
+}
+
+func TestBatchRangeQueryStateMergesWrites(t *testing.T) {
+	m := NewMemState()
+	for _, key := range []string{"b", "d", "f", "h"} {
+		m.PutState(key, []byte("ledger"))
+	}
+	b := NewBatch(m)
+	b.PutState("a", []byte("new"))     //before every ledger key
+	b.PutState("d", []byte("changed")) //shadows a ledger key
+	b.DelState("f")                    //hides one
+	b.PutState("g", []byte("new"))     //between two
+	b.PutState("z", []byte("new"))     //outside the range scanned below
+
+	keys, values := scan(t, b, "a", "h")
+	wantKeys := []string{"a", "b", "d", "g", "h"}
+	wantValues := []string{"new", "ledger", "changed", "new", "ledger"}
+	if !reflect.DeepEqual(keys, wantKeys) || !reflect.DeepEqual(values, wantValues) {
+		t.Fatalf("merged range = %q %q, want %q %q", keys, values, wantKeys, wantValues)
+	}
+
+	iter, _ := b.RangeQueryState("a", "h")
+	b.PutState("c", []byte("late")) //written after the scan started, it is not seen
+	n := 0
+	for iter.HasNext() {
+		if key, _, _ := iter.Next(); key == "c" {
+			t.Fatal("scan saw a write made after it started")
+		}
+		n++
+	}
+	if n != len(wantKeys) {
+		t.Fatalf("scan returned %d keys, want %d", n, len(wantKeys))
+	}
+}
+
+func TestBatchCommitError(t *testing.T) {
+	m := NewMemState()
+	b := NewBatch(failingState{MemState: m, badKey: "b"})
+	b.PutState("a", []byte("1"))
+	b.PutState("b", []byte("2"))
+	if err := b.Commit(); err == nil {
+		t.Fatal("commit hid the failed write")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+// statuses a RequestError carries, the same numbers as HTTP
+const (
+	StatusBadRequest = 400 //the caller got the request wrong
+	StatusForbidden  = 403 //the caller is not allowed to make it
+	StatusNotFound   = 404 //what it names does not exist
+	StatusConflict   = 409 //it clashes with what is already on the ledger
+	StatusError      = 500 //anything else
+)
+
+// RequestError a request the caller got wrong or may not make, as opposed to a failure reading or writing the ledger
+type RequestError struct {
+	Status  int //one of the statuses above
+	Message string
+}
+
+// ============================================================================================================================
+// Error - the message the handler gave
+// ============================================================================================================================
+func (e RequestError) Error() string {
+	return e.Message
+}
+
+// ============================================================================================================================
+// ArgError - the arguments are missing, extra, malformed or no longer hold, like an expired trade
+// ============================================================================================================================
+func ArgError(message string) error {
+	return RequestError{Status: StatusBadRequest, Message: message}
+}
+
+// ============================================================================================================================
+// Denied - the caller is not allowed to do this
+// ============================================================================================================================
+func Denied(message string) error {
+	return RequestError{Status: StatusForbidden, Message: message}
+}
+
+// ============================================================================================================================
+// NotFound - the record the request names does not exist
+// ============================================================================================================================
+func NotFound(message string) error {
+	return RequestError{Status: StatusNotFound, Message: message}
+}
+
+// ============================================================================================================================
+// Conflict - the request clashes with what is on the ledger, like an id that is taken
+// ============================================================================================================================
+func Conflict(message string) error {
+	return RequestError{Status: StatusConflict, Message: message}
+}
+
+// ============================================================================================================================
+// ErrorStatus - the status a RequestError carries, StatusError for any other failure
+// ============================================================================================================================
+func ErrorStatus(err error) int {
+	if e, ok := err.(RequestError); ok {
+		return e.Status
+	}
+	return StatusError
+}
@@ -0,0 +1,43 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import "encoding/json"
+
+// audit event names both chaincodes raise, listeners subscribe to these instead of polling the ledger
+const StateWrittenEvent = "state_written"     //an admin wrote a value through one of the raw write functions
+const StateDeletedEvent = "state_deleted"     //an admin deleted something through delete
+const ChaincodeResetEvent = "chaincode_reset" //an admin ran reset, sent once per call
+
+// AuditPayload what the raw state and reset events carry, who used write, delete or reset and on which names
+type AuditPayload struct {
+	TxID string   `json:"tx_id"`
+	By   string   `json:"by"`
+	Keys []string `json:"keys,omitempty"`
+}
+
+// ============================================================================================================================
+// Audit - raise an audit event naming who and the names they wrote or deleted
+// ============================================================================================================================
+func Audit(stub ChaincodeState, name string, who Caller, keys ...string) error {
+	payload := AuditPayload{TxID: stub.GetTxID(), By: who.User, Keys: keys}
+	jsonAsBytes, _ := json.Marshal(payload)
+	return stub.SetEvent(name, jsonAsBytes)
+}
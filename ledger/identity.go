@@ -0,0 +1,147 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// certificate attributes and the role every chaincode knows about
+const (
+	UserAttribute = "username" //certificate attribute holding the user name
+	RoleAttribute = "role"     //certificate attribute holding the caller's role
+	AdminRole     = "admin"    //role allowed to act on anyone's records and change settings
+)
+
+// Caller who submitted the transaction
+type Caller struct {
+	User string `json:"user"`
+	Role string `json:"role"`
+}
+
+// CallerResolver works out the Caller from the stub, the chaincodes take one so tests can fake the caller
+type CallerResolver func(stub ChaincodeState) (Caller, error)
+
+// ============================================================================================================================
+// ResolveCaller - resolve the identity of whoever submitted this transaction, from the certificate unless resolve is set
+// ============================================================================================================================
+func ResolveCaller(stub ChaincodeState, resolve CallerResolver) (Caller, error) {
+	if resolve != nil {
+		return resolve(stub)
+	}
+	return CertCaller(stub)
+}
+
+// ============================================================================================================================
+// CertCaller - read the caller from the transaction certificate, attributes first then the certificate's common name
+// ============================================================================================================================
+func CertCaller(stub ChaincodeState) (Caller, error) {
+	var who Caller
+
+	user, err := stub.ReadCertAttribute(UserAttribute)
+	if err == nil && len(user) > 0 {
+		who.User = string(user)
+	} else {
+		certAsBytes, err := stub.GetCallerCertificate()
+		if err != nil || len(certAsBytes) == 0 {
+			return who, errors.New("Failed to get caller certificate")
+		}
+		if block, _ := pem.Decode(certAsBytes); block != nil { //accept both PEM and raw DER
+			certAsBytes = block.Bytes
+		}
+		cert, err := x509.ParseCertificate(certAsBytes)
+		if err != nil {
+			return who, fmt.Errorf("Failed to parse caller certificate: %s", err)
+		}
+		who.User = cert.Subject.CommonName
+	}
+
+	role, err := stub.ReadCertAttribute(RoleAttribute) //no role attribute just means a regular user
+	if err == nil {
+		who.Role = string(role)
+	}
+
+	who.User = strings.ToLower(strings.TrimSpace(who.User))
+	who.Role = strings.ToLower(strings.TrimSpace(who.Role))
+	if who.User == "" {
+		return who, errors.New("Caller certificate does not name a user")
+	}
+	return who, nil
+}
+
+// ============================================================================================================================
+// IsAdmin - true if the caller holds the admin role
+// ============================================================================================================================
+func (c Caller) IsAdmin() bool {
+	return c.Role == AdminRole
+}
+
+// ============================================================================================================================
+// HasRole - true if the caller holds one of roles
+// ============================================================================================================================
+func (c Caller) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// ActsFor - true if the caller is user or an admin
+// ============================================================================================================================
+func (c Caller) ActsFor(user string) bool {
+	return c.IsAdmin() || c.User == strings.ToLower(user)
+}
+
+// ============================================================================================================================
+// Authorize - make sure the caller may act on something belonging to user
+// ============================================================================================================================
+func Authorize(stub ChaincodeState, resolve CallerResolver, user string, action string) error {
+	who, err := ResolveCaller(stub, resolve)
+	if err != nil {
+		return err
+	}
+	if !who.ActsFor(user) {
+		fmt.Println("! " + who.User + " tried to " + action + " for " + user)
+		return Denied(who.User + " is not allowed to " + action + " for " + user)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// RequireRoles - make sure the caller holds one of roles
+// ============================================================================================================================
+func RequireRoles(stub ChaincodeState, resolve CallerResolver, action string, roles ...string) error {
+	who, err := ResolveCaller(stub, resolve)
+	if err != nil {
+		return err
+	}
+	if !who.HasRole(roles...) {
+		fmt.Println("! " + who.User + " tried to " + action)
+		return Denied("only an " + strings.Join(roles, " or ") + " can " + action)
+	}
+	return nil
+}
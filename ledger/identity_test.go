@@ -0,0 +1,113 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func selfSigned(t *testing.T, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCertCaller(t *testing.T) {
+	der := selfSigned(t, " Bob ")
+	tests := []struct {
+		name       string
+		cert       []byte
+		attributes map[string]string
+		want       Caller
+		wantErr    bool
+	}{
+		{"attributes", nil, map[string]string{UserAttribute: "Amy", RoleAttribute: "Admin "}, Caller{User: "amy", Role: "admin"}, false},
+		{"der common name", der, nil, Caller{User: "bob"}, false},
+		{"pem common name", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), map[string]string{RoleAttribute: "oracle"}, Caller{User: "bob", Role: "oracle"}, false},
+		{"no certificate", nil, nil, Caller{}, true},
+		{"not a certificate", []byte("bob"), nil, Caller{}, true},
+		{"blank user", nil, map[string]string{UserAttribute: "  "}, Caller{}, true},
+	}
+	for _, tt := range tests {
+		stub := NewMemState()
+		stub.Cert = tt.cert
+		for name, value := range tt.attributes {
+			stub.Attributes[name] = []byte(value)
+		}
+		got, err := CertCaller(stub)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCallerChecks(t *testing.T) {
+	stub := NewMemState()
+	as := func(who Caller) CallerResolver {
+		return func(ChaincodeState) (Caller, error) { return who, nil }
+	}
+	bob := as(Caller{User: "bob"})
+	admin := as(Caller{User: "root", Role: AdminRole})
+	oracle := as(Caller{User: "feed", Role: "oracle"})
+
+	if err := Authorize(stub, bob, "Bob", "open a trade"); err != nil {
+		t.Errorf("bob acting for himself: %s", err)
+	}
+	if err := Authorize(stub, admin, "bob", "open a trade"); err != nil {
+		t.Errorf("admin acting for bob: %s", err)
+	}
+	if err := Authorize(stub, bob, "amy", "open a trade"); ErrorStatus(err) != StatusForbidden {
+		t.Errorf("bob acting for amy = %v, want a 403", err)
+	}
+	if err := RequireRoles(stub, oracle, "publish a rate", AdminRole, "oracle"); err != nil {
+		t.Errorf("oracle publishing a rate: %s", err)
+	}
+	err := RequireRoles(stub, bob, "publish a rate", AdminRole, "oracle")
+	if ErrorStatus(err) != StatusForbidden || err.Error() != "only an admin or oracle can publish a rate" {
+		t.Errorf("bob publishing a rate = %v, want a 403", err)
+	}
+	if _, err := ResolveCaller(stub, nil); err == nil {
+		t.Error("no resolver and no certificate should fail")
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Both chaincodes store every record under a typed key, <namespace>~<name>, built here, so a record, one of the
+// chaincode's own documents and a value from write can share a name without overwriting each other. Index keys use
+// the same layout, their index name is the namespace.
+const KeySeparator = "\x00"       //separates the parts of a composite key, can't show up in names
+const MaxKeySuffix = "\U0010FFFF" //sorts after anything that can follow a key prefix
+const ReservedPrefix = "_"        //names starting with this belong to the chaincode
+const SystemNamespace = "system"  //system~<name> holds the chaincode's own documents, e.g. the legacy _marbleindex
+const UserNamespace = "kv"        //kv~<key> holds whatever write was given
+
+// IndexValue what every index key holds, index keys carry all their data in the key
+var IndexValue = []byte{0x00}
+
+// KeyMigration what one migrate_keyspace call did
+type KeyMigration struct {
+	Moved     int      `json:"moved"`
+	Conflicts []string `json:"conflicts"`          //flat keys left where they are because their typed key is already taken
+	Bookmark  string   `json:"bookmark,omitempty"` //pass back to carry on, empty once every flat key has been looked at
+}
+
+// ============================================================================================================================
+// CreateCompositeKey - join an index name and its attributes into one ledger key
+// ============================================================================================================================
+func CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	key := KeySeparator + objectType + KeySeparator //leading separator keeps index keys away from flat names
+	for _, attr := range attributes {
+		if strings.Contains(attr, KeySeparator) {
+			return "", errors.New("key attribute " + strconv.Quote(attr) + " contains a reserved character")
+		}
+		key += attr + KeySeparator
+	}
+	return key, nil
+}
+
+// ============================================================================================================================
+// SplitCompositeKey - break a composite key back into its index name and attributes
+// ============================================================================================================================
+func SplitCompositeKey(key string) (string, []string, error) {
+	if !strings.HasPrefix(key, KeySeparator) || !strings.HasSuffix(key, KeySeparator) {
+		return "", nil, errors.New("not a composite key " + strconv.Quote(key))
+	}
+	parts := strings.Split(key[1:len(key)-1], KeySeparator)
+	return parts[0], parts[1:], nil
+}
+
+// ============================================================================================================================
+// PrefixRange - start and end keys covering every key of an index that starts with attributes
+// ============================================================================================================================
+func PrefixRange(objectType string, attributes []string) (string, string, error) {
+	prefix, err := CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return "", "", err
+	}
+	return prefix, prefix + MaxKeySuffix, nil
+}
+
+// ============================================================================================================================
+// ScanIndex - iterate over every key that starts with the given index name and leading attributes
+// ============================================================================================================================
+func ScanIndex(stub ChaincodeState, objectType string, attributes []string) (StateIterator, error) {
+	startKey, endKey, err := PrefixRange(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return stub.RangeQueryState(startKey, endKey)
+}
+
+// ============================================================================================================================
+// SystemKey - the key one of the chaincode's own documents is stored under
+// ============================================================================================================================
+func SystemKey(name string) (string, error) {
+	return CreateCompositeKey(SystemNamespace, []string{name})
+}
+
+// ============================================================================================================================
+// UserKey - the key a value from write is stored under
+// ============================================================================================================================
+func UserKey(name string) (string, error) {
+	return CreateCompositeKey(UserNamespace, []string{name})
+}
+
+// ============================================================================================================================
+// CheckName - refuse names a caller may not pick, reserved ones and ones that can't be part of a key
+// ============================================================================================================================
+func CheckName(what string, name string) error {
+	if len(name) <= 0 {
+		return ArgError(what + " must be a non-empty string")
+	}
+	if strings.HasPrefix(name, ReservedPrefix) {
+		return ArgError(what + " " + strconv.Quote(name) + " is reserved, names starting with " + ReservedPrefix + " belong to the chaincode")
+	}
+	if strings.Contains(name, KeySeparator) || strings.Contains(name, MaxKeySuffix) {
+		return ArgError(what + " " + strconv.Quote(name) + " contains a reserved character")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// WriteKey - the key write stores a caller's value under, reserved names are refused
+// ============================================================================================================================
+func WriteKey(name string) (string, error) {
+	err := CheckName("name", name)
+	if err != nil {
+		return "", err
+	}
+	return UserKey(name)
+}
+
+// ============================================================================================================================
+// GetSystemDoc - read one of the chaincode's documents, from its typed key or, before migrate_keyspace, its flat one
+// ============================================================================================================================
+func GetSystemDoc(stub ChaincodeState, name string) (string, []byte, error) {
+	key, err := SystemKey(name)
+	if err != nil {
+		return "", nil, err
+	}
+	docAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return "", nil, errors.New("Failed to get " + name)
+	}
+	if docAsBytes != nil {
+		return key, docAsBytes, nil
+	}
+	docAsBytes, err = stub.GetState(name)
+	if err != nil {
+		return "", nil, errors.New("Failed to get " + name)
+	}
+	return name, docAsBytes, nil
+}
+
+// ============================================================================================================================
+// MigrateKeyspace - move up to limit records stored under flat keys to the typed key target picks for each
+// ============================================================================================================================
+// Composite keys all start with KeySeparator, so every key from KeySeparator+1 up is a flat one. Run it until it
+// hands back no bookmark. Conflicts are reported, not overwritten.
+func MigrateKeyspace(stub ChaincodeState, limit int, bookmark string, target func(key string, value []byte) (string, error)) (KeyMigration, error) {
+	report := KeyMigration{Conflicts: []string{}}
+	startKey := "\x01"
+	if bookmark != "" {
+		lastKey, err := hex.DecodeString(bookmark)
+		if err != nil || len(lastKey) == 0 {
+			return report, ArgError("bookmark does not belong to this query")
+		}
+		startKey = string(lastKey) + KeySeparator //smallest key after the last one we looked at
+	}
+	iter, err := stub.RangeQueryState(startKey, MaxKeySuffix)
+	if err != nil {
+		return report, errors.New("Failed to scan flat keys")
+	}
+	defer iter.Close()
+
+	looked := 0
+	lastKey := ""
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return report, errors.New("Failed to read flat keys")
+		}
+		if looked == limit { //there is at least one more, hand out a bookmark
+			report.Bookmark = hex.EncodeToString([]byte(lastKey))
+			break
+		}
+		looked++
+		lastKey = key
+
+		typed, err := target(key, value)
+		if err != nil {
+			report.Conflicts = append(report.Conflicts, key) //can't be expressed as a typed key
+			continue
+		}
+		existing, err := stub.GetState(typed)
+		if err != nil {
+			return report, errors.New("Failed to get " + strconv.Quote(typed))
+		}
+		if existing != nil {
+			report.Conflicts = append(report.Conflicts, key)
+			continue
+		}
+		err = stub.PutState(typed, value)
+		if err != nil {
+			return report, err
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return report, err
+		}
+		report.Moved++
+	}
+	fmt.Println("- migrated " + strconv.Itoa(report.Moved) + " flat keys")
+	return report, nil
+}
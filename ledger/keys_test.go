@@ -0,0 +1,130 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompositeKeys(t *testing.T) {
+	key, err := CreateCompositeKey("owner~name", []string{"bob", "m1"})
+	if err != nil || key != "\x00owner~name\x00bob\x00m1\x00" {
+		t.Fatalf("CreateCompositeKey = %q, %v", key, err)
+	}
+	objectType, attrs, err := SplitCompositeKey(key)
+	if err != nil || objectType != "owner~name" || !reflect.DeepEqual(attrs, []string{"bob", "m1"}) {
+		t.Fatalf("SplitCompositeKey(%q) = %q, %q, %v", key, objectType, attrs, err)
+	}
+	if _, err := CreateCompositeKey("name", []string{"a\x00b"}); err == nil {
+		t.Error("an attribute holding the separator was accepted")
+	}
+	if _, _, err := SplitCompositeKey("m1"); err == nil {
+		t.Error("a flat key split")
+	}
+
+	m := NewMemState()
+	for _, key := range []string{"\x00name\x00bo\x00", "\x00name\x00bob\x00m1\x00", "\x00name\x00bob\x00m2\x00", "\x00names\x00bob\x00"} {
+		m.PutState(key, []byte{0})
+	}
+	iter, err := ScanIndex(m, "name", []string{"bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Close()
+	var found []string
+	for iter.HasNext() {
+		key, _, _ := iter.Next()
+		_, attrs, _ := SplitCompositeKey(key)
+		found = append(found, attrs[1])
+	}
+	if !reflect.DeepEqual(found, []string{"m1", "m2"}) {
+		t.Fatalf("ScanIndex(name, bob) found %q", found)
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"m1", true},
+		{"{x", true},
+		{"", false},
+		{"_marbleindex", false},
+		{"a\x00b", false},
+		{"a" + MaxKeySuffix, false},
+	}
+	for _, tt := range tests {
+		err := CheckName("name", tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckName(%q) = %v", tt.name, err)
+		}
+		if err != nil && ErrorStatus(err) != StatusBadRequest {
+			t.Errorf("CheckName(%q) status %d", tt.name, ErrorStatus(err))
+		}
+	}
+}
+
+func TestGetSystemDoc(t *testing.T) {
+	m := NewMemState()
+	m.PutState("_index", []byte("flat"))
+	if key, doc, err := GetSystemDoc(m, "_index"); err != nil || key != "_index" || string(doc) != "flat" {
+		t.Fatalf("before migrating = %q, %q, %v", key, doc, err)
+	}
+	typed, _ := SystemKey("_index")
+	m.PutState(typed, []byte("typed"))
+	if key, doc, err := GetSystemDoc(m, "_index"); err != nil || key != typed || string(doc) != "typed" {
+		t.Fatalf("after migrating = %q, %q, %v", key, doc, err)
+	}
+}
+
+func TestMigrateKeyspacePages(t *testing.T) {
+	m := NewMemState()
+	taken, _ := UserKey("b")
+	m.PutState(taken, []byte("already there"))
+	for _, key := range []string{"a", "b", "c"} {
+		m.PutState(key, []byte(key))
+	}
+	var reports []KeyMigration
+	bookmark := ""
+	for {
+		report, err := MigrateKeyspace(m, 2, bookmark, func(key string, value []byte) (string, error) { return UserKey(key) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports = append(reports, report)
+		if bookmark = report.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	if len(reports) != 2 || reports[0].Moved != 1 || !reflect.DeepEqual(reports[0].Conflicts, []string{"b"}) || reports[1].Moved != 1 {
+		t.Fatalf("reports = %+v", reports)
+	}
+	if value, _ := m.GetState("b"); string(value) != "b" {
+		t.Error("the conflicting flat key was overwritten or dropped")
+	}
+	if value, _ := m.GetState("c"); value != nil {
+		t.Error("c was not moved")
+	}
+	if _, err := MigrateKeyspace(m, 2, "zz", nil); ErrorStatus(err) != StatusBadRequest {
+		t.Errorf("a bad bookmark = %v", err)
+	}
+}
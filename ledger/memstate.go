@@ -0,0 +1,167 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// MemState in-memory ChaincodeState so the handlers can be run without a peer
+type MemState struct {
+	State      map[string][]byte
+	Cert       []byte            //what GetCallerCertificate hands back
+	Attributes map[string][]byte //what ReadCertAttribute hands back
+	TxID       string            //what GetTxID hands back
+	TxTime     time.Time         //what GetTxTime hands back, must be set before anything reads it
+	Events     []ChaincodeEvent  //everything passed to SetEvent, oldest first
+}
+
+// memIterator iterates over a snapshot of the keys in a range
+type memIterator struct {
+	keys   []string
+	values [][]byte
+	pos    int
+}
+
+// ============================================================================================================================
+// NewMemState - create an empty in-memory state
+// ============================================================================================================================
+func NewMemState() *MemState {
+	return &MemState{State: make(map[string][]byte), Attributes: make(map[string][]byte)}
+}
+
+// ============================================================================================================================
+// GetState - return the value for key, nil if it was never written
+// ============================================================================================================================
+func (m *MemState) GetState(key string) ([]byte, error) {
+	value, ok := m.State[key]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), value...), nil //hand out a copy so callers can't edit the ledger in place
+}
+
+// ============================================================================================================================
+// PutState - write value to key
+// ============================================================================================================================
+func (m *MemState) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	m.State[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// ============================================================================================================================
+// DelState - remove key, deleting a missing key is not an error
+// ============================================================================================================================
+func (m *MemState) DelState(key string) error {
+	delete(m.State, key)
+	return nil
+}
+
+// ============================================================================================================================
+// RangeQueryState - iterate over the keys between startKey and endKey (inclusive) in lexical order
+// ============================================================================================================================
+func (m *MemState) RangeQueryState(startKey, endKey string) (StateIterator, error) {
+	iter := &memIterator{}
+	for key := range m.State {
+		if key >= startKey && key <= endKey {
+			iter.keys = append(iter.keys, key)
+		}
+	}
+	sort.Strings(iter.keys)
+	for _, key := range iter.keys {
+		iter.values = append(iter.values, append([]byte(nil), m.State[key]...))
+	}
+	return iter, nil
+}
+
+// ============================================================================================================================
+// GetCallerCertificate - return the fake caller certificate
+// ============================================================================================================================
+func (m *MemState) GetCallerCertificate() ([]byte, error) {
+	return m.Cert, nil
+}
+
+// ============================================================================================================================
+// ReadCertAttribute - return a fake certificate attribute
+// ============================================================================================================================
+func (m *MemState) ReadCertAttribute(attributeName string) ([]byte, error) {
+	value, ok := m.Attributes[attributeName]
+	if !ok {
+		return nil, errors.New("attribute " + attributeName + " not found")
+	}
+	return value, nil
+}
+
+// ============================================================================================================================
+// GetTxID - return the fake transaction id
+// ============================================================================================================================
+func (m *MemState) GetTxID() string {
+	return m.TxID
+}
+
+// ============================================================================================================================
+// GetTxTime - return the fake transaction timestamp
+// ============================================================================================================================
+func (m *MemState) GetTxTime() (time.Time, error) {
+	if m.TxTime.IsZero() {
+		return m.TxTime, errors.New("no transaction timestamp set")
+	}
+	return m.TxTime, nil
+}
+
+// ============================================================================================================================
+// SetEvent - remember an event, the peer only keeps the last one per transaction but tests may want them all
+// ============================================================================================================================
+func (m *MemState) SetEvent(name string, payload []byte) error {
+	m.Events = append(m.Events, ChaincodeEvent{Name: name, Payload: append([]byte(nil), payload...)})
+	return nil
+}
+
+// ============================================================================================================================
+// HasNext - true while there are results left
+// ============================================================================================================================
+func (i *memIterator) HasNext() bool {
+	return i.pos < len(i.keys)
+}
+
+// ============================================================================================================================
+// Next - return the next key/value pair
+// ============================================================================================================================
+func (i *memIterator) Next() (string, []byte, error) {
+	if !i.HasNext() {
+		return "", nil, errors.New("no more results in range")
+	}
+	i.pos++
+	return i.keys[i.pos-1], i.values[i.pos-1], nil
+}
+
+// ============================================================================================================================
+// Close - release the iterator
+// ============================================================================================================================
+func (i *memIterator) Close() error {
+	i.keys = nil
+	i.values = nil
+	return nil
+}
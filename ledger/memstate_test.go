@@ -0,0 +1,129 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// scan - every key and value a range query hands back, in order
+func scan(t *testing.T, stub ChaincodeState, startKey, endKey string) ([]string, []string) {
+	t.Helper()
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		t.Fatalf("RangeQueryState(%q, %q): %s", startKey, endKey, err)
+	}
+	defer iter.Close()
+	keys, values := []string{}, []string{}
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			t.Fatalf("Next: %s", err)
+		}
+		keys = append(keys, key)
+		values = append(values, string(value))
+	}
+	if _, _, err := iter.Next(); err == nil {
+		t.Fatal("Next past the end of the range did not fail")
+	}
+	return keys, values
+}
+
+func TestMemStateGetPutDel(t *testing.T) {
+	m := NewMemState()
+	if value, err := m.GetState("a"); value != nil || err != nil {
+		t.Fatalf("missing key = %q, %v, want nil, nil", value, err)
+	}
+	if err := m.PutState("", []byte("x")); err == nil {
+		t.Fatal("empty key was accepted")
+	}
+	if err := m.PutState("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := m.GetState("a")
+	value[0] = '9' //callers get a copy, not the ledger's bytes
+	if value, _ := m.GetState("a"); string(value) != "1" {
+		t.Fatalf("a = %q, want 1", value)
+	}
+	if err := m.DelState("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DelState("a"); err != nil {
+		t.Fatalf("deleting a missing key: %s", err)
+	}
+	if value, _ := m.GetState("a"); value != nil {
+		t.Fatalf("a = %q after delete", value)
+	}
+}
+
+func TestMemStateRangeQueryState(t *testing.T) {
+	m := NewMemState()
+	for _, key := range []string{"b", "a", "\x00idx\x00x\x00", "c", "bb"} {
+		m.PutState(key, []byte("v"+key))
+	}
+	tests := []struct {
+		start, end string
+		want       []string
+	}{
+		{"", "\U0010FFFF", []string{"\x00idx\x00x\x00", "a", "b", "bb", "c"}},
+		{"a", "b", []string{"a", "b"}}, //both ends are inclusive
+		{"b", "b\U0010FFFF", []string{"b", "bb"}},
+		{"\x00idx\x00", "\x00idx\x00\U0010FFFF", []string{"\x00idx\x00x\x00"}},
+		{"d", "z", []string{}},
+	}
+	for _, tt := range tests {
+		keys, values := scan(t, m, tt.start, tt.end)
+		if !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("range %q-%q = %q, want %q", tt.start, tt.end, keys, tt.want)
+		}
+		for i, key := range keys {
+			if values[i] != "v"+key {
+				t.Errorf("%q = %q, want %q", key, values[i], "v"+key)
+			}
+		}
+	}
+}
+
+func TestMemStateTransaction(t *testing.T) {
+	m := NewMemState()
+	if _, err := m.GetTxTime(); err == nil {
+		t.Fatal("GetTxTime without a time set did not fail")
+	}
+	m.TxID = "tx1"
+	m.TxTime = time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC)
+	if txTime, err := m.GetTxTime(); err != nil || !txTime.Equal(m.TxTime) || m.GetTxID() != "tx1" {
+		t.Fatalf("tx = %s, %s, %v", m.GetTxID(), txTime, err)
+	}
+	if _, err := m.ReadCertAttribute("role"); err == nil {
+		t.Fatal("missing attribute did not fail")
+	}
+	m.Attributes["role"] = []byte("admin")
+	if role, err := m.ReadCertAttribute("role"); string(role) != "admin" || err != nil {
+		t.Fatalf("role = %q, %v", role, err)
+	}
+	m.SetEvent("one", []byte("1"))
+	m.SetEvent("two", []byte("2"))
+	want := []ChaincodeEvent{{Name: "one", Payload: []byte("1")}, {Name: "two", Payload: []byte("2")}}
+	if !reflect.DeepEqual(m.Events, want) {
+		t.Fatalf("events = %v, want %v", m.Events, want)
+	}
+}
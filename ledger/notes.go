@@ -0,0 +1,176 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const NoteObject = "note"                   //note~<key> holds a Note
+const NoteOwnerIndexName = "note~owner~key" //notes by the user who created them
+
+// Note a value a user keeps on the ledger, only the user who created it can change or delete it
+type Note struct {
+	Key       string `json:"key"`
+	Owner     string `json:"owner"`
+	Value     string `json:"value"`
+	UpdatedAt int64  `json:"updated_at"` //utc ms, from the transaction that last set it
+	TxID      string `json:"tx_id"`
+}
+
+// ============================================================================================================================
+// noteKeys - the record key followed by the index key for a note
+// ============================================================================================================================
+func noteKeys(note Note) ([]string, error) {
+	record, err := CreateCompositeKey(NoteObject, []string{note.Key})
+	if err != nil {
+		return nil, err
+	}
+	byOwner, err := CreateCompositeKey(NoteOwnerIndexName, []string{note.Owner, note.Key})
+	if err != nil {
+		return nil, err
+	}
+	return []string{record, byOwner}, nil
+}
+
+// ============================================================================================================================
+// GetNote - read a note, nil if there is none under key
+// ============================================================================================================================
+func GetNote(stub ChaincodeState, key string) (*Note, error) {
+	recordKey, err := CreateCompositeKey(NoteObject, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	noteAsBytes, err := stub.GetState(recordKey)
+	if err != nil {
+		return nil, errors.New("Failed to get note " + key)
+	}
+	if noteAsBytes == nil {
+		return nil, nil
+	}
+	var note Note
+	err = json.Unmarshal(noteAsBytes, &note)
+	if err != nil {
+		return nil, errors.New("note " + key + " is malformed - " + err.Error())
+	}
+	return &note, nil
+}
+
+// ============================================================================================================================
+// ownNote - read a note who created, for changing or deleting it
+// ============================================================================================================================
+func ownNote(stub ChaincodeState, who Caller, key string) (*Note, error) {
+	note, err := GetNote(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	if note != nil && note.Owner != who.User {
+		fmt.Println("! " + who.User + " tried to change note " + key)
+		return nil, Denied("note " + key + " belongs to " + note.Owner)
+	}
+	return note, nil
+}
+
+// ============================================================================================================================
+// SetNote - create a note for who or change one they created
+// ============================================================================================================================
+func SetNote(stub ChaincodeState, who Caller, key string, value string) error {
+	err := CheckName("1st argument", key)
+	if err != nil {
+		return err
+	}
+	_, err = ownNote(stub, who, key)
+	if err != nil {
+		return err
+	}
+	_, txMs, err := TxMillis(stub)
+	if err != nil {
+		return err
+	}
+
+	note := Note{Key: key, Owner: who.User, Value: value, UpdatedAt: txMs, TxID: stub.GetTxID()}
+	keys, err := noteKeys(note)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(note)
+	err = stub.PutState(keys[0], jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(keys[1], IndexValue)
+}
+
+// ============================================================================================================================
+// DeleteNote - remove a note who created
+// ============================================================================================================================
+func DeleteNote(stub ChaincodeState, who Caller, key string) error {
+	note, err := ownNote(stub, who, key)
+	if err != nil {
+		return err
+	}
+	if note == nil {
+		return NotFound("note " + key + " does not exist")
+	}
+
+	keys, err := noteKeys(*note)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// NotesByOwner - every note a user created
+// ============================================================================================================================
+func NotesByOwner(stub ChaincodeState, owner string) ([]Note, error) {
+	iter, err := ScanIndex(stub, NoteOwnerIndexName, []string{strings.ToLower(owner)})
+	if err != nil {
+		return nil, errors.New("Failed to scan notes")
+	}
+	defer iter.Close()
+
+	notes := []Note{}
+	for iter.HasNext() {
+		indexKey, _, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read notes")
+		}
+		_, attributes, err := SplitCompositeKey(indexKey)
+		if err != nil || len(attributes) != 2 {
+			continue
+		}
+		note, err := GetNote(stub, attributes[1])
+		if err != nil || note == nil {
+			continue //index entry outlived its note
+		}
+		notes = append(notes, *note)
+	}
+	return notes, nil
+}
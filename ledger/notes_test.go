@@ -0,0 +1,72 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotes(t *testing.T) {
+	m := NewMemState()
+	m.TxID = "tx1"
+	m.TxTime = time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	bob := Caller{User: "bob"}
+	amy := Caller{User: "amy"}
+	admin := Caller{User: "root", Role: AdminRole}
+
+	if err := SetNote(m, bob, "todo", "milk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetNote(m, bob, "_todo", "milk"); ErrorStatus(err) != StatusBadRequest {
+		t.Errorf("reserved name = %v, want a 400", err)
+	}
+	for _, who := range []Caller{amy, admin} {
+		if err := SetNote(m, who, "todo", "eggs"); ErrorStatus(err) != StatusForbidden {
+			t.Errorf("%s overwriting bob's note = %v, want a 403", who.User, err)
+		}
+		if err := DeleteNote(m, who, "todo"); ErrorStatus(err) != StatusForbidden {
+			t.Errorf("%s deleting bob's note = %v, want a 403", who.User, err)
+		}
+	}
+
+	note, err := GetNote(m, "todo")
+	want := Note{Key: "todo", Owner: "bob", Value: "milk", UpdatedAt: 1704164645006, TxID: "tx1"}
+	if err != nil || note == nil || *note != want {
+		t.Fatalf("GetNote(todo) = %+v, %v, want %+v", note, err, want)
+	}
+	notes, err := NotesByOwner(m, "BOB")
+	if err != nil || len(notes) != 1 || notes[0] != want {
+		t.Fatalf("NotesByOwner(BOB) = %+v, %v", notes, err)
+	}
+
+	if err := DeleteNote(m, bob, "todo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteNote(m, bob, "todo"); ErrorStatus(err) != StatusNotFound {
+		t.Errorf("deleting a missing note = %v, want a 404", err)
+	}
+	if notes, _ := NotesByOwner(m, "bob"); len(notes) != 0 {
+		t.Errorf("NotesByOwner(bob) = %+v after the delete", notes)
+	}
+	if len(m.State) != 0 {
+		t.Errorf("%d keys left after the delete", len(m.State))
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"errors"
+	"strconv"
+)
+
+const ResetConfirmation = "RESET" //what reset's 1st argument must be, so nobody wipes the ledger by accident
+
+// namespaces every chaincode writes through this package, Reset clears them after the chaincode's own
+var sharedObjectTypes = []string{NoteOwnerIndexName, NoteObject, UserNamespace, SystemNamespace}
+
+// ResetReport what one reset call deleted
+type ResetReport struct {
+	Deleted int  `json:"deleted"`
+	More    bool `json:"more"` //call reset again, there was more than limit to delete
+}
+
+// ============================================================================================================================
+// Reset - delete up to limit keys from objectTypes then the shared namespaces, and the flat keys once nothing is left
+// ============================================================================================================================
+func Reset(stub ChaincodeState, confirmation string, objectTypes []string, flatKeys []string, limit int) (ResetReport, error) {
+	report := ResetReport{}
+	if confirmation != ResetConfirmation {
+		return report, ArgError("reset deletes everything the chaincode stored, pass " + strconv.Quote(ResetConfirmation) + " as the 1st argument to confirm")
+	}
+
+	var err error
+	for _, objectType := range append(append([]string{}, objectTypes...), sharedObjectTypes...) {
+		report.More, err = resetKeys(stub, objectType, limit, &report.Deleted)
+		if err != nil {
+			return report, err
+		}
+		if report.More {
+			return report, nil
+		}
+	}
+	for _, name := range flatKeys { //legacy documents still on a flat key
+		err = stub.DelState(name)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// ============================================================================================================================
+// resetKeys - delete the keys of one namespace or index until deleted reaches limit, true if some were left
+// ============================================================================================================================
+func resetKeys(stub ChaincodeState, objectType string, limit int, deleted *int) (bool, error) {
+	iter, err := ScanIndex(stub, objectType, nil)
+	if err != nil {
+		return false, errors.New("Failed to scan " + objectType)
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return false, errors.New("Failed to read " + objectType)
+		}
+		if *deleted == limit {
+			return true, nil
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return false, err
+		}
+		*deleted++
+	}
+	return false, nil
+}
@@ -0,0 +1,70 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import "testing"
+
+func TestReset(t *testing.T) {
+	m := NewMemState()
+	for _, key := range []string{"\x00marble\x00m1\x00", "\x00marble\x00m2\x00", "\x00note\x00todo\x00", "\x00kv\x00x\x00", "_index", "other"} {
+		m.PutState(key, []byte{0})
+	}
+
+	if _, err := Reset(m, "reset", []string{"marble"}, []string{"_index"}, 10); ErrorStatus(err) != StatusBadRequest {
+		t.Fatalf("Reset without the confirmation = %v, want a 400", err)
+	}
+	report, err := Reset(m, ResetConfirmation, []string{"marble"}, []string{"_index"}, 3)
+	if err != nil || report != (ResetReport{Deleted: 3, More: true}) {
+		t.Fatalf("first page = %+v, %v", report, err)
+	}
+	if _, ok := m.State["_index"]; !ok {
+		t.Fatal("the flat key went before the namespaces were empty")
+	}
+	report, err = Reset(m, ResetConfirmation, []string{"marble"}, []string{"_index"}, 3)
+	if err != nil || report != (ResetReport{Deleted: 1, More: false}) {
+		t.Fatalf("second page = %+v, %v", report, err)
+	}
+	if len(m.State) != 1 || m.State["other"] == nil {
+		t.Fatalf("left %q, want only the key reset doesn't know about", m.State)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	m := NewMemState()
+	m.TxID = "tx7"
+	if err := Audit(m, StateWrittenEvent, Caller{User: "root", Role: AdminRole}, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Audit(m, ChaincodeResetEvent, Caller{User: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []ChaincodeEvent{
+		{Name: StateWrittenEvent, Payload: []byte(`{"tx_id":"tx7","by":"root","keys":["x"]}`)},
+		{Name: ChaincodeResetEvent, Payload: []byte(`{"tx_id":"tx7","by":"root"}`)},
+	}
+	if len(m.Events) != len(want) {
+		t.Fatalf("%d events, want %d", len(m.Events), len(want))
+	}
+	for i, event := range m.Events {
+		if event.Name != want[i].Name || string(event.Payload) != string(want[i].Payload) {
+			t.Errorf("event %d = %s %s, want %s %s", i, event.Name, event.Payload, want[i].Name, want[i].Payload)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package ledger is the slice of the chaincode stub the marbles and SmartPay handlers are written against, an
+// in-memory ledger to run them without a peer, a write buffer for changes that must land together, and what both
+// chaincodes share on top of it: request errors, the key layout, the caller's identity, notes, reset and audit events.
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ChaincodeState is the part of the chaincode stub the handlers actually use.
+// Each main package wraps its peer's stub in a shimState, tests use MemState.
+type ChaincodeState interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	DelState(key string) error
+	RangeQueryState(startKey, endKey string) (StateIterator, error) //keys between startKey and endKey, inclusive
+	GetCallerCertificate() ([]byte, error)
+	ReadCertAttribute(attributeName string) ([]byte, error)
+	GetTxID() string               //same on every endorsing peer, unlike the local clock
+	GetTxTime() (time.Time, error) //timestamp the client put on the transaction
+	SetEvent(name string, payload []byte) error
+}
+
+// StateIterator walks the results of a RangeQueryState call
+type StateIterator interface {
+	HasNext() bool
+	Next() (string, []byte, error)
+	Close() error
+}
+
+// ChaincodeEvent a named event and its JSON payload
+type ChaincodeEvent struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ============================================================================================================================
+// UnixMillis - t in utc ms, UnixNano only reaches 2262 and a caller can ask about any date up to 9999-12-31
+// ============================================================================================================================
+func UnixMillis(t time.Time) int64 {
+	return t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond)
+}
+
+// ============================================================================================================================
+// TxMillis - the transaction timestamp, as a time and in utc ms
+// ============================================================================================================================
+func TxMillis(stub ChaincodeState) (time.Time, int64, error) {
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return txTime, 0, errors.New("Failed to get transaction timestamp")
+	}
+	return txTime, UnixMillis(txTime), nil
+}
@@ -0,0 +1,315 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// ============================================================================================================================
+// count - how many marbles a description stands for, trades from before quantities mean one
+// ============================================================================================================================
+func (d Description) count() int {
+	if d.Quantity <= 0 {
+		return 1
+	}
+	return d.Quantity
+}
+
+// ============================================================================================================================
+// kind - the color and size a description matches, as one comparable string
+// ============================================================================================================================
+func (d Description) kind() string {
+	return strings.ToLower(d.Color) + "/" + strconv.Itoa(d.Size)
+}
+
+// ============================================================================================================================
+// isBundle - true for a trade that swaps a list of marbles for another list, rather than one for one
+// ============================================================================================================================
+func (trade AnOpenTrade) isBundle() bool {
+	return len(trade.Wants) > 0
+}
+
+// ============================================================================================================================
+// wanted - every description a trade wants, one entry for a classic trade
+// ============================================================================================================================
+func (trade AnOpenTrade) wanted() []Description {
+	if trade.isBundle() {
+		return trade.Wants
+	}
+	return []Description{trade.Want}
+}
+
+// ============================================================================================================================
+// parseBundle - read color, size, quantity triples
+// ============================================================================================================================
+func parseBundle(args []string, first int) ([]Description, error) {
+	var bundle []Description
+	for i := 0; i+2 < len(args); i += 3 {
+		size, err := strconv.Atoi(args[i+1])
+		if err != nil || size < 0 {
+			return nil, argError("argument " + strconv.Itoa(first+i+2) + " must be a non-negative numeric string")
+		}
+		quantity, err := strconv.Atoi(args[i+2])
+		if err != nil || quantity <= 0 {
+			return nil, argError("argument " + strconv.Itoa(first+i+3) + " must be a positive numeric string")
+		}
+		if len(args[i]) <= 0 {
+			return nil, argError("argument " + strconv.Itoa(first+i+1) + " must be a non-empty string")
+		}
+		bundle = append(bundle, Description{Color: strings.ToLower(args[i]), Size: size, Quantity: quantity})
+	}
+	return bundle, nil
+}
+
+// ============================================================================================================================
+// findBundle - pick distinct marbles owned by user that cover every description in bundle
+// ============================================================================================================================
+func findBundle(stub ChaincodeState, user string, bundle []Description) ([]Marble, error) {
+	var picked []Marble
+	taken := map[string]bool{}
+	for _, want := range bundle {
+		iter, err := ledger.ScanIndex(stub, ownerIndexName, []string{strings.ToLower(user), strings.ToLower(want.Color), strconv.Itoa(want.Size)})
+		if err != nil {
+			return nil, errors.New("Failed to scan marble index")
+		}
+		found := 0
+		for found < want.count() && iter.HasNext() {
+			key, _, err := iter.Next()
+			if err != nil {
+				iter.Close()
+				return nil, errors.New("Failed to read marble index")
+			}
+			_, attrs, err := ledger.SplitCompositeKey(key)
+			if err != nil || len(attrs) != 4 || taken[attrs[3]] {
+				continue
+			}
+			res, err := getMarble(stub, attrs[3])
+			if err != nil || strings.ToLower(res.User) != strings.ToLower(user) || (Description{Color: res.Color, Size: res.Size}).kind() != want.kind() {
+				continue //index could be stale
+			}
+			holder, err := lockedFor(stub, res.Name)
+			if err != nil || holder != "" {
+				continue //held in escrow for another trade
+			}
+			taken[res.Name] = true
+			picked = append(picked, res)
+			found++
+		}
+		iter.Close()
+		if found < want.count() {
+			return nil, conflict(user + " does not have " + strconv.Itoa(want.count()) + " " + want.Color + " marbles of size " + strconv.Itoa(want.Size))
+		}
+	}
+	return picked, nil
+}
+
+// ============================================================================================================================
+// matchBundle - make sure marbles are exactly what bundle describes, no more and no less
+// ============================================================================================================================
+func matchBundle(marbles []Marble, bundle []Description) error {
+	need := map[string]int{}
+	for _, want := range bundle {
+		need[want.kind()] += want.count()
+	}
+	for _, m := range marbles {
+		kind := Description{Color: m.Color, Size: m.Size}.kind()
+		if need[kind] <= 0 {
+			return argError("marble " + m.Name + " is not wanted by this trade")
+		}
+		need[kind]--
+	}
+	for kind, left := range need {
+		if left > 0 {
+			return argError("trade still wants " + strconv.Itoa(left) + " more " + kind + " marbles")
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// moveMarble - hand a marble to a new owner keeping its index, custody history and offers in step
+// ============================================================================================================================
+func moveMarble(stub ChaincodeState, m Marble, to string, reason string) error {
+	previous := m.User
+	err := unindexMarble(stub, m)
+	if err != nil {
+		return err
+	}
+	m.User = to
+	err = putMarble(stub, m)
+	if err != nil {
+		return err
+	}
+	err = indexMarble(stub, m)
+	if err != nil {
+		return err
+	}
+	err = recordCustody(stub, m.Name, to, previous, reason)
+	if err != nil {
+		return err
+	}
+	return dropOffer(stub, m.Name)
+}
+
+// ============================================================================================================================
+// Open Bundle Trade - offer a list of marbles for another list, each kind with a quantity
+// ============================================================================================================================
+func (t *Chaincode) open_bundle_trade(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &OpenBundleTradeRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0     1     2      3     4     5      6     7      8*      9*   10*     11*
+	// "bob", "1", "blue", "16", "2", "red", "10", "1", "green", "5", "3", "36h"
+	// user, how many kinds are wanted, then a color, size and quantity for each wanted kind followed by each given kind,
+	// then optionally when the trade expires
+	expires := ""
+	if len(args) > 2 && (len(args)-2)%3 == 1 { //one left over after the kinds is the expiry
+		expires = args[len(args)-1]
+		args = args[:len(args)-1]
+	}
+	if len(args) < 8 || (len(args)-2)%3 != 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the user, the number of wanted kinds, then a color, size and quantity for each wanted and each given kind, and optionally when the trade expires")
+	}
+	kinds, err := strconv.Atoi(args[1])
+	if err != nil || kinds <= 0 || 2+kinds*3 >= len(args) {
+		return nil, argError("2nd argument must be the number of wanted kinds, leaving at least one kind to give")
+	}
+	err = t.authorize(stub, args[0], "open a trade") //you can only offer your own marbles
+	if err != nil {
+		return nil, err
+	}
+
+	open := AnOpenTrade{User: args[0]}
+	open.Wants, err = parseBundle(args[2:2+kinds*3], 2)
+	if err != nil {
+		return nil, err
+	}
+	open.Gives, err = parseBundle(args[2+kinds*3:], 2+kinds*3)
+	if err != nil {
+		return nil, err
+	}
+	_, err = findBundle(stub, open.User, open.Gives) //refuse a bundle the opener can't hand over
+	if err != nil {
+		return nil, err
+	}
+	open.ID, open.Timestamp, err = newTradeID(stub)
+	if err != nil {
+		return nil, err
+	}
+	open.ExpiresAt, err = parseExpiry("last argument", expires, open.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putTrade(stub, open)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, tradeOpenedEvent, EventPayload{Trades: []string{open.ID}, Users: []string{open.User}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- opened bundle trade " + open.ID)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// performBundleTrade - swap the closer's marbles for the whole bundle the opener gives, all or nothing
+// ============================================================================================================================
+func (t *Chaincode) performBundleTrade(stub ChaincodeState, trade AnOpenTrade, args []string) ([]byte, error) {
+
+	//   0        1        2        3      4*
+	// [id, closer.user, opener.user, name, name...] the closer's marbles
+	if len(args) < 4 {
+		return nil, argError("Incorrect number of arguments. Expecting the trade id, the closer, the opener and the closer's marbles")
+	}
+	closer := args[1]
+	err := t.authorize(stub, closer, "close a trade") //closer gives up marbles, so it must be the closer
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(trade.User) != strings.ToLower(args[2]) {
+		return nil, denied("trade " + args[0] + " was not opened by " + args[2])
+	}
+
+	var closers []Marble
+	seen := map[string]bool{}
+	for _, name := range args[3:] {
+		if seen[name] {
+			return nil, argError("marble " + name + " is listed twice")
+		}
+		seen[name] = true
+		res, err := getMarble(stub, name)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(res.User) != strings.ToLower(closer) {
+			return nil, denied("marble " + name + " is not owned by " + closer)
+		}
+		err = checkUnlocked(stub, res.Name, "") //can't be promised to another trade
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, res)
+	}
+	err = matchBundle(closers, trade.Wants)
+	if err != nil {
+		return nil, err
+	}
+	openers, err := findBundle(stub, trade.User, trade.Gives)
+	if err != nil {
+		return nil, err
+	}
+
+	// ---- every leg and the trade removal land together, Invoke only commits once all of them succeed ----
+	moved := []string{}
+	for _, m := range closers {
+		err = moveMarble(stub, m, trade.User, "perform_trade")
+		if err != nil {
+			return nil, err
+		}
+		moved = append(moved, m.Name)
+	}
+	for _, m := range openers {
+		err = moveMarble(stub, m, closer, "perform_trade")
+		if err != nil {
+			return nil, err
+		}
+		moved = append(moved, m.Name)
+	}
+	err = deleteTrade(stub, trade)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, tradePerformedEvent, EventPayload{Trades: []string{tradeID(trade)}, Marbles: moved, Users: []string{trade.User, closer}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end close bundle trade")
+	return nil, nil
+}
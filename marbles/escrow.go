@@ -0,0 +1,215 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var escrowObject = "escrow" //escrow~<marble> holds the EscrowLock keeping a marble in place for an open trade
+
+// EscrowLock a marble held for an open trade, it can't change hands until the trade is performed, removed or expires
+type EscrowLock struct {
+	Marble   string `json:"marble"`
+	Trade    string `json:"trade"`     //id of the open trade holding it
+	LockedAt int64  `json:"locked_at"` //utc ms, from the transaction that opened the trade
+}
+
+// ============================================================================================================================
+// getLock - read the escrow lock on a marble, nil if there is none
+// ============================================================================================================================
+func getLock(stub ChaincodeState, name string) (*EscrowLock, error) {
+	key, err := ledger.CreateCompositeKey(escrowObject, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	lockAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get escrow lock for " + name)
+	}
+	if lockAsBytes == nil {
+		return nil, nil
+	}
+	var lock EscrowLock
+	err = json.Unmarshal(lockAsBytes, &lock)
+	if err != nil {
+		return nil, errors.New("escrow lock for " + name + " is malformed - " + err.Error())
+	}
+	return &lock, nil
+}
+
+// ============================================================================================================================
+// putLock - hold a marble for an open trade
+// ============================================================================================================================
+func putLock(stub ChaincodeState, lock EscrowLock) error {
+	key, err := ledger.CreateCompositeKey(escrowObject, []string{lock.Marble})
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(lock)
+	return stub.PutState(key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// releaseLock - let go of a marble held for trade id, a lock a newer trade has taken over is left alone
+// ============================================================================================================================
+func releaseLock(stub ChaincodeState, name string, id string) error {
+	lock, err := getLock(stub, name)
+	if err != nil || lock == nil || lock.Trade != id {
+		return err
+	}
+	key, err := ledger.CreateCompositeKey(escrowObject, []string{name})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+// ============================================================================================================================
+// lockedFor - the id of the open trade holding a marble, empty when it is free. A lock lapses with its trade.
+// ============================================================================================================================
+func lockedFor(stub ChaincodeState, name string) (string, error) {
+	lock, err := getLock(stub, name)
+	if err != nil || lock == nil {
+		return "", err
+	}
+	trade, err := getTrade(stub, lock.Trade)
+	if err != nil {
+		return "", nil //trade is gone, the lock just wasn't cleaned up
+	}
+	txTime, err := stub.GetTxTime()
+	if err == nil && trade.expired(txTime.UnixNano()/int64(time.Millisecond)) {
+		return "", nil //purge_expired_trades removes the lock along with the trade
+	}
+	return lock.Trade, nil
+}
+
+// ============================================================================================================================
+// checkUnlocked - refuse to move a marble held in escrow, unless it is trade id moving it
+// ============================================================================================================================
+func checkUnlocked(stub ChaincodeState, name string, id string) error {
+	holder, err := lockedFor(stub, name)
+	if err != nil {
+		return err
+	}
+	if holder != "" && holder != id {
+		return conflict("marble " + name + " is held in escrow for open trade " + holder)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// findEscrowed - the marble an escrow trade hands over for a color and size, it has to be one the trade locked
+// ============================================================================================================================
+func findEscrowed(stub ChaincodeState, trade AnOpenTrade, color string, size int) (Marble, error) {
+	for _, name := range trade.Escrow {
+		res, err := getMarble(stub, name)
+		if err != nil {
+			continue
+		}
+		if strings.ToLower(res.User) == strings.ToLower(trade.User) && strings.ToLower(res.Color) == strings.ToLower(color) && res.Size == size {
+			return res, nil
+		}
+	}
+	return Marble{}, conflict("Did not find marble to use in this trade")
+}
+
+// ============================================================================================================================
+// Open Escrow Trade - open a trade for the marbles the opener names, locking them until the trade is done with
+// ============================================================================================================================
+func (t *Chaincode) open_escrow_trade(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &OpenEscrowTradeRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0      1      2      3      4      5*
+	// "bob", "red", "16", "36h", "b1", "b2"
+	// user, the wanted color and size, when the trade expires ("" never), then each marble offered
+	if len(args) < 5 {
+		return nil, argError("Incorrect number of arguments. Expecting at least 5, the user, the wanted color and size, when the trade expires and the marbles offered")
+	}
+	size, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, argError("3rd argument must be a numeric string")
+	}
+	err = t.authorize(stub, args[0], "open a trade") //you can only offer your own marbles
+	if err != nil {
+		return nil, err
+	}
+
+	open := AnOpenTrade{User: args[0], Want: Description{Color: args[1], Size: size}}
+	open.ID, open.Timestamp, err = newTradeID(stub)
+	if err != nil {
+		return nil, err
+	}
+	open.ExpiresAt, err = parseExpiry("4th argument", args[3], open.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, name := range args[4:] {
+		if seen[name] {
+			return nil, argError("marble " + name + " is listed twice")
+		}
+		seen[name] = true
+		res, err := getMarble(stub, name)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(res.User) != strings.ToLower(open.User) {
+			return nil, denied("marble " + name + " is not owned by " + open.User)
+		}
+		err = checkUnlocked(stub, res.Name, "")
+		if err != nil {
+			return nil, err
+		}
+		open.Escrow = append(open.Escrow, res.Name)
+		open.Willing = append(open.Willing, Description{Color: res.Color, Size: res.Size}) //what trades_wanting and the UI show
+	}
+
+	err = putTrade(stub, open)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range open.Escrow {
+		err = putLock(stub, EscrowLock{Marble: name, Trade: open.ID, LockedAt: open.Timestamp})
+		if err != nil {
+			return nil, err
+		}
+		err = dropOffer(stub, name) //it is promised to the trade now
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = emitEvent(stub, tradeOpenedEvent, EventPayload{Trades: []string{open.ID}, Marbles: open.Escrow, Users: []string{open.User}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- opened escrow trade " + open.ID)
+	return nil, nil
+}
@@ -0,0 +1,108 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// chaincode event names, listeners subscribe to these instead of polling the ledger
+var marbleCreatedEvent = "marble_created"
+var marbleTransferredEvent = "marble_transferred"
+var marbleDeletedEvent = "marble_deleted"
+var tradeOpenedEvent = "trade_opened"
+var tradePerformedEvent = "trade_performed"
+var tradeRemovedEvent = "trade_removed"
+var tradesPrunedEvent = "trades_pruned"
+var tradesExpiredEvent = "trades_expired"
+var marbleOfferedEvent = "marble_offered"
+var offerRejectedEvent = "offer_rejected"
+var stateWrittenEvent = ledger.StateWrittenEvent     //an admin wrote a value through write or ecrire
+var stateDeletedEvent = ledger.StateDeletedEvent     //an admin deleted something through delete
+var chaincodeResetEvent = ledger.ChaincodeResetEvent //an admin ran reset, sent once per call
+var batchEvent = "marbles_events"                    //the peer keeps one event per transaction, several are sent together under this name
+
+// EventPayload what every marbles event carries, only the ids the change touched are filled in
+type EventPayload struct {
+	TxID    string   `json:"tx_id"`
+	Marbles []string `json:"marbles,omitempty"`
+	Trades  []string `json:"trades,omitempty"`
+	Users   []string `json:"users,omitempty"`
+}
+
+// ChaincodeEvent a named event and its JSON payload
+type ChaincodeEvent = ledger.ChaincodeEvent
+
+// eventBuffer collects the events raised during one invoke so they can be sent once it succeeds
+type eventBuffer struct {
+	ChaincodeState
+	events []ChaincodeEvent
+}
+
+// ============================================================================================================================
+// newEventBuffer - start collecting events for stub
+// ============================================================================================================================
+func newEventBuffer(stub ChaincodeState) *eventBuffer {
+	return &eventBuffer{ChaincodeState: stub}
+}
+
+// ============================================================================================================================
+// SetEvent - hold on to an event until flush
+// ============================================================================================================================
+func (b *eventBuffer) SetEvent(name string, payload []byte) error {
+	b.events = append(b.events, ChaincodeEvent{Name: name, Payload: payload})
+	return nil
+}
+
+// ============================================================================================================================
+// flush - send the collected events, a lone event goes out under its own name
+// ============================================================================================================================
+func (b *eventBuffer) flush() error {
+	if len(b.events) == 0 {
+		return nil
+	}
+	if len(b.events) == 1 {
+		return b.ChaincodeState.SetEvent(b.events[0].Name, b.events[0].Payload)
+	}
+	jsonAsBytes, _ := json.Marshal(b.events)
+	return b.ChaincodeState.SetEvent(batchEvent, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// emitEvent - raise a marbles event for the current transaction
+// ============================================================================================================================
+func emitEvent(stub ChaincodeState, name string, payload EventPayload) error {
+	payload.TxID = stub.GetTxID()
+	jsonAsBytes, _ := json.Marshal(payload)
+	return stub.SetEvent(name, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// auditRaw - raise an audit event naming the caller and the names they wrote or deleted
+// ============================================================================================================================
+func (t *Chaincode) auditRaw(stub ChaincodeState, name string, keys ...string) error {
+	who, err := t.caller(stub)
+	if err != nil {
+		return err
+	}
+	return ledger.Audit(stub, name, who, keys...)
+}
@@ -0,0 +1,98 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var historyIndexName = "history~name~time~tx" //one record per ownership change, sorted by time within a marble
+
+// CustodyRecord one link in a marble's chain of custody
+type CustodyRecord struct {
+	Marble        string `json:"marble"`
+	Owner         string `json:"owner"`          //empty once the marble is deleted
+	PreviousOwner string `json:"previous_owner"` //empty when the marble is created
+	TxID          string `json:"tx_id"`
+	Timestamp     int64  `json:"timestamp"` //utc ms, from the transaction
+	Reason        string `json:"reason"`    //the function that moved it, e.g. set_user or perform_trade
+}
+
+// ============================================================================================================================
+// recordCustody - append an ownership change to a marble's history
+// ============================================================================================================================
+func recordCustody(stub ChaincodeState, name string, owner string, previousOwner string, reason string) error {
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return errors.New("Failed to get transaction timestamp")
+	}
+	record := CustodyRecord{
+		Marble:        name,
+		Owner:         owner,
+		PreviousOwner: previousOwner,
+		TxID:          stub.GetTxID(),
+		Timestamp:     txTime.UnixNano() / int64(time.Millisecond),
+		Reason:        reason,
+	}
+
+	key, err := ledger.CreateCompositeKey(historyIndexName, []string{name, fmt.Sprintf("%020d", txTime.UnixNano()), record.TxID})
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(record)
+	return stub.PutState(key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// Marble History - the full chain of custody for a marble, oldest first
+// ============================================================================================================================
+func (t *Chaincode) marble_history(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0
+	// "asdf"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the marble name")
+	}
+
+	iter, err := ledger.ScanIndex(stub, historyIndexName, []string{args[0]})
+	if err != nil {
+		return nil, errors.New("Failed to scan marble history")
+	}
+	defer iter.Close()
+
+	history := []CustodyRecord{}
+	for iter.HasNext() {
+		_, recordAsBytes, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read marble history")
+		}
+		var record CustodyRecord
+		if json.Unmarshal(recordAsBytes, &record) != nil {
+			continue
+		}
+		history = append(history, record)
+	}
+	return json.Marshal(history)
+}
@@ -0,0 +1,51 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import "github.com/chaitanyaamin/marbles-chaincode/ledger"
+
+var adminRole = ledger.AdminRole //role allowed to act on anyone's marbles and trades
+
+// Caller who submitted the transaction
+type Caller = ledger.Caller
+
+// CallerResolver works out the Caller from the stub, set Chaincode.Identify to fake one
+type CallerResolver = ledger.CallerResolver
+
+// ============================================================================================================================
+// caller - resolve the identity of whoever submitted this transaction
+// ============================================================================================================================
+func (t *Chaincode) caller(stub ChaincodeState) (Caller, error) {
+	return ledger.ResolveCaller(stub, t.Identify)
+}
+
+// ============================================================================================================================
+// authorize - make sure the caller may act on something owned by user
+// ============================================================================================================================
+func (t *Chaincode) authorize(stub ChaincodeState, user string, action string) error {
+	return ledger.Authorize(stub, t.Identify, user, action)
+}
+
+// ============================================================================================================================
+// requireAdmin - make sure the caller holds the admin role
+// ============================================================================================================================
+func (t *Chaincode) requireAdmin(stub ChaincodeState, action string) error {
+	return ledger.RequireRoles(stub, t.Identify, action, adminRole)
+}
@@ -0,0 +1,183 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var ownerIndexName = "owner~color~size~name" //secondary key used to find a user's marbles by color and size
+var colorIndexName = "color~name"            //marbles by color
+var sizeIndexName = "size~name"              //marbles by size, size is zero padded so keys sort numerically
+var nameIndexName = "name"                   //every marble, in name order
+var sizeDigits = 10                          //what sizes are padded to in the size index, longer ones would sort out of order
+
+var indexValue = ledger.IndexValue //index keys carry all their data in the key
+
+// ============================================================================================================================
+// ownerIndexKey - build the owner~color~size~name key for a marble
+// ============================================================================================================================
+func ownerIndexKey(m Marble) (string, error) {
+	return ledger.CreateCompositeKey(ownerIndexName, []string{strings.ToLower(m.User), strings.ToLower(m.Color), strconv.Itoa(m.Size), m.Name})
+}
+
+// ============================================================================================================================
+// sizeAttribute - zero pad a size so the size index sorts numerically
+// ============================================================================================================================
+func sizeAttribute(size int) string {
+	return fmt.Sprintf("%0*d", sizeDigits, size)
+}
+
+// ============================================================================================================================
+// sizeFits - true if the size index can sort size, it is not negative and has at most sizeDigits digits
+// ============================================================================================================================
+func sizeFits(size int) bool {
+	return size >= 0 && len(strconv.Itoa(size)) <= sizeDigits
+}
+
+// ============================================================================================================================
+// marbleIndexKeys - every index key a marble is listed under
+// ============================================================================================================================
+func marbleIndexKeys(m Marble) ([]string, error) {
+	var keys []string
+	owner, err := ownerIndexKey(m)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, owner)
+
+	for _, index := range [][]string{
+		{colorIndexName, strings.ToLower(m.Color), m.Name},
+		{sizeIndexName, sizeAttribute(m.Size), m.Name},
+		{nameIndexName, m.Name},
+	} {
+		key, err := ledger.CreateCompositeKey(index[0], index[1:])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ============================================================================================================================
+// indexMarble - add a marble to the marble indexes
+// ============================================================================================================================
+func indexMarble(stub ChaincodeState, m Marble) error {
+	keys, err := marbleIndexKeys(m)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.PutState(key, indexValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// unindexMarble - remove a marble from the marble indexes
+// ============================================================================================================================
+func unindexMarble(stub ChaincodeState, m Marble) error {
+	keys, err := marbleIndexKeys(m)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// Migrate Marble Index - (re)build the marble indexes from the legacy _marbleindex array and the ownership index
+// ============================================================================================================================
+func (t *Chaincode) migrate_marble_index(stub ChaincodeState, args []string) ([]byte, error) {
+	_, err := requestArgs(args, &MigrateRequest{}) //or a single JSON object, see requests.go, there are no arguments
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireAdmin(stub, "migrate the marble index")
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- start migrate marble index")
+	legacyKey, marblesAsBytes, err := ledger.GetSystemDoc(stub, marbleIndexStr) //before or after migrate_keyspace
+	if err != nil {
+		return nil, err
+	}
+	var marbleIndex []string
+	json.Unmarshal(marblesAsBytes, &marbleIndex) //un stringify it aka JSON.parse()
+
+	iter, err := ledger.ScanIndex(stub, ownerIndexName, nil) //marbles indexed before the other indexes existed
+	if err != nil {
+		return nil, errors.New("Failed to scan marble index")
+	}
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			iter.Close()
+			return nil, errors.New("Failed to read marble index")
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err == nil && len(attrs) == 4 {
+			marbleIndex = append(marbleIndex, attrs[3])
+		}
+	}
+	iter.Close()
+
+	migrated := 0
+	seen := make(map[string]bool)
+	for _, name := range marbleIndex {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		res, err := getMarble(stub, name)
+		if err != nil { //deleted or overwritten since it was indexed
+			fmt.Println("! skipping " + name + ", " + err.Error())
+			continue
+		}
+		err = indexMarble(stub, res)
+		if err != nil {
+			return nil, err
+		}
+		migrated++
+	}
+
+	err = stub.DelState(legacyKey) //nothing maintains the array anymore, don't leave a stale copy around
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end migrate marble index, indexed " + strconv.Itoa(migrated) + " marbles")
+	return []byte(strconv.Itoa(migrated)), nil
+}
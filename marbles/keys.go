@@ -0,0 +1,99 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// Every record lives under a typed key, <namespace>~<name>, see ledger/keys.go for the layout and the system and
+// write namespaces both chaincodes share. The marble namespace is ours.
+var marbleNamespace = "marble" //marble~<name> holds a Marble
+
+// KeyMigration what one migrate_keyspace call did, see ledger/keys.go
+type KeyMigration = ledger.KeyMigration
+
+// ============================================================================================================================
+// marbleKey - the key a marble is stored under
+// ============================================================================================================================
+func marbleKey(name string) (string, error) {
+	return ledger.CreateCompositeKey(marbleNamespace, []string{name})
+}
+
+// ============================================================================================================================
+// readKey - where read finds a name, reserved names are the chaincode's documents, otherwise a marble before a value
+// ============================================================================================================================
+func readKey(stub ChaincodeState, name string) (string, error) {
+	if strings.HasPrefix(name, ledger.ReservedPrefix) {
+		return ledger.SystemKey(name)
+	}
+	key, err := marbleKey(name)
+	if err != nil {
+		return "", err
+	}
+	valAsBytes, err := stub.GetState(key)
+	if err != nil || valAsBytes != nil {
+		return key, err
+	}
+	return ledger.UserKey(name)
+}
+
+// ============================================================================================================================
+// flatKeyTarget - the typed key a key from before namespaces belongs under
+// ============================================================================================================================
+func flatKeyTarget(key string, value []byte) (string, error) {
+	if strings.HasPrefix(key, ledger.ReservedPrefix) { //_marbleindex, _opentrades
+		return ledger.SystemKey(key)
+	}
+	res, err := decodeMarble(value)
+	if err == nil && res.Name == key {
+		return marbleKey(key)
+	}
+	return ledger.UserKey(key) //anything else came from write or ecrire
+}
+
+// ============================================================================================================================
+// Migrate Keyspace - move records stored under flat keys to their typed keys, admin only, a page at a time
+// ============================================================================================================================
+func (t *Chaincode) migrate_keyspace(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &PageRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireAdmin(stub, "migrate the keyspace")
+	if err != nil {
+		return nil, err
+	}
+
+	//   0*       1*
+	// "100", "bookmark"
+	limit, bookmark, err := parsePaging(args)
+	if err != nil {
+		return nil, err
+	}
+	report, err := ledger.MigrateKeyspace(stub, limit, bookmark, flatKeyTarget) //see ledger/keys.go
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(report)
+}
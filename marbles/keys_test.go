@@ -0,0 +1,193 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+func TestNamespaces(t *testing.T) {
+	c := seedChain(t)
+	c.mustInvoke("write", "m1", "hello") //same name as a marble, kept apart
+	if c.owner("m1") != "bob" {
+		t.Fatal("write clobbered m1")
+	}
+	for _, call := range [][]string{
+		{"init_marble", "_opentrades", "red", "10", "bob"},
+		{"write", "_marbleindex", "x"},
+		{"set_note", "_marbleindex", "x"},
+	} {
+		if _, err := c.invoke(call[0], call[1:]...); ErrorStatus(err) != 400 {
+			t.Errorf("%q = %v, want a 400 for a reserved name", call, err)
+		}
+	}
+
+	var res Marble
+	c.mustQuery(&res, "read", "m1")
+	if res.Name != "m1" {
+		t.Fatalf("read m1 = %v, the marble comes first", res)
+	}
+	c.mustInvoke("delete", "m1")
+	if value, _ := c.query("read", "m1"); string(value) != "hello" {
+		t.Fatalf("read m1 = %q after the marble went", value)
+	}
+	c.mustInvoke("delete", "m1")
+	if value, _ := c.query("read", "m1"); value != nil {
+		t.Fatalf("read m1 = %q after both went", value)
+	}
+}
+
+func TestMigrateKeyspace(t *testing.T) {
+	tests := []struct {
+		name string
+		page func(bookmark string) []string
+	}{
+		{"positional", func(bookmark string) []string { return []string{"2", bookmark} }},
+		{"json", func(bookmark string) []string { return []string{`{"limit":2,"bookmark":"` + bookmark + `"}`} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChain(t)
+			c.st.State["old"] = []byte(`{"name":"old","color":"red","size":3,"user":"amy"}`)
+			c.st.State[marbleIndexStr] = []byte(`["old"]`)
+			c.st.State["abc"] = []byte("7")
+			c.st.State["clash"] = []byte("flat")
+			key, _ := ledger.UserKey("clash")
+			c.st.State[key] = []byte("typed")
+
+			var report KeyMigration
+			json.Unmarshal(c.mustInvoke("migrate_keyspace", tt.page("")...), &report)
+			if report.Moved != 2 || report.Bookmark == "" {
+				t.Fatalf("first page = %v", report)
+			}
+			bookmark := report.Bookmark
+			report = KeyMigration{}
+			json.Unmarshal(c.mustInvoke("migrate_keyspace", tt.page(bookmark)...), &report)
+			if report.Moved != 1 || !reflect.DeepEqual(report.Conflicts, []string{"clash"}) || report.Bookmark != "" {
+				t.Fatalf("last page = %v, want one more moved and clash left alone", report)
+			}
+			if c.owner("old") != "amy" || c.st.State["old"] != nil || c.st.State["abc"] != nil {
+				t.Fatal("old and abc were not moved")
+			}
+			if value, _ := c.query("read", "clash"); string(value) != "typed" {
+				t.Fatalf("clash = %q, a conflict must not be overwritten", value)
+			}
+
+			c.mustInvoke("migrate_marble_index")
+			if value, _ := c.query("read", marbleIndexStr); value != nil {
+				t.Fatalf("%s = %q, the legacy index was not retired", marbleIndexStr, value)
+			}
+			var page MarblePage
+			c.mustQuery(&page, "marbles_by_color", "red")
+			if len(page.Marbles) != 1 || page.Marbles[0].Name != "old" {
+				t.Fatalf("red marbles = %v", page.Marbles)
+			}
+		})
+	}
+}
+
+func TestMigrateMarbleIndexRebuildsFromOwners(t *testing.T) {
+	c := seedChain(t)
+	for key := range c.st.State {
+		for _, index := range []string{"color", "name", "size"} {
+			if strings.HasPrefix(key, ledger.KeySeparator+index) {
+				delete(c.st.State, key)
+			}
+		}
+	}
+	c.mustInvoke("migrate_marble_index")
+	var page MarblePage
+	c.mustQuery(&page, "list_marbles")
+	if len(page.Marbles) != 3 {
+		t.Fatalf("marbles = %v after the rebuild", page.Marbles)
+	}
+	c.mustQuery(&page, "marbles_by_size_range", "10", "40")
+	if len(page.Marbles) != 2 {
+		t.Fatalf("marbles from 10 to 40 = %v after the rebuild", page.Marbles)
+	}
+}
+
+func TestValidateRecords(t *testing.T) {
+	c := seedChain(t)
+	c.mustInvoke("init_marble", `quo"te`, "blue", "16", "bob")
+	if c.owner(`quo"te`) != "bob" {
+		t.Fatal(`quo"te was not stored as valid JSON`)
+	}
+	c.st.State[mustMarbleKey(t, "m2")] = []byte(`{"name":"m2","color":"","size":16,"user":"amy"}`)
+	if _, err := c.as(amy).invoke("set_user", "m2", "carl"); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Fatalf("set_user on a malformed marble = %v", err)
+	}
+	var report RecordReport
+	c.mustQuery(&report, "validate_records")
+	if len(report.Problems) != 1 || report.Problems[0].Key != "m2" {
+		t.Fatalf("report = %v, want only m2", report)
+	}
+	var page MarblePage
+	c.mustQuery(&page, "list_marbles")
+	for _, res := range page.Marbles {
+		if res.Name == "m2" {
+			t.Fatal("list_marbles handed out the malformed m2")
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	c := seedChain(t)
+	c.as(bob).mustInvoke("set_note", "fav", "blue")
+	c.as(bob).mustInvoke("offer_marble", "m1", "amy")
+	c.st.State[marbleIndexStr] = []byte(`[]`)
+	c.st.Events = nil
+
+	var report ResetReport
+	before := len(c.st.State)
+	json.Unmarshal(c.as(admin).mustInvoke("reset", `{"confirm":"RESET","limit":3}`), &report)
+	if report.Deleted != 3 || !report.More || len(c.st.State) != before-3 {
+		t.Fatalf("first call = %v, %d keys left of %d", report, len(c.st.State), before)
+	}
+	if len(c.st.Events) != 1 || c.st.Events[0].Name != chaincodeResetEvent {
+		t.Fatalf("events = %v", c.events())
+	}
+	for report.More {
+		report = ResetReport{}
+		json.Unmarshal(c.mustInvoke("reset", "RESET"), &report)
+	}
+	for key := range c.st.State {
+		t.Errorf("reset left %q behind", key)
+	}
+	c.mustInvoke("init", "1")
+	if value, _ := c.query("read", "abc"); string(value) != "1" {
+		t.Fatalf("abc = %q after init on a reset ledger", value)
+	}
+}
+
+// mustMarbleKey - the key a marble is stored under
+func mustMarbleKey(t *testing.T, name string) string {
+	t.Helper()
+	key, err := marbleKey(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
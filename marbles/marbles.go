@@ -0,0 +1,900 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package marbles is the marbles chaincode without a peer attached. It only sees the ChaincodeState
+// interface, so the obc-peer and hyperledger/fabric builds each wrap their own shim's stub and hand
+// every call through to a Chaincode - see part2 and hyperledger/part2, part3 and part6.
+package marbles
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// Chaincode the marbles business logic, shared by every shim generation
+type Chaincode struct {
+	Identify CallerResolver					//who is calling, nil reads it from the caller's certificate
+}
+
+var errUnknownInvoke = errors.New("Received unknown function invocation")
+var errUnknownQuery = errors.New("Received unknown function query")
+
+var marbleIndexStr = "_marbleindex"				//legacy list of all known marbles, replaced by the ownership index
+var openTradesStr = "_opentrades"				//legacy document of all open trades, replaced by one record per trade
+
+type Marble struct{
+	Name string `json:"name"`					//the fieldtags are needed to keep case from bouncing around
+	Color string `json:"color"`
+	Size int `json:"size"`
+	User string `json:"user"`
+}
+
+type Description struct{
+	Color string `json:"color"`
+	Size int `json:"size"`
+	Quantity int `json:"quantity,omitempty"`	//bundle trades only, how many of this kind
+}
+
+type AnOpenTrade struct{
+	ID string `json:"id"`						//derived from the transaction that opened it
+	User string `json:"user"`					//user who created the open trade order
+	Timestamp int64 `json:"timestamp"`			//utc timestamp of creation, from the transaction, for display
+	ExpiresAt int64 `json:"expires_at,omitempty"`	//utc ms, 0 never expires, see purge_expired_trades
+	Want Description  `json:"want"`				//description of desired marble
+	Willing []Description `json:"willing"`		//array of marbles willing to trade away
+	Wants []Description `json:"wants,omitempty"`	//bundle trades want all of these instead of Want, see bundles.go
+	Gives []Description `json:"gives,omitempty"`	//and hand over all of these instead of one of Willing
+	Escrow []string `json:"escrow,omitempty"`		//marbles locked for this trade, Willing lists what they are, see escrow.go
+}
+
+type AllTrades struct{
+	OpenTrades []AnOpenTrade `json:"open_trades"`
+}
+
+// ============================================================================================================================
+// Init - set up the chaincode's keys that are missing, safe to run again on upgrade, see reset to start over
+// ============================================================================================================================
+func (t *Chaincode) Init(stub ChaincodeState, args []string) ([]byte, error) {
+	var Aval int
+	var err error
+
+	args, err = requestArgs(args, &InitRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting 1")
+	}
+
+	// Initialize the chaincode
+	Aval, err = strconv.Atoi(args[0])
+	if err != nil {
+		return nil, argError("Expecting integer value for asset holding")
+	}
+
+	// Write the state to the ledger
+	key, err := ledger.UserKey("abc")
+	if err != nil {
+		return nil, err
+	}
+	valAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state for abc")
+	}
+	if valAsBytes != nil {													//set up by an earlier init, leave it be
+		return nil, nil
+	}
+	err = stub.PutState(key, []byte(strconv.Itoa(Aval)))				//making a test var "abc", I find it handy to read/write to it right away to test the network
+	if err != nil {
+		return nil, err
+	}
+	
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Invoke - run an invocation, then write what it changed and send the events it raised
+// ============================================================================================================================
+func (t *Chaincode) Invoke(stub ChaincodeState, function string, args []string) ([]byte, error) {
+	events := newEventBuffer(stub)											//events only go out if the invocation succeeds
+	batch := ledger.NewBatch(events)										//reads see this invocation's writes on every peer, cleanTrades needs that
+	res, err := t.route(batch, function, args)
+	if err != nil {
+		return nil, err
+	}
+	err = batch.Commit()
+	if err != nil {
+		return nil, err
+	}
+	err = events.flush()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ============================================================================================================================
+// Call - run a query or an invocation by name, for peers that send both through Invoke
+// ============================================================================================================================
+func (t *Chaincode) Call(stub ChaincodeState, function string, args []string) ([]byte, error) {
+	res, err := t.Query(stub, function, args)								//queries only read, so trying one first is harmless
+	if err != errUnknownQuery {
+		return res, err
+	}
+	return t.Invoke(stub, function, args)
+}
+
+// ============================================================================================================================
+// ErrorStatus - the status a peer that answers with one should give err, see RequestError
+// ============================================================================================================================
+func ErrorStatus(err error) int {
+	if err == errUnknownInvoke || err == errUnknownQuery {
+		return ledger.StatusBadRequest
+	}
+	if _, ok := err.(ValidationError); ok {
+		return ledger.StatusBadRequest
+	}
+	return ledger.ErrorStatus(err)
+}
+
+// ============================================================================================================================
+// route - hand an invocation to its handler
+// ============================================================================================================================
+func (t *Chaincode) route(stub ChaincodeState, function string, args []string) ([]byte, error) {
+	fmt.Println("invoke is running " + function)
+
+	// Handle different functions
+	if function == "init" {													//initialize the chaincode state, only adds what is missing
+		return t.Init(stub, args)
+	} else if function == "reset" {											//delete everything the chaincode stored, admin only
+		return t.reset(stub, args)
+	} else if function == "delete" {										//deletes an entity from its state
+		res, err := t.Delete(stub, args)
+		if err != nil {
+			return nil, err
+		}
+		return res, cleanTrades(stub)										//lets make sure all open trades are still valid
+	} else if function == "write" {											//writes a value to the chaincode state
+		return t.Write(stub, args)
+	} else if function == "init_marble" {									//create a new marble
+		return t.init_marble(stub, args)
+	} else if function == "set_user" {										//change owner of a marble
+		res, err := t.set_user(stub, args)
+		if err != nil {
+			return nil, err
+		}
+		return res, cleanTrades(stub)										//lets make sure all open trades are still valid
+	} else if function == "open_trade" {									//create a new trade order
+		return t.open_trade(stub, args)
+	} else if function == "open_escrow_trade" {								//create a trade order for named marbles, locking them
+		return t.open_escrow_trade(stub, args)
+	} else if function == "open_bundle_trade" {								//create a trade order for several marbles at once
+		return t.open_bundle_trade(stub, args)
+	} else if function == "perform_trade" {									//forfill an open trade order
+		res, err := t.perform_trade(stub, args)
+		if err != nil {
+			return nil, err													//nothing moved, leave the other trades alone
+		}
+		return res, cleanTrades(stub)										//lets clean just in case
+	} else if function == "remove_trade" {									//cancel an open trade order
+		return t.remove_trade(stub, args)
+	} else if function == "purge_expired_trades" {							//remove open trades that have expired, a batch at a time
+		return t.purge_expired_trades(stub, args)
+	} else if function == "offer_marble" {									//propose giving a marble to someone
+		return t.offer_marble(stub, args)
+	} else if function == "accept_marble" {									//take a marble offered to you
+		res, err := t.accept_marble(stub, args)
+		if err != nil {
+			return nil, err
+		}
+		return res, cleanTrades(stub)										//lets make sure all open trades are still valid
+	} else if function == "reject_marble" {									//turn down a marble offered to you
+		return t.reject_marble(stub, args)
+	} else if function == "migrate_marble_index" {							//build the ownership index from _marbleindex
+		return t.migrate_marble_index(stub, args)
+	} else if function == "migrate_open_trades" {							//split _opentrades into one record per trade
+		return t.migrate_open_trades(stub, args)
+	} else if function == "migrate_keyspace" {								//move records from flat keys to typed ones, see keys.go
+		return t.migrate_keyspace(stub, args)
+	} else if function == "ecrire" {										//writes a value to the chaincode state
+		return t.Ecrire(stub, args)
+	} else if function == "set_note" {										//keep a value only you can change
+		return t.set_note(stub, args)
+	} else if function == "delete_note" {									//remove one of your notes
+		return t.delete_note(stub, args)
+	}
+	fmt.Println("invoke did not find func: " + function)					//error
+
+	return nil, errUnknownInvoke
+}
+
+// ============================================================================================================================
+// Query - route a query to its handler
+// ============================================================================================================================
+func (t *Chaincode) Query(stub ChaincodeState, function string, args []string) ([]byte, error) {
+	fmt.Println("query is running " + function)
+
+	// Handle different functions
+	if function == "read" {													//read a variable
+		return t.read(stub, args)
+	} else if function == "open_trades" {									//list all open trades
+		return t.open_trades(stub, args)
+	} else if function == "trades_by_user" {								//list open trades opened by a user
+		return t.trades_by_user(stub, args)
+	} else if function == "trades_wanting" {								//list open trades that want a color and size
+		return t.trades_wanting(stub, args)
+	} else if function == "validate_records" {								//report stored marbles and trades that don't decode
+		return t.validate_records(stub, args)
+	} else if function == "pending_offers" {								//offers made to and by a user
+		return t.pending_offers(stub, args)
+	} else if function == "get_note" {										//read one note
+		return t.get_note(stub, args)
+	} else if function == "notes_by_owner" {								//list a user's notes
+		return t.notes_by_owner(stub, args)
+	} else if function == "marble_history" {								//chain of custody for a marble
+		return t.marble_history(stub, args)
+	} else if function == "list_marbles" {									//list all marbles, a page at a time
+		return t.list_marbles(stub, args)
+	} else if function == "marbles_by_owner" {								//list a user's marbles
+		return t.marbles_by_owner(stub, args)
+	} else if function == "marbles_by_color" {								//list marbles of a color
+		return t.marbles_by_color(stub, args)
+	} else if function == "marbles_by_size_range" {							//list marbles between two sizes
+		return t.marbles_by_size_range(stub, args)
+	}
+	fmt.Println("query did not find func: " + function)						//error
+
+	return nil, errUnknownQuery
+}
+
+// ============================================================================================================================
+// Read - read a variable from chaincode state, a marble, a written value or for a reserved name a chaincode document
+// ============================================================================================================================
+func (t *Chaincode) read(stub ChaincodeState, args []string) ([]byte, error) {
+	var name, jsonResp string
+	var err error
+
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting name of the var to query")
+	}
+
+	name = args[0]
+	key, err := readKey(stub, name)											//see keys.go
+	if err != nil {
+		return nil, err
+	}
+	valAsbytes, err := stub.GetState(key)									//get the var from chaincode state
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + name + "\"}"
+		return nil, errors.New(jsonResp)
+	}
+
+	return valAsbytes, nil													//send it onward
+}
+
+// ============================================================================================================================
+// Delete - remove a marble, or a value from write when there is no marble by that name, admin only
+// ============================================================================================================================
+func (t *Chaincode) Delete(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &NameRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting 1")
+	}
+	
+	err = t.requireAdmin(stub, "delete raw state")							//users keep their own values with set_note
+	if err != nil {
+		return nil, err
+	}
+	name := args[0]
+	err = ledger.CheckName("name", name)												//the chaincode's own documents can't be deleted
+	if err != nil {
+		return nil, err
+	}
+	key, err := marbleKey(name)
+	if err != nil {
+		return nil, err
+	}
+	marbleAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	if marbleAsBytes == nil {													//no marble, so it is a written value
+		key, err = ledger.UserKey(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res, decodeErr := decodeMarble(marbleAsBytes)								//a malformed marble is still removed, just not unindexed
+	if marbleAsBytes != nil {
+		err = checkUnlocked(stub, name, "")										//remove_trade first if an open trade holds it
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = stub.DelState(key)													//remove the key from chaincode state
+	if err != nil {
+		return nil, errors.New("Failed to delete state")
+	}
+
+	if marbleAsBytes != nil && decodeErr == nil && res.Name == name {														//it was a marble, drop it from the ownership index
+		fmt.Println("found marble")
+		err = unindexMarble(stub, res)
+		if err != nil {
+			return nil, err
+		}
+		err = recordCustody(stub, res.Name, "", res.User, "delete")			//history outlives the marble
+		if err != nil {
+			return nil, err
+		}
+		err = dropOffer(stub, res.Name)
+		if err != nil {
+			return nil, err
+		}
+		err = emitEvent(stub, marbleDeletedEvent, EventPayload{Marbles: []string{res.Name}, Users: []string{res.User}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, t.auditRaw(stub, stateDeletedEvent, name)
+}
+
+// ============================================================================================================================
+// Write - write variable into chaincode state, admin only
+// ============================================================================================================================
+func (t *Chaincode) Write(stub ChaincodeState, args []string) ([]byte, error) {
+	var name, value string // Entities
+	var err error
+	fmt.Println("running write()")
+
+	args, err = requestArgs(args, &WriteRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, argError("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
+	}
+
+	err = t.requireAdmin(stub, "write raw state")							//users keep their own values with set_note
+	if err != nil {
+		return nil, err
+	}
+	name = args[0]															//rename for funsies
+	value = args[1]
+	key, err := ledger.WriteKey(name)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(key, []byte(value))									//write the variable into the chaincode state
+	if err != nil {
+		return nil, err
+	}
+	return nil, t.auditRaw(stub, stateWrittenEvent, name)
+}
+
+// ============================================================================================================================
+// Ecrire - Prepend 9999: and write variable into chaincode state, admin only
+// ============================================================================================================================
+func (t *Chaincode) Ecrire(stub ChaincodeState, args []string) ([]byte, error) {
+	var name, value string // Entities
+	var err error
+	fmt.Println("running Ecrire()")
+
+	args, err = requestArgs(args, &WriteRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, argError("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
+	}
+
+	err = t.requireAdmin(stub, "write raw state")							//users keep their own values with set_note
+	if err != nil {
+		return nil, err
+	}
+	name = args[0]															//rename for funsies
+	value = "9999:" + args[1]
+	key, err := ledger.WriteKey(name)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(key, []byte(value))									//write the variable into the chaincode state
+	if err != nil {
+		return nil, err
+	}
+	return nil, t.auditRaw(stub, stateWrittenEvent, name)
+}
+// ============================================================================================================================
+// Init Marble - create a new marble, store into chaincode state
+// ============================================================================================================================
+func (t *Chaincode) init_marble(stub ChaincodeState, args []string) ([]byte, error) {
+	var err error
+
+	//   0       1       2     3
+	// "asdf", "blue", "35", "bob"
+	args, err = requestArgs(args, &InitMarbleRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 4 {
+		return nil, argError("Incorrect number of arguments. Expecting 4")
+	}
+
+	//input sanitation
+	fmt.Println("- start init marble")
+	err = ledger.CheckName("1st argument", args[0])								//names starting with _ are reserved, see keys.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args[1]) <= 0 {
+		return nil, argError("2nd argument must be a non-empty string")
+	}
+	if len(args[2]) <= 0 {
+		return nil, argError("3rd argument must be a non-empty string")
+	}
+	if len(args[3]) <= 0 {
+		return nil, argError("4th argument must be a non-empty string")
+	}
+	name := args[0]
+	color := strings.ToLower(args[1])
+	user := strings.ToLower(args[3])
+	size, err := strconv.Atoi(args[2])
+	if err != nil || !sizeFits(size) {
+		return nil, argError("3rd argument must be a non-negative numeric string of at most " + strconv.Itoa(sizeDigits) + " digits")
+	}
+
+	//check if marble already exists
+	key, err := marbleKey(name)
+	if err != nil {
+		return nil, err
+	}
+	marbleAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get marble name")
+	}
+	if marbleAsBytes != nil {												//even a malformed record holds the name
+		fmt.Println("This marble arleady exists: " + name)
+		return nil, conflict("This marble arleady exists")				//all stop a marble by this name exists
+	}
+	
+	marble := Marble{Name: name, Color: color, Size: size, User: user}
+	err = putMarble(stub, marble)											//store marble under its typed key
+	if err != nil {
+		return nil, err
+	}
+	
+	err = indexMarble(stub, marble)											//add marble to the ownership index
+	if err != nil {
+		return nil, err
+	}
+	err = recordCustody(stub, name, user, "", "init_marble")				//start its chain of custody
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, marbleCreatedEvent, EventPayload{Marbles: []string{name}, Users: []string{user}})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end init marble")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set User Permission on Marble
+// ============================================================================================================================
+func (t *Chaincode) set_user(stub ChaincodeState, args []string) ([]byte, error) {
+	var err error
+	
+	//   0       1
+	// "name", "bob"
+	args, err = requestArgs(args, &SetUserRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		return nil, argError("Incorrect number of arguments. Expecting 2")
+	}
+	
+	fmt.Println("- start set user")
+	fmt.Println(args[0] + " - " + args[1])
+	res, err := getMarble(stub, args[0])									//malformed marbles are refused, see records.go
+	if err != nil {
+		return nil, err
+	}
+	err = t.authorize(stub, res.User, "change the owner of " + args[0])		//only the owner (or an admin) can give a marble away
+	if err != nil {
+		return nil, err
+	}
+	err = checkUnlocked(stub, res.Name, "")									//not while an open trade holds it
+	if err != nil {
+		return nil, err
+	}
+	previous := res.User
+	to := strings.ToLower(args[1])											//owners are kept lowercase like init_marble
+	err = moveMarble(stub, res, to, "set_user")							//reindex, custody and drop the old owner's offer, see bundles.go
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, marbleTransferredEvent, EventPayload{Marbles: []string{res.Name}, Users: []string{previous, to}})
+	if err != nil {
+		return nil, err
+	}
+	
+	fmt.Println("- end set user")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Open Trade - create an open trade for a marble you want with marbles you have 
+// ============================================================================================================================
+func (t *Chaincode) open_trade(stub ChaincodeState, args []string) ([]byte, error) {
+	var err error
+	var will_size int
+	var trade_away Description
+	
+	//	0        1      2     3      4      5       6
+	//["bob", "blue", "16", "red", "16"] *"blue", "35*  *"2016-07-01T00:00:00Z" or "36h"*
+	args, err = requestArgs(args, &OpenTradeRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	expires := ""
+	if len(args)%2 == 0{														//an even count ends with when the trade expires
+		expires = args[len(args) - 1]
+		args = args[:len(args) - 1]
+	}
+	if len(args) < 5 {
+		return nil, argError("Incorrect number of arguments. Expecting at least 5, the user, the wanted color and size, then a color and size for each marble offered, and optionally when the trade expires")
+	}
+
+	size1, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, argError("3rd argument must be a numeric string")
+	}
+	err = t.authorize(stub, args[0], "open a trade")							//you can only offer your own marbles
+	if err != nil {
+		return nil, err
+	}
+
+	open := AnOpenTrade{}
+	open.User = args[0]
+	open.ID, open.Timestamp, err = newTradeID(stub)								//same id on every peer
+	if err != nil {
+		return nil, err
+	}
+	open.ExpiresAt, err = parseExpiry("last argument", expires, open.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	open.Want.Color = args[1]
+	open.Want.Size =  size1
+	fmt.Println("- start open trade")
+
+	for i:=3; i < len(args); i++ {												//create and append each willing trade
+		will_size, err = strconv.Atoi(args[i + 1])
+		if err != nil {
+			msg := "is not a numeric string " + args[i + 1]
+			fmt.Println(msg)
+			return nil, argError(msg)
+		}
+		
+		trade_away = Description{}
+		trade_away.Color = args[i]
+		trade_away.Size =  will_size
+		fmt.Println("! created trade_away: " + args[i])
+		
+		open.Willing = append(open.Willing, trade_away)
+		fmt.Println("! appended willing to open")
+		i++;
+	}
+	
+	err = putTrade(stub, open)													//store the trade under its own key
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, tradeOpenedEvent, EventPayload{Trades: []string{open.ID}, Users: []string{open.User}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end open trade")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Perform Trade - close an open trade and move ownership, all or nothing
+// ============================================================================================================================
+func (t *Chaincode) perform_trade(stub ChaincodeState, args []string) ([]byte, error) {
+	var err error
+	
+	//	0		1					2					3				4					5
+	//[data.id, data.closer.user, data.closer.name, data.opener.user, data.opener.color, data.opener.size]
+	//[data.id, data.closer.user, data.opener.user, data.closer.names...]							bundle trades
+	args, err = requestArgs(args, &PerformTradeRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 4 {
+		return nil, argError("Incorrect number of arguments. Expecting 6, or 4 or more for a bundle trade")
+	}
+	
+	fmt.Println("- start close trade")
+	if len(args[0]) <= 0 {
+		return nil, argError("1st argument must be a non-empty string")
+	}
+	
+	trade, err := getTrade(stub, args[0])															//get the open trade
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("found the trade");
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+	if trade.expired(txTime.UnixNano() / int64(time.Millisecond)) {								//purge_expired_trades will clear it away
+		return nil, argError("open trade " + args[0] + " has expired")
+	}
+	if trade.isBundle() {
+		return t.performBundleTrade(stub, trade, args)												//whole lists change hands, see bundles.go
+	}
+	if len(args) < 6 {
+		return nil, argError("Incorrect number of arguments. Expecting 6")
+	}
+	
+	size, err := strconv.Atoi(args[5])
+	if err != nil {
+		return nil, argError("6th argument must be a numeric string")
+	}
+	
+	// ---- validate everything before touching the ledger ----
+	err = t.authorize(stub, args[1], "close a trade")								//closer gives up a marble, so it must be the closer
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(trade.User) != strings.ToLower(args[3]) {
+		return nil, denied("trade " + args[0] + " was not opened by " + args[3])
+	}
+	
+	closersMarble, err := getMarble(stub, args[2])
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(closersMarble.User) != strings.ToLower(args[1]) {
+		return nil, denied("marble " + args[2] + " is not owned by " + args[1])
+	}
+	err = checkUnlocked(stub, closersMarble.Name, "")								//can't be promised to another trade
+	if err != nil {
+		return nil, err
+	}
+	
+	//verify if marble meets trade requirements
+	if strings.ToLower(closersMarble.Color) != strings.ToLower(trade.Want.Color) || closersMarble.Size != trade.Want.Size {
+		msg := "marble in input does not meet trade requriements"
+		fmt.Println(msg)
+		return nil, argError(msg)
+	}
+	
+	willing := false
+	for _, option := range trade.Willing {															//opener must have offered this kind of marble
+		if strings.ToLower(option.Color) == strings.ToLower(args[4]) && option.Size == size {
+			willing = true
+			break
+		}
+	}
+	if !willing {
+		return nil, argError("opener is not willing to trade a " + args[4] + " marble of size " + args[5])
+	}
+	
+	var marble Marble
+	if len(trade.Escrow) > 0 {
+		marble, err = findEscrowed(stub, trade, args[4], size)										//one of the marbles locked for this trade
+	} else {
+		marble, err = findMarble4Trade(stub, trade.User, args[4], size)								//find a marble that is suitable from opener
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("! no errors, proceeding")
+	
+	// ---- both legs and the trade removal land together, Invoke only commits once all of them succeed ----
+	err = moveMarble(stub, closersMarble, trade.User, "perform_trade")								//closer -> opener, see bundles.go
+	if err != nil {
+		return nil, err
+	}
+	err = moveMarble(stub, marble, args[1], "perform_trade")										//opener -> closer
+	if err != nil {
+		return nil, err
+	}
+	err = deleteTrade(stub, trade)																//remove trade
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, tradePerformedEvent, EventPayload{Trades: []string{tradeID(trade)}, Marbles: []string{closersMarble.Name, marble.Name}, Users: []string{trade.User, args[1]}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end close trade")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// findMarble4Trade - look for a matching marble that this user owns and return it
+// ============================================================================================================================
+func findMarble4Trade(stub ChaincodeState, user string, color string, size int )(m Marble, err error){
+	var fail Marble;
+	fmt.Println("- start find marble 4 trade")
+	fmt.Println("looking for " + user + ", " + color + ", " + strconv.Itoa(size));
+
+	//scan the ownership index for this user, color and size
+	iter, err := ledger.ScanIndex(stub, ownerIndexName, []string{strings.ToLower(user), strings.ToLower(color), strconv.Itoa(size)})
+	if err != nil {
+		return fail, errors.New("Failed to scan marble index")
+	}
+	defer iter.Close()
+	
+	for iter.HasNext() {														//first hit is good enough
+		key, _, err := iter.Next()
+		if err != nil {
+			return fail, errors.New("Failed to read marble index")
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 4 {
+			continue
+		}
+
+		res, err := getMarble(stub, attrs[3])								//grab this marble
+		if err != nil {
+			continue													//gone or malformed, look for another
+		}
+		
+		holder, err := lockedFor(stub, res.Name)
+		if err != nil || holder != "" {
+			continue													//held in escrow for another trade
+		}
+		
+		//index could be stale, double check user && color && size
+		if strings.ToLower(res.User) == strings.ToLower(user) && strings.ToLower(res.Color) == strings.ToLower(color) && res.Size == size{
+			fmt.Println("found a marble: " + res.Name)
+			fmt.Println("! end find marble 4 trade")
+			return res, nil
+		}
+	}
+	
+	fmt.Println("- end find marble 4 trade - error")
+	return fail, conflict("Did not find marble to use in this trade")
+}
+
+// ============================================================================================================================
+// Remove Open Trade - close an open trade
+// ============================================================================================================================
+func (t *Chaincode) remove_trade(stub ChaincodeState, args []string) ([]byte, error) {
+	var err error
+	
+	//	0
+	//[data.id]
+	args, err = requestArgs(args, &TradeIDRequest{})					//or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 1 {
+		return nil, argError("Incorrect number of arguments. Expecting 1")
+	}
+	
+	fmt.Println("- start remove trade")
+	trade, err := getTrade(stub, args[0])																//get the open trade
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("found the trade");
+	err = t.authorize(stub, trade.User, "remove trade " + args[0])										//only the opener (or an admin) can cancel
+	if err != nil {
+		return nil, err
+	}
+	err = deleteTrade(stub, trade)																		//remove this trade
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, tradeRemovedEvent, EventPayload{Trades: []string{tradeID(trade)}, Users: []string{trade.User}})
+	if err != nil {
+		return nil, err
+	}
+	
+	fmt.Println("- end remove trade")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Clean Up Open Trades - make sure open trades are still possible, remove choices that are no longer possible, remove trades that have no valid choices
+// an error here fails the whole invocation, Invoke only commits once every step has succeeded
+// ============================================================================================================================
+func cleanTrades(stub ChaincodeState)(err error){
+	fmt.Println("- start clean trades")
+	
+	trades, err := listTrades(stub)																				//get every open trade record
+	if err != nil {
+		return err
+	}
+	
+	var pruned []string
+	fmt.Println("# trades " + strconv.Itoa(len(trades)))
+	for _, trade := range trades {																				//iter over all the known open trades
+		fmt.Println("looking at trade " + tradeID(trade))
+		
+		if len(trade.Escrow) > 0 {
+			continue																							//its marbles are locked, they can't have left
+		}
+		if trade.isBundle() {																					//a bundle is all or nothing
+			_, e := findBundle(stub, trade.User, trade.Gives)
+			if e == nil {
+				continue
+			}
+			fmt.Println("! opener can no longer cover this bundle, removing trade")
+			err = deleteTrade(stub, trade)
+			if err != nil {
+				return err
+			}
+			pruned = append(pruned, tradeID(trade))
+			continue
+		}
+		
+		var willing []Description
+		for _, option := range trade.Willing {																	//find a marble that is suitable
+			_, e := findMarble4Trade(stub, trade.User, option.Color, option.Size)
+			if(e != nil){
+				fmt.Println("! errors with this option, removing option")
+			}else{
+				willing = append(willing, option)
+			}
+		}
+		
+		if len(willing) == len(trade.Willing) {
+			continue																							//this trade is fine, don't rewrite it
+		}
+		if len(willing) == 0 {
+			fmt.Println("! no more options for this trade, removing trade")
+			err = deleteTrade(stub, trade)
+		} else {
+			fmt.Println("! saving open trade changes")
+			trade.Willing = willing
+			err = putTrade(stub, trade)
+		}
+		if err != nil {
+			return err
+		}
+		pruned = append(pruned, tradeID(trade))
+	}
+
+	if len(pruned) > 0 {
+		err = emitEvent(stub, tradesPrunedEvent, EventPayload{Trades: pruned})
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("- end clean trades")
+	return nil
+}
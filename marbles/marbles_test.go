@@ -0,0 +1,511 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var admin = Caller{User: "admin", Role: "admin"}
+var bob = Caller{User: "bob"}
+var amy = Caller{User: "amy"}
+var carl = Caller{User: "carl"}
+
+// testChain runs a Chaincode over a MemState the way a peer would, every invoke is its own transaction
+type testChain struct {
+	t      *testing.T
+	cc     *Chaincode
+	st     *ledger.MemState
+	caller Caller //who the next call comes from
+	tx     int
+}
+
+// ============================================================================================================================
+// newTestChain - an empty ledger whose first transaction runs at 2016-07-01T00:00:01Z, called by an admin
+// ============================================================================================================================
+func newTestChain(t *testing.T) *testChain {
+	c := &testChain{t: t, st: ledger.NewMemState(), caller: admin}
+	c.cc = &Chaincode{Identify: func(ChaincodeState) (Caller, error) { return c.caller, nil }}
+	c.st.TxTime = time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC)
+	return c
+}
+
+// ============================================================================================================================
+// seedChain - the ledger most tests start from, bob has m1 and an open trade for a red 16, amy has m2, carl has m3
+// ============================================================================================================================
+func seedChain(t *testing.T) *testChain {
+	c := newTestChain(t)
+	c.mustInvoke("init", "100")
+	c.mustInvoke("init_marble", "m1", "blue", "35", "bob")
+	c.mustInvoke("init_marble", "m2", "red", "16", "amy")
+	c.mustInvoke("init_marble", "m3", "green", "5", "carl")
+	c.as(bob).mustInvoke("open_trade", "bob", "red", "16", "blue", "35")
+	c.as(admin)
+	return c
+}
+
+// as - make the next calls as caller
+func (c *testChain) as(caller Caller) *testChain {
+	c.caller = caller
+	return c
+}
+
+// wait - move the clock on, the next transaction runs d after the last one plus its usual second
+func (c *testChain) wait(d time.Duration) {
+	c.st.TxTime = c.st.TxTime.Add(d)
+}
+
+func (c *testChain) invoke(function string, args ...string) ([]byte, error) {
+	c.tx++
+	c.st.TxID = "tx" + strconv.Itoa(c.tx)
+	c.st.TxTime = c.st.TxTime.Add(time.Second)
+	return c.cc.Invoke(c.st, function, args)
+}
+
+func (c *testChain) mustInvoke(function string, args ...string) []byte {
+	c.t.Helper()
+	res, err := c.invoke(function, args...)
+	if err != nil {
+		c.t.Fatalf("%s %q: %s", function, args, err)
+	}
+	return res
+}
+
+func (c *testChain) query(function string, args ...string) ([]byte, error) {
+	return c.cc.Query(c.st, function, args)
+}
+
+// mustQuery - run a query and decode its JSON answer into v
+func (c *testChain) mustQuery(v interface{}, function string, args ...string) {
+	c.t.Helper()
+	res, err := c.query(function, args...)
+	if err != nil {
+		c.t.Fatalf("%s %q: %s", function, args, err)
+	}
+	err = json.Unmarshal(res, v)
+	if err != nil {
+		c.t.Fatalf("%s %q answered %q: %s", function, args, res, err)
+	}
+}
+
+// marble - the stored marble, nil when there is none
+func (c *testChain) marble(name string) *Marble {
+	c.t.Helper()
+	res, err := getMarble(c.st, name)
+	if err != nil {
+		return nil
+	}
+	return &res
+}
+
+// owner - who owns a marble, empty when it doesn't exist
+func (c *testChain) owner(name string) string {
+	c.t.Helper()
+	if res := c.marble(name); res != nil {
+		return res.User
+	}
+	return ""
+}
+
+// trades - every open trade
+func (c *testChain) trades() []AnOpenTrade {
+	c.t.Helper()
+	var all AllTrades
+	c.mustQuery(&all, "open_trades")
+	return all.OpenTrades
+}
+
+// tradeID - the id of the only open trade
+func (c *testChain) tradeID() string {
+	c.t.Helper()
+	trades := c.trades()
+	if len(trades) != 1 {
+		c.t.Fatalf("%d open trades, want 1", len(trades))
+	}
+	return trades[0].ID
+}
+
+// events - the names of the events raised so far
+func (c *testChain) events() []string {
+	names := []string{}
+	for _, event := range c.st.Events {
+		names = append(names, event.Name)
+	}
+	return names
+}
+
+// withTrade - swap the open trade's id into args wherever "$trade" appears
+func (c *testChain) withTrade(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if strings.Contains(arg, "$trade") {
+			arg = strings.Replace(arg, "$trade", c.tradeID(), -1)
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// ============================================================================================================================
+// TestInvoke - every invoke function, run against a fresh seedChain
+// ============================================================================================================================
+func TestInvoke(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(c *testChain) //runs as admin before the call
+		caller   Caller
+		function string
+		args     []string
+		status   int //ErrorStatus of the error, 0 when the call must succeed
+		check    func(t *testing.T, c *testChain)
+	}{
+		{"init again keeps abc", nil, admin, "init", []string{"5"}, 0, func(t *testing.T, c *testChain) {
+			if value, _ := c.query("read", "abc"); string(value) != "100" {
+				t.Errorf("abc = %q, want 100", value)
+			}
+		}},
+		{"init not a number", nil, admin, "init", []string{"lots"}, 400, nil},
+		{"init json", nil, admin, "init", []string{`{"value":5}`}, 0, nil},
+		{"init no value", nil, admin, "init", nil, 400, nil},
+
+		{"reset", nil, admin, "reset", []string{"RESET"}, 0, func(t *testing.T, c *testChain) {
+			if c.marble("m1") != nil || len(c.trades()) != 0 {
+				t.Error("reset left marbles or trades behind")
+			}
+		}},
+		{"reset unconfirmed", nil, admin, "reset", []string{"yes"}, 400, nil},
+		{"reset by a user", nil, bob, "reset", []string{"RESET"}, 403, nil},
+
+		{"delete", nil, admin, "delete", []string{"m1"}, 0, func(t *testing.T, c *testChain) {
+			if c.marble("m1") != nil {
+				t.Error("m1 still exists")
+			}
+			if len(c.trades()) != 0 {
+				t.Error("bob's trade outlived the only marble it offered")
+			}
+		}},
+		{"delete by a user", nil, bob, "delete", []string{"m1"}, 403, nil},
+		{"delete a chaincode document", nil, admin, "delete", []string{"_marbleindex"}, 400, nil},
+		{"delete no name", nil, admin, "delete", nil, 400, nil},
+
+		{"write", nil, admin, "write", []string{"hello", "world"}, 0, func(t *testing.T, c *testChain) {
+			if value, _ := c.query("read", "hello"); string(value) != "world" {
+				t.Errorf("hello = %q, want world", value)
+			}
+		}},
+		{"write by a user", nil, bob, "write", []string{"hello", "world"}, 403, nil},
+		{"write one argument", nil, admin, "write", []string{"hello"}, 400, nil},
+		{"ecrire", nil, admin, "ecrire", []string{"bonjour", "monde"}, 0, func(t *testing.T, c *testChain) {
+			if value, _ := c.query("read", "bonjour"); string(value) != "9999:monde" {
+				t.Errorf("bonjour = %q, want 9999:monde", value)
+			}
+		}},
+		{"ecrire by a user", nil, bob, "ecrire", []string{"bonjour", "monde"}, 403, nil},
+
+		{"init_marble", nil, bob, "init_marble", []string{"m4", "Blue", "10", "bob"}, 0, func(t *testing.T, c *testChain) {
+			want := Marble{Name: "m4", Color: "blue", Size: 10, User: "bob"}
+			if res := c.marble("m4"); res == nil || *res != want {
+				t.Errorf("m4 = %v, want %v", res, want)
+			}
+		}},
+		{"init_marble taken name", nil, bob, "init_marble", []string{"m1", "blue", "10", "bob"}, 409, nil},
+		{"init_marble size", nil, bob, "init_marble", []string{"m4", "blue", "big", "bob"}, 400, nil},
+		{"init_marble largest size", nil, bob, "init_marble", []string{"m4", "blue", "9999999999", "bob"}, 0, nil},
+		{"init_marble size too long to sort", nil, bob, "init_marble", []string{"m4", "blue", "10000000000", "bob"}, 400, nil},
+		{"init_marble short", nil, bob, "init_marble", []string{"m4", "blue", "10"}, 400, nil},
+
+		{"set_user", nil, bob, "set_user", []string{"m1", "carl"}, 0, func(t *testing.T, c *testChain) {
+			if c.owner("m1") != "carl" {
+				t.Errorf("m1 belongs to %s, want carl", c.owner("m1"))
+			}
+			if len(c.trades()) != 0 {
+				t.Error("bob's trade outlived the only marble it offered")
+			}
+		}},
+		{"set_user by an admin", nil, admin, "set_user", []string{"m1", "carl"}, 0, nil},
+		{"set_user mixed case", nil, bob, "set_user", []string{"m1", "Carl"}, 0, func(t *testing.T, c *testChain) {
+			var page MarblePage
+			c.mustQuery(&page, "marbles_by_owner", "carl")
+			if c.owner("m1") != "carl" || len(page.Marbles) != 2 {
+				t.Errorf("m1 belongs to %s and carl's marbles are %v", c.owner("m1"), page.Marbles)
+			}
+		}},
+		{"set_user someone else's", nil, amy, "set_user", []string{"m1", "amy"}, 403, nil},
+		{"set_user missing marble", nil, bob, "set_user", []string{"m9", "amy"}, 404, nil},
+		{"set_user short", nil, bob, "set_user", []string{"m1"}, 400, nil},
+
+		{"open_trade", nil, amy, "open_trade", []string{"amy", "blue", "35", "red", "16", "36h"}, 0, func(t *testing.T, c *testChain) {
+			var mine AllTrades
+			c.mustQuery(&mine, "trades_by_user", "amy")
+			if len(mine.OpenTrades) != 1 || mine.OpenTrades[0].ExpiresAt == 0 {
+				t.Errorf("amy's trades = %v", mine.OpenTrades)
+			}
+		}},
+		{"open_trade for someone else", nil, amy, "open_trade", []string{"bob", "blue", "35", "red", "16"}, 403, nil},
+		{"open_trade nothing offered", nil, amy, "open_trade", []string{"amy", "blue", "35"}, 400, nil},
+		{"open_trade bad expiry", nil, amy, "open_trade", []string{"amy", "blue", "35", "red", "16", "soon"}, 400, nil},
+
+		{"open_escrow_trade", nil, amy, "open_escrow_trade", []string{"amy", "blue", "35", "", "m2"}, 0, func(t *testing.T, c *testChain) {
+			if holder, _ := lockedFor(c.st, "m2"); holder == "" {
+				t.Error("m2 is not held in escrow")
+			}
+		}},
+		{"open_escrow_trade someone else's marble", nil, amy, "open_escrow_trade", []string{"amy", "blue", "35", "", "m1"}, 403, nil},
+		{"open_escrow_trade for someone else", nil, amy, "open_escrow_trade", []string{"bob", "red", "16", "", "m1"}, 403, nil},
+		{"open_escrow_trade no marbles", nil, amy, "open_escrow_trade", []string{"amy", "blue", "35", ""}, 400, nil},
+
+		{"open_bundle_trade", nil, amy, "open_bundle_trade", []string{"amy", "1", "blue", "35", "1", "red", "16", "1"}, 0, func(t *testing.T, c *testChain) {
+			var mine AllTrades
+			c.mustQuery(&mine, "trades_by_user", "amy")
+			if len(mine.OpenTrades) != 1 || len(mine.OpenTrades[0].Gives) != 1 {
+				t.Errorf("amy's trades = %v", mine.OpenTrades)
+			}
+		}},
+		{"open_bundle_trade more than amy has", nil, amy, "open_bundle_trade", []string{"amy", "1", "blue", "35", "1", "red", "16", "2"}, 409, nil},
+		{"open_bundle_trade nothing given", nil, amy, "open_bundle_trade", []string{"amy", "1", "blue", "35", "1"}, 400, nil},
+
+		{"perform_trade", nil, amy, "perform_trade", []string{"$trade", "amy", "m2", "bob", "blue", "35"}, 0, func(t *testing.T, c *testChain) {
+			if c.owner("m1") != "amy" || c.owner("m2") != "bob" {
+				t.Errorf("m1 belongs to %s and m2 to %s, want amy and bob", c.owner("m1"), c.owner("m2"))
+			}
+			if len(c.trades()) != 0 {
+				t.Error("the trade is still open")
+			}
+		}},
+		{"perform_trade for someone else", nil, bob, "perform_trade", []string{"$trade", "amy", "m2", "bob", "blue", "35"}, 403, nil},
+		{"perform_trade wrong marble", nil, admin, "perform_trade", []string{"$trade", "carl", "m3", "bob", "blue", "35"}, 400, nil},
+		{"perform_trade missing trade", nil, amy, "perform_trade", []string{"nope", "amy", "m2", "bob", "blue", "35"}, 404, nil},
+		{"perform_trade short", nil, amy, "perform_trade", []string{"$trade", "amy"}, 400, nil},
+
+		{"remove_trade", nil, bob, "remove_trade", []string{"$trade"}, 0, func(t *testing.T, c *testChain) {
+			if len(c.trades()) != 0 {
+				t.Error("the trade is still open")
+			}
+		}},
+		{"remove_trade someone else's", nil, amy, "remove_trade", []string{"$trade"}, 403, nil},
+		{"remove_trade missing", nil, bob, "remove_trade", []string{"nope"}, 404, nil},
+
+		{"purge_expired_trades nothing expired", nil, amy, "purge_expired_trades", nil, 0, func(t *testing.T, c *testChain) {
+			if len(c.trades()) != 1 {
+				t.Error("purge removed a trade that never expires")
+			}
+		}},
+		{"purge_expired_trades bad limit", nil, amy, "purge_expired_trades", []string{"many"}, 400, nil},
+
+		{"offer_marble", nil, bob, "offer_marble", []string{"m1", "amy", "1h"}, 0, func(t *testing.T, c *testChain) {
+			var offers UserOffers
+			c.mustQuery(&offers, "pending_offers", "amy")
+			if len(offers.Incoming) != 1 || offers.Incoming[0].ExpiresAt != offers.Incoming[0].OfferedAt+3600000 {
+				t.Errorf("amy's offers = %v", offers)
+			}
+		}},
+		{"offer_marble someone else's", nil, amy, "offer_marble", []string{"m1", "amy"}, 403, nil},
+		{"offer_marble bad expiry", nil, bob, "offer_marble", []string{"m1", "amy", "later"}, 400, nil},
+
+		{"accept_marble", func(c *testChain) { c.as(bob).mustInvoke("offer_marble", "m1", "amy") }, amy, "accept_marble", []string{"m1"}, 0, func(t *testing.T, c *testChain) {
+			if c.owner("m1") != "amy" {
+				t.Errorf("m1 belongs to %s, want amy", c.owner("m1"))
+			}
+		}},
+		{"accept_marble offered to someone else", func(c *testChain) { c.as(bob).mustInvoke("offer_marble", "m1", "amy") }, bob, "accept_marble", []string{"m1"}, 403, nil},
+		{"accept_marble not offered", nil, amy, "accept_marble", []string{"m1"}, 404, nil},
+
+		{"reject_marble", func(c *testChain) { c.as(bob).mustInvoke("offer_marble", "m1", "amy") }, amy, "reject_marble", []string{"m1"}, 0, func(t *testing.T, c *testChain) {
+			var offers UserOffers
+			c.mustQuery(&offers, "pending_offers", "amy")
+			if len(offers.Incoming) != 0 || c.owner("m1") != "bob" {
+				t.Errorf("amy's offers = %v, m1 belongs to %s", offers, c.owner("m1"))
+			}
+		}},
+		{"reject_marble offered to someone else", func(c *testChain) { c.as(bob).mustInvoke("offer_marble", "m1", "amy") }, bob, "reject_marble", []string{"m1"}, 403, nil},
+
+		{"migrate_marble_index", nil, admin, "migrate_marble_index", nil, 0, nil},
+		{"migrate_marble_index by a user", nil, bob, "migrate_marble_index", nil, 403, nil},
+		{"migrate_open_trades", nil, admin, "migrate_open_trades", []string{`{}`}, 0, nil},
+		{"migrate_open_trades by a user", nil, bob, "migrate_open_trades", nil, 403, nil},
+		{"migrate_keyspace", nil, admin, "migrate_keyspace", nil, 0, nil},
+		{"migrate_keyspace by a user", nil, bob, "migrate_keyspace", nil, 403, nil},
+		{"migrate_keyspace bad limit", nil, admin, "migrate_keyspace", []string{`{"limit":0}`}, 400, nil},
+
+		{"set_note", nil, bob, "set_note", []string{"fav", "blue"}, 0, func(t *testing.T, c *testChain) {
+			var note Note
+			c.mustQuery(&note, "get_note", "fav")
+			if note.Owner != "bob" || note.Value != "blue" {
+				t.Errorf("fav = %v", note)
+			}
+		}},
+		{"set_note someone else's", func(c *testChain) { c.as(amy).mustInvoke("set_note", "fav", "red") }, bob, "set_note", []string{"fav", "blue"}, 403, nil},
+		{"delete_note", func(c *testChain) { c.as(bob).mustInvoke("set_note", "fav", "blue") }, bob, "delete_note", []string{"fav"}, 0, func(t *testing.T, c *testChain) {
+			if _, err := c.query("get_note", "fav"); err == nil {
+				t.Error("fav still exists")
+			}
+		}},
+		{"delete_note someone else's", func(c *testChain) { c.as(bob).mustInvoke("set_note", "fav", "blue") }, amy, "delete_note", []string{"fav"}, 403, nil},
+
+		{"unknown function", nil, admin, "steal", nil, 400, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			args := c.withTrade(tt.args)
+			before := len(c.st.State)
+			_, err := c.as(tt.caller).invoke(tt.function, args...)
+			if tt.status == 0 && err != nil {
+				t.Fatalf("%s %q: %s", tt.function, args, err)
+			}
+			if tt.status != 0 {
+				if err == nil {
+					t.Fatalf("%s %q succeeded, want a %d", tt.function, args, tt.status)
+				}
+				if ErrorStatus(err) != tt.status {
+					t.Fatalf("%s %q: %s, status %d, want %d", tt.function, args, err, ErrorStatus(err), tt.status)
+				}
+				if len(c.st.State) != before {
+					t.Fatalf("%s %q failed but changed the ledger", tt.function, args)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+// ============================================================================================================================
+// TestQuery - every query function, run against a seedChain with some history
+// ============================================================================================================================
+func TestQuery(t *testing.T) {
+	c := seedChain(t)
+	c.as(bob).mustInvoke("offer_marble", "m1", "amy")
+	c.as(bob).mustInvoke("set_note", "fav", "blue")
+	c.as(amy).mustInvoke("set_user", "m2", "carl")
+
+	var marble Marble
+	var trades AllTrades
+	var page MarblePage
+	var offers UserOffers
+	var note Note
+	var notes []Note
+	var history []CustodyRecord
+	var report RecordReport
+	tests := []struct {
+		name     string
+		function string
+		args     []string
+		status   int             //ErrorStatus of the error, 0 when the query must succeed
+		want     interface{}     //decode the answer into this
+		check    func() []string //problems with want, if any
+	}{
+		{"read marble", "read", []string{"m1"}, 0, &marble, func() []string {
+			return expect(marble.User == "bob", "m1 belongs to "+marble.User)
+		}},
+		{"read missing", "read", []string{"m9"}, 0, nil, nil},
+		{"read no name", "read", nil, 400, nil, nil},
+		{"open_trades", "open_trades", nil, 0, &trades, func() []string {
+			return expect(len(trades.OpenTrades) == 1, "want bob's trade")
+		}},
+		{"trades_by_user", "trades_by_user", []string{"BOB"}, 0, &trades, func() []string {
+			return expect(len(trades.OpenTrades) == 1 && trades.OpenTrades[0].User == "bob", "want bob's trade")
+		}},
+		{"trades_by_user nobody", "trades_by_user", []string{"amy"}, 0, &trades, func() []string {
+			return expect(len(trades.OpenTrades) == 0, "amy has no trades")
+		}},
+		{"trades_wanting", "trades_wanting", []string{"red", "16"}, 0, &trades, func() []string {
+			return expect(len(trades.OpenTrades) == 1, "bob wants a red 16")
+		}},
+		{"trades_wanting size", "trades_wanting", []string{"red", "big"}, 400, nil, nil},
+		{"validate_records", "validate_records", nil, 0, &report, func() []string {
+			return expect(report.Checked == 4 && len(report.Problems) == 0, "want 3 clean marbles and a clean trade")
+		}},
+		{"pending_offers", "pending_offers", []string{"bob"}, 0, &offers, func() []string {
+			return expect(len(offers.Outgoing) == 1 && len(offers.Incoming) == 0, "bob offered m1")
+		}},
+		{"pending_offers no user", "pending_offers", nil, 400, nil, nil},
+		{"get_note", "get_note", []string{"fav"}, 0, &note, func() []string {
+			return expect(note.Value == "blue", "fav = "+note.Value)
+		}},
+		{"get_note missing", "get_note", []string{"nope"}, 404, nil, nil},
+		{"notes_by_owner", "notes_by_owner", []string{"bob"}, 0, &notes, func() []string {
+			return expect(len(notes) == 1 && notes[0].Key == "fav", "bob has fav")
+		}},
+		{"marble_history", "marble_history", []string{"m2"}, 0, &history, func() []string {
+			return expect(len(history) == 2 && history[1].Owner == "carl" && history[1].PreviousOwner == "amy" && history[1].Reason == "set_user", "m2 was made then given to carl")
+		}},
+		{"marble_history no name", "marble_history", nil, 400, nil, nil},
+		{"list_marbles", "list_marbles", []string{"2"}, 0, &page, func() []string {
+			return expect(len(page.Marbles) == 2 && page.Bookmark != "", "want a full first page")
+		}},
+		{"list_marbles bad bookmark", "list_marbles", []string{"2", "zz"}, 400, nil, nil},
+		{"marbles_by_owner", "marbles_by_owner", []string{"Carl"}, 0, &page, func() []string {
+			return expect(len(page.Marbles) == 2, "carl has m2 and m3")
+		}},
+		{"marbles_by_color", "marbles_by_color", []string{"blue"}, 0, &page, func() []string {
+			return expect(len(page.Marbles) == 1 && page.Marbles[0].Name == "m1", "m1 is the only blue")
+		}},
+		{"marbles_by_size_range", "marbles_by_size_range", []string{"5", "16"}, 0, &page, func() []string {
+			return expect(len(page.Marbles) == 2 && page.Marbles[0].Size == 5, "m3 then m2")
+		}},
+		{"marbles_by_size_range backwards", "marbles_by_size_range", []string{"16", "5"}, 400, nil, nil},
+		{"marbles_by_size_range too long to sort", "marbles_by_size_range", []string{"5", "10000000000"}, 400, nil, nil},
+		{"unknown query", "steal", nil, 400, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := c.query(tt.function, tt.args...)
+			if tt.status != 0 {
+				if ErrorStatus(err) != tt.status {
+					t.Fatalf("%s %q = %v, status %d, want %d", tt.function, tt.args, err, ErrorStatus(err), tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s %q: %s", tt.function, tt.args, err)
+			}
+			if tt.want != nil {
+				err = json.Unmarshal(res, tt.want)
+				if err != nil {
+					t.Fatalf("%s %q answered %q: %s", tt.function, tt.args, res, err)
+				}
+			}
+			if tt.check != nil {
+				for _, problem := range tt.check() {
+					t.Errorf("%s %q answered %s: %s", tt.function, tt.args, res, problem)
+				}
+			}
+		})
+	}
+}
+
+// expect - problem when ok is false
+func expect(ok bool, problem string) []string {
+	if ok {
+		return nil
+	}
+	return []string{problem}
+}
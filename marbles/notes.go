@@ -0,0 +1,108 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// Note a value a user keeps on the ledger, see ledger/notes.go
+type Note = ledger.Note
+
+// ============================================================================================================================
+// Set Note - create a note or change one the caller created
+// ============================================================================================================================
+func (t *Chaincode) set_note(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &WriteRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0        1
+	// "key", "value"
+	if len(args) != 2 {
+		return nil, argError("Incorrect number of arguments. Expecting 2. key of the note and its value")
+	}
+	who, err := t.caller(stub)
+	if err != nil {
+		return nil, err
+	}
+	return nil, ledger.SetNote(stub, who, args[0], args[1])
+}
+
+// ============================================================================================================================
+// Delete Note - remove a note the caller created
+// ============================================================================================================================
+func (t *Chaincode) delete_note(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &NameRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "key"
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting the key of the note")
+	}
+	who, err := t.caller(stub)
+	if err != nil {
+		return nil, err
+	}
+	return nil, ledger.DeleteNote(stub, who, args[0])
+}
+
+// ============================================================================================================================
+// Get Note - read one note
+// ============================================================================================================================
+func (t *Chaincode) get_note(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0
+	// "key"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the key of the note")
+	}
+	note, err := ledger.GetNote(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		return nil, notFound("note " + args[0] + " does not exist")
+	}
+	return json.Marshal(note)
+}
+
+// ============================================================================================================================
+// Notes By Owner - every note a user created
+// ============================================================================================================================
+func (t *Chaincode) notes_by_owner(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0
+	// "bob"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the owner")
+	}
+	notes, err := ledger.NotesByOwner(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(notes)
+}
@@ -0,0 +1,382 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var offerObject = "offer"                    //offer~<marble> holds the one pending MarbleOffer for a marble
+var offerToIndexName = "offer~to~marble"     //pending offers by the user they are made to
+var offerFromIndexName = "offer~from~marble" //pending offers by the owner who made them
+
+// MarbleOffer an owner's proposal to give a marble to someone, nothing moves until they accept
+type MarbleOffer struct {
+	Marble    string `json:"marble"`
+	From      string `json:"from"` //owner when the offer was made, the offer is void once that changes
+	To        string `json:"to"`
+	OfferedAt int64  `json:"offered_at"`           //utc ms, from the transaction
+	ExpiresAt int64  `json:"expires_at,omitempty"` //utc ms, 0 never expires
+	TxID      string `json:"tx_id"`
+}
+
+// UserOffers the pending offers a user is involved in
+type UserOffers struct {
+	Incoming []MarbleOffer `json:"incoming"` //made to the user
+	Outgoing []MarbleOffer `json:"outgoing"` //made by the user
+}
+
+// ============================================================================================================================
+// offerKeys - the record key followed by the index keys for an offer
+// ============================================================================================================================
+func offerKeys(offer MarbleOffer) ([]string, error) {
+	record, err := ledger.CreateCompositeKey(offerObject, []string{offer.Marble})
+	if err != nil {
+		return nil, err
+	}
+	byTo, err := ledger.CreateCompositeKey(offerToIndexName, []string{offer.To, offer.Marble})
+	if err != nil {
+		return nil, err
+	}
+	byFrom, err := ledger.CreateCompositeKey(offerFromIndexName, []string{offer.From, offer.Marble})
+	if err != nil {
+		return nil, err
+	}
+	return []string{record, byTo, byFrom}, nil
+}
+
+// ============================================================================================================================
+// getOffer - read the pending offer for a marble, nil if there is none
+// ============================================================================================================================
+func getOffer(stub ChaincodeState, name string) (*MarbleOffer, error) {
+	key, err := ledger.CreateCompositeKey(offerObject, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	offerAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, errors.New("Failed to get offer for " + name)
+	}
+	if offerAsBytes == nil {
+		return nil, nil
+	}
+	var offer MarbleOffer
+	err = json.Unmarshal(offerAsBytes, &offer)
+	if err != nil {
+		return nil, errors.New("offer for " + name + " is malformed - " + err.Error())
+	}
+	return &offer, nil
+}
+
+// ============================================================================================================================
+// putOffer - store an offer and its index entries
+// ============================================================================================================================
+func putOffer(stub ChaincodeState, offer MarbleOffer) error {
+	keys, err := offerKeys(offer)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(offer)
+	err = stub.PutState(keys[0], jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys[1:] {
+		err = stub.PutState(key, indexValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// dropOffer - forget the pending offer for a marble, if any, call it whenever the marble changes hands
+// ============================================================================================================================
+func dropOffer(stub ChaincodeState, name string) error {
+	offer, err := getOffer(stub, name)
+	if err != nil || offer == nil {
+		return err
+	}
+	keys, err := offerKeys(*offer)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// expired - true if the offer had run out by now
+// ============================================================================================================================
+func (o MarbleOffer) expired(now int64) bool {
+	return o.ExpiresAt != 0 && now >= o.ExpiresAt
+}
+
+// ============================================================================================================================
+// offersFromIndex - the offers listed under an index prefix, skipping ones that ran out before asOf (0 keeps them all)
+// ============================================================================================================================
+func offersFromIndex(stub ChaincodeState, indexName string, user string, asOf int64) ([]MarbleOffer, error) {
+	iter, err := ledger.ScanIndex(stub, indexName, []string{user})
+	if err != nil {
+		return nil, errors.New("Failed to scan offers")
+	}
+	defer iter.Close()
+
+	offers := []MarbleOffer{}
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read offers")
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 2 {
+			continue
+		}
+		offer, err := getOffer(stub, attrs[1])
+		if err != nil || offer == nil {
+			fmt.Println("! skipping offer for " + attrs[1]) //index entry outlived its offer, or the record is malformed
+			continue
+		}
+		if asOf != 0 && offer.expired(asOf) {
+			continue
+		}
+		offers = append(offers, *offer)
+	}
+	return offers, nil
+}
+
+// ============================================================================================================================
+// Offer Marble - propose giving a marble to another user, they have to accept before it moves
+// ============================================================================================================================
+func (t *Chaincode) offer_marble(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &OfferMarbleRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0        1              2*
+	// "asdf", "alice", "2016-07-01T00:00:00Z" or "36h"
+	if len(args) < 2 || len(args) > 3 {
+		return nil, argError("Incorrect number of arguments. Expecting 2 or 3, the marble, the user it is offered to and optionally when the offer expires")
+	}
+	if len(args[0]) <= 0 {
+		return nil, argError("1st argument must be a non-empty string")
+	}
+	if len(strings.TrimSpace(args[1])) <= 0 {
+		return nil, argError("2nd argument must be a non-empty string")
+	}
+	to := strings.ToLower(strings.TrimSpace(args[1]))
+
+	res, err := getMarble(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = t.authorize(stub, res.User, "offer "+args[0]) //only the owner (or an admin) can offer a marble
+	if err != nil {
+		return nil, err
+	}
+	from := strings.ToLower(res.User)
+	if to == from {
+		return nil, argError(args[0] + " already belongs to " + to)
+	}
+	err = checkUnlocked(stub, res.Name, "") //it is promised to an open trade
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+	offer := MarbleOffer{
+		Marble:    res.Name,
+		From:      from,
+		To:        to,
+		OfferedAt: txTime.UnixNano() / int64(time.Millisecond),
+		TxID:      stub.GetTxID(),
+	}
+	if len(args) == 3 {
+		offer.ExpiresAt, err = parseExpiry("3rd argument", args[2], offer.OfferedAt) //same formats as a trade's expiry
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = dropOffer(stub, res.Name) //a new offer replaces the old one
+	if err != nil {
+		return nil, err
+	}
+	err = putOffer(stub, offer)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, marbleOfferedEvent, EventPayload{Marbles: []string{res.Name}, Users: []string{from, to}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- offered " + res.Name + " to " + to)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// pendingOffer - the offer on a marble the caller may answer, checked against the marble as it is now
+// ============================================================================================================================
+func (t *Chaincode) pendingOffer(stub ChaincodeState, name string, action string) (MarbleOffer, Marble, error) {
+	var res Marble
+	offer, err := getOffer(stub, name)
+	if err != nil {
+		return MarbleOffer{}, res, err
+	}
+	if offer == nil {
+		return MarbleOffer{}, res, notFound("there is no pending offer for " + name)
+	}
+	err = t.authorize(stub, offer.To, action+" "+name) //only the recipient (or an admin) answers an offer
+	if err != nil {
+		return *offer, res, err
+	}
+	res, err = getMarble(stub, name)
+	if err != nil {
+		return *offer, res, err
+	}
+	if strings.ToLower(res.User) != offer.From { //moved some way we did not catch, treat the offer as gone
+		return *offer, res, conflict("the offer for " + name + " is void, it no longer belongs to " + offer.From)
+	}
+	return *offer, res, nil
+}
+
+// ============================================================================================================================
+// Accept Marble - take a marble that was offered to you
+// ============================================================================================================================
+func (t *Chaincode) accept_marble(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &NameRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "asdf"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the marble name")
+	}
+	offer, res, err := t.pendingOffer(stub, args[0], "accept")
+	if err != nil {
+		return nil, err
+	}
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+	if offer.expired(txTime.UnixNano() / int64(time.Millisecond)) {
+		return nil, argError("the offer for " + res.Name + " has expired")
+	}
+	err = checkUnlocked(stub, res.Name, "") //an open trade took hold of it after the offer was made
+	if err != nil {
+		return nil, err
+	}
+
+	err = moveMarble(stub, res, offer.To, "accept_marble") //see bundles.go
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, marbleTransferredEvent, EventPayload{Marbles: []string{res.Name}, Users: []string{offer.From, offer.To}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- " + offer.To + " accepted " + res.Name)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Reject Marble - turn down a marble that was offered to you
+// ============================================================================================================================
+func (t *Chaincode) reject_marble(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &NameRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0
+	// "asdf"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the marble name")
+	}
+	offer, err := getOffer(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if offer == nil {
+		return nil, notFound("there is no pending offer for " + args[0])
+	}
+	err = t.authorize(stub, offer.To, "reject "+args[0]) //an expired or void offer can still be cleared away
+	if err != nil {
+		return nil, err
+	}
+	err = dropOffer(stub, offer.Marble)
+	if err != nil {
+		return nil, err
+	}
+	err = emitEvent(stub, offerRejectedEvent, EventPayload{Marbles: []string{offer.Marble}, Users: []string{offer.From, offer.To}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- " + offer.To + " rejected " + offer.Marble)
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Pending Offers - the live offers made to and by a user
+// ============================================================================================================================
+func (t *Chaincode) pending_offers(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0
+	// "bob"
+	if len(args) != 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the user")
+	}
+	user := strings.ToLower(args[0])
+	var asOf int64
+	txTime, err := stub.GetTxTime()
+	if err == nil { //without a timestamp expired offers are listed too, accept_marble still refuses them
+		asOf = txTime.UnixNano() / int64(time.Millisecond)
+	}
+
+	var offers UserOffers
+	offers.Incoming, err = offersFromIndex(stub, offerToIndexName, user, asOf)
+	if err != nil {
+		return nil, err
+	}
+	offers.Outgoing, err = offersFromIndex(stub, offerFromIndexName, user, asOf)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(offers)
+}
@@ -0,0 +1,176 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// offers - the offers made to and by user
+func (c *testChain) offers(user string) UserOffers {
+	c.t.Helper()
+	var offers UserOffers
+	c.mustQuery(&offers, "pending_offers", user)
+	return offers
+}
+
+func TestOfferExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		ttl    time.Duration //how long after the offer it expires
+		at     time.Time     //or when it expires, neither set never
+		status int
+	}{
+		{"never", []string{"m1", "amy"}, 0, time.Time{}, 0},
+		{"duration", []string{"m1", "amy", "36h"}, 36 * time.Hour, time.Time{}, 0},
+		{"time", []string{`{"name":"m1","to":"amy","expires":"2016-07-01T01:00:00Z"}`}, 0, time.Date(2016, 7, 1, 1, 0, 0, 0, time.UTC), 0},
+		{"not a time", []string{"m1", "amy", "soon"}, 0, time.Time{}, 400},
+		{"negative duration", []string{"m1", "amy", "-1h"}, 0, time.Time{}, 400},
+		{"past", []string{"m1", "amy", "2016-01-01T00:00:00Z"}, 0, time.Time{}, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			_, err := c.as(bob).invoke("offer_marble", tt.args...)
+			if tt.status != 0 {
+				if ErrorStatus(err) != tt.status {
+					t.Fatalf("offer_marble %q = %v, want status %d", tt.args, err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("offer_marble %q: %s", tt.args, err)
+			}
+			offer, _ := getOffer(c.st, "m1")
+			want := int64(0)
+			if tt.ttl != 0 {
+				want = offer.OfferedAt + int64(tt.ttl/time.Millisecond)
+			} else if !tt.at.IsZero() {
+				want = tt.at.UnixNano() / int64(time.Millisecond)
+			}
+			if offer.ExpiresAt != want {
+				t.Fatalf("offer expires at %d, want %d", offer.ExpiresAt, want)
+			}
+		})
+	}
+}
+
+func TestOfferLifecycle(t *testing.T) {
+	c := seedChain(t)
+	c.mustInvoke("init_marble", "m4", "red", "10", "bob")
+	if _, err := c.as(bob).invoke("offer_marble", "m1", "bob"); err == nil {
+		t.Fatal("bob offered m1 to bob")
+	}
+	c.as(bob).mustInvoke("offer_marble", "m1", "Amy")
+	c.as(bob).mustInvoke("offer_marble", "m4", "amy", "30s")
+	if offers := c.offers("amy"); len(offers.Incoming) != 2 || len(offers.Outgoing) != 0 {
+		t.Fatalf("amy's offers = %v", offers)
+	}
+	if offers := c.offers("bob"); len(offers.Outgoing) != 2 {
+		t.Fatalf("bob's offers = %v", offers)
+	}
+	if c.owner("m1") != "bob" {
+		t.Fatal("m1 moved before it was accepted")
+	}
+
+	c.as(amy).mustInvoke("accept_marble", "m1")
+	if c.owner("m1") != "amy" || len(c.offers("amy").Incoming) != 1 {
+		t.Fatalf("m1 belongs to %s, amy's offers = %v", c.owner("m1"), c.offers("amy"))
+	}
+
+	c.wait(time.Minute)
+	if offers := c.offers("amy"); len(offers.Incoming) != 0 {
+		t.Fatalf("amy's offers = %v, the offer on m4 has expired", offers)
+	}
+	if _, err := c.as(amy).invoke("accept_marble", "m4"); ErrorStatus(err) != 400 || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("accepting an expired offer = %v", err)
+	}
+	c.as(amy).mustInvoke("reject_marble", "m4") //an expired offer can still be cleared away
+	if offer, _ := getOffer(c.st, "m4"); offer != nil {
+		t.Fatalf("offer on m4 = %v after reject", offer)
+	}
+}
+
+func TestOfferVoidedWhenTheMarbleMoves(t *testing.T) {
+	tests := []struct {
+		name string
+		move func(c *testChain)
+	}{
+		{"set_user", func(c *testChain) { c.as(bob).mustInvoke("set_user", "m1", "carl") }},
+		{"perform_trade", func(c *testChain) {
+			c.as(amy).mustInvoke("perform_trade", c.tradeID(), "amy", "m2", "bob", "blue", "35")
+		}},
+		{"delete", func(c *testChain) { c.as(admin).mustInvoke("delete", "m1") }},
+		{"another offer", func(c *testChain) { c.as(bob).mustInvoke("offer_marble", "m1", "carl") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			c.as(bob).mustInvoke("offer_marble", "m1", "amy")
+			tt.move(c)
+			if offers := c.offers("amy"); len(offers.Incoming) != 0 {
+				t.Fatalf("amy's offers = %v", offers)
+			}
+			if _, err := c.as(amy).invoke("accept_marble", "m1"); err == nil {
+				t.Fatal("amy accepted a void offer")
+			}
+		})
+	}
+}
+
+func TestTransfersKeepTheSameBookkeeping(t *testing.T) {
+	tests := []struct {
+		name, reason string
+		move         func(c *testChain)
+	}{
+		{"set_user", "set_user", func(c *testChain) { c.as(bob).mustInvoke("set_user", "m1", "Carl") }},
+		{"accept_marble", "accept_marble", func(c *testChain) {
+			c.as(bob).mustInvoke("offer_marble", "m1", "carl")
+			c.as(carl).mustInvoke("accept_marble", "m1")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := seedChain(t)
+			c.as(bob).mustInvoke("offer_marble", "m1", "amy")
+			tt.move(c)
+			if c.owner("m1") != "carl" {
+				t.Fatalf("m1 belongs to %s", c.owner("m1"))
+			}
+			var history []CustodyRecord
+			c.mustQuery(&history, "marble_history", "m1")
+			last := history[len(history)-1]
+			if last.Owner != "carl" || last.PreviousOwner != "bob" || last.Reason != tt.reason {
+				t.Errorf("m1 last moved %v", last)
+			}
+			var page MarblePage
+			c.mustQuery(&page, "marbles_by_owner", "carl")
+			if len(page.Marbles) != 2 {
+				t.Errorf("carl's marbles = %v, the ownership index was not moved", page.Marbles)
+			}
+			if offers := c.offers("amy"); len(offers.Incoming) != 0 {
+				t.Errorf("amy's offers = %v, bob's offer outlived the move", offers)
+			}
+		})
+	}
+}
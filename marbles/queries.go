@@ -0,0 +1,204 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var defaultPageSize = 50 //marbles per page when the caller doesn't say
+var maxPageSize = 500    //keeps a single query from walking the whole ledger
+
+// MarblePage one page of a marble listing, pass Bookmark back to get the next page
+type MarblePage struct {
+	Marbles  []Marble `json:"marbles"`
+	Bookmark string   `json:"bookmark"` //empty on the last page
+}
+
+// ============================================================================================================================
+// parsePaging - read the optional limit and bookmark that trail a query's arguments
+// ============================================================================================================================
+func parsePaging(args []string) (int, string, error) {
+	limit := defaultPageSize
+	bookmark := ""
+	if len(args) > 2 {
+		return 0, "", argError("Incorrect number of arguments. Expecting at most a limit and a bookmark")
+	}
+	if len(args) > 0 && len(args[0]) > 0 {
+		var err error
+		limit, err = strconv.Atoi(args[0])
+		if err != nil || limit <= 0 {
+			return 0, "", argError("limit must be a positive numeric string")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+	if len(args) > 1 {
+		bookmark = args[1]
+	}
+	return limit, bookmark, nil
+}
+
+// ============================================================================================================================
+// pageMarbles - read up to limit marbles from the index keys between startKey and endKey, resuming after bookmark
+// ============================================================================================================================
+func pageMarbles(stub ChaincodeState, startKey string, endKey string, limit int, bookmark string) (MarblePage, error) {
+	page := MarblePage{Marbles: []Marble{}}
+
+	if bookmark != "" {
+		lastKey, err := hex.DecodeString(bookmark)
+		if err != nil || string(lastKey) < startKey || string(lastKey) > endKey {
+			return page, argError("bookmark does not belong to this query")
+		}
+		startKey = string(lastKey) + ledger.KeySeparator //smallest key after the last one we handed out
+	}
+
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return page, errors.New("Failed to scan marble index")
+	}
+	defer iter.Close()
+
+	lastKey := ""
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return page, errors.New("Failed to read marble index")
+		}
+		if len(page.Marbles) == limit { //there is at least one more, hand out a bookmark
+			page.Bookmark = hex.EncodeToString([]byte(lastKey))
+			break
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) == 0 {
+			continue
+		}
+
+		name := attrs[len(attrs)-1] //every marble index ends with the name
+		res, err := getMarble(stub, name)
+		lastKey = key
+		if err != nil {
+			fmt.Println("! skipping " + name + ", " + err.Error()) //index entry outlived its marble, or the record is malformed
+			continue
+		}
+		page.Marbles = append(page.Marbles, res)
+	}
+	return page, nil
+}
+
+// ============================================================================================================================
+// marblePageResponse - run a paged index scan and marshal the page
+// ============================================================================================================================
+func marblePageResponse(stub ChaincodeState, startKey string, endKey string, paging []string) ([]byte, error) {
+	limit, bookmark, err := parsePaging(paging)
+	if err != nil {
+		return nil, err
+	}
+	page, err := pageMarbles(stub, startKey, endKey, limit, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(page)
+}
+
+// ============================================================================================================================
+// List Marbles - every marble in name order
+// ============================================================================================================================
+func (t *Chaincode) list_marbles(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0*      1*
+	// "10", "bookmark"
+	startKey, endKey, err := ledger.PrefixRange(nameIndexName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return marblePageResponse(stub, startKey, endKey, args)
+}
+
+// ============================================================================================================================
+// Marbles By Owner - the marbles a user owns
+// ============================================================================================================================
+func (t *Chaincode) marbles_by_owner(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0      1*      2*
+	// "bob", "10", "bookmark"
+	if len(args) < 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the owner")
+	}
+	startKey, endKey, err := ledger.PrefixRange(ownerIndexName, []string{strings.ToLower(args[0])})
+	if err != nil {
+		return nil, err
+	}
+	return marblePageResponse(stub, startKey, endKey, args[1:])
+}
+
+// ============================================================================================================================
+// Marbles By Color - the marbles of one color
+// ============================================================================================================================
+func (t *Chaincode) marbles_by_color(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//   0       1*      2*
+	// "blue", "10", "bookmark"
+	if len(args) < 1 || len(args[0]) <= 0 {
+		return nil, argError("Incorrect number of arguments. Expecting the color")
+	}
+	startKey, endKey, err := ledger.PrefixRange(colorIndexName, []string{strings.ToLower(args[0])})
+	if err != nil {
+		return nil, err
+	}
+	return marblePageResponse(stub, startKey, endKey, args[1:])
+}
+
+// ============================================================================================================================
+// Marbles By Size Range - the marbles with min <= size <= max, smallest first
+// ============================================================================================================================
+func (t *Chaincode) marbles_by_size_range(stub ChaincodeState, args []string) ([]byte, error) {
+
+	//  0     1      2*      3*
+	// "16", "35", "10", "bookmark"
+	if len(args) < 2 {
+		return nil, argError("Incorrect number of arguments. Expecting the min and max size")
+	}
+	min, err := strconv.Atoi(args[0])
+	if err != nil || !sizeFits(min) {
+		return nil, argError("1st argument must be a non-negative numeric string of at most " + strconv.Itoa(sizeDigits) + " digits")
+	}
+	max, err := strconv.Atoi(args[1])
+	if err != nil || max < min || !sizeFits(max) {
+		return nil, argError("2nd argument must be a numeric string of at most " + strconv.Itoa(sizeDigits) + " digits no smaller than the 1st")
+	}
+	startKey, _, err := ledger.PrefixRange(sizeIndexName, []string{sizeAttribute(min)})
+	if err != nil {
+		return nil, err
+	}
+	_, endKey, err := ledger.PrefixRange(sizeIndexName, []string{sizeAttribute(max)})
+	if err != nil {
+		return nil, err
+	}
+	return marblePageResponse(stub, startKey, endKey, args[2:])
+}
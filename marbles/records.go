@@ -0,0 +1,212 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// RecordProblem a stored record that failed validation
+type RecordProblem struct {
+	Key     string `json:"key"`
+	Problem string `json:"problem"`
+}
+
+// RecordReport the result of validate_records
+type RecordReport struct {
+	Checked  int             `json:"checked"`
+	Problems []RecordProblem `json:"problems"`
+}
+
+// ============================================================================================================================
+// decodeMarble - unmarshal a stored marble and check it is complete
+// ============================================================================================================================
+func decodeMarble(marbleAsBytes []byte) (Marble, error) {
+	var res Marble
+	if marbleAsBytes == nil {
+		return res, errors.New("record is missing")
+	}
+	err := json.Unmarshal(marbleAsBytes, &res)
+	if err != nil {
+		return res, errors.New("record is not valid JSON: " + err.Error())
+	}
+
+	var v ValidationError
+	v.requireString("name", res.Name)
+	v.requireString("color", res.Color)
+	if res.Size < 0 {
+		v = append(v, FieldError{"size", "must not be negative"})
+	}
+	v.requireString("user", res.User)
+	if len(v) > 0 {
+		return res, v
+	}
+	return res, nil
+}
+
+// ============================================================================================================================
+// getMarble - read a marble, anything stored under the name that isn't a well formed marble is an error
+// ============================================================================================================================
+func getMarble(stub ChaincodeState, name string) (Marble, error) {
+	key, err := marbleKey(name)
+	if err != nil {
+		return Marble{}, err
+	}
+	marbleAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return Marble{}, errors.New("Failed to get marble " + name)
+	}
+	if marbleAsBytes == nil {
+		return Marble{}, notFound("marble " + name + " does not exist")
+	}
+	res, err := decodeMarble(marbleAsBytes)
+	if err != nil {
+		return res, errors.New("marble " + name + " is malformed - " + err.Error())
+	}
+	if res.Name != name {
+		return res, notFound("marble " + name + " does not exist")
+	}
+	return res, nil
+}
+
+// ============================================================================================================================
+// putMarble - write a marble under its key, the indexes are up to the caller
+// ============================================================================================================================
+func putMarble(stub ChaincodeState, m Marble) error {
+	key, err := marbleKey(m.Name)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(m)
+	return stub.PutState(key, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// decodeTrade - unmarshal a stored open trade and check it is complete
+// ============================================================================================================================
+func decodeTrade(tradeAsBytes []byte) (AnOpenTrade, error) {
+	var trade AnOpenTrade
+	if tradeAsBytes == nil {
+		return trade, errors.New("record is missing")
+	}
+	err := json.Unmarshal(tradeAsBytes, &trade)
+	if err != nil {
+		return trade, errors.New("record is not valid JSON: " + err.Error())
+	}
+
+	var v ValidationError
+	v.requireString("user", trade.User)
+	if trade.Timestamp <= 0 {
+		v = append(v, FieldError{"timestamp", "must be set"})
+	}
+	if trade.isBundle() {
+		v.requireDescriptions("wants", trade.Wants)
+		if len(trade.Gives) == 0 {
+			v = append(v, FieldError{"gives", "must offer at least one marble"})
+		}
+		v.requireDescriptions("gives", trade.Gives)
+	} else {
+		v.requireString("want.color", trade.Want.Color)
+		if trade.Want.Size < 0 {
+			v = append(v, FieldError{"want.size", "must not be negative"})
+		}
+		if len(trade.Willing) == 0 {
+			v = append(v, FieldError{"willing", "must offer at least one marble"})
+		}
+		v.requireDescriptions("willing", trade.Willing)
+	}
+	if len(v) > 0 {
+		return trade, v
+	}
+	return trade, nil
+}
+
+// ============================================================================================================================
+// requireDescriptions - note stored marble descriptions without a color or with a negative size or quantity
+// ============================================================================================================================
+func (v *ValidationError) requireDescriptions(field string, descriptions []Description) {
+	for i, d := range descriptions {
+		f := field + "[" + strconv.Itoa(i) + "]"
+		v.requireString(f+".color", d.Color)
+		if d.Size < 0 {
+			*v = append(*v, FieldError{f + ".size", "must not be negative"})
+		}
+		if d.Quantity < 0 {
+			*v = append(*v, FieldError{f + ".quantity", "must not be negative"})
+		}
+	}
+}
+
+// ============================================================================================================================
+// Validate Records - decode every indexed marble and every open trade, report the ones that are malformed
+// ============================================================================================================================
+func (t *Chaincode) validate_records(stub ChaincodeState, args []string) ([]byte, error) {
+	report := RecordReport{Problems: []RecordProblem{}}
+
+	iter, err := ledger.ScanIndex(stub, nameIndexName, nil)
+	if err != nil {
+		return nil, errors.New("Failed to scan marble index")
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read marble index")
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 1 {
+			continue
+		}
+		report.Checked++
+		_, err = getMarble(stub, attrs[0])
+		if err != nil {
+			report.Problems = append(report.Problems, RecordProblem{Key: attrs[0], Problem: err.Error()})
+		}
+	}
+
+	trades, err := ledger.ScanIndex(stub, tradeObject, nil)
+	if err != nil {
+		return nil, errors.New("Failed to scan open trades")
+	}
+	defer trades.Close()
+	for trades.HasNext() {
+		key, tradeAsBytes, err := trades.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read open trades")
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) != 1 {
+			continue
+		}
+		report.Checked++
+		trade, err := decodeTrade(tradeAsBytes)
+		if err == nil && tradeID(trade) != attrs[0] {
+			err = errors.New("record is stored under the wrong id " + tradeID(trade))
+		}
+		if err != nil {
+			report.Problems = append(report.Problems, RecordProblem{Key: "trade " + attrs[0], Problem: err.Error()})
+		}
+	}
+	return json.Marshal(report)
+}
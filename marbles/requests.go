@@ -0,0 +1,477 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// Every invoke accepts either its positional string arguments or a single JSON object matching one of the
+// request structs below. A JSON request is validated field by field and then handed to the handler in the
+// positional form, so both forms go through the same code.
+
+// FieldError what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError every problem found in a request
+type ValidationError []FieldError
+
+// RequestError a request the caller got wrong or may not make, shared with SmartPay, see ledger/errors.go
+type RequestError = ledger.RequestError
+
+// the RequestError each handler failure is reported as
+var argError = ledger.ArgError //400, the arguments are missing, extra, malformed or no longer hold
+var denied = ledger.Denied     //403, the caller is not allowed to do this
+var notFound = ledger.NotFound //404, the marble, trade, offer or note it names does not exist
+var conflict = ledger.Conflict //409, it clashes with the ledger, like a marble name that is taken
+
+// request a typed invoke argument
+type request interface {
+	validate() ValidationError
+	args() []string //the positional form the handler expects
+}
+
+// InitRequest arguments for init
+type InitRequest struct {
+	Value *int `json:"value"` //test value stored under "abc"
+}
+
+// NameRequest arguments for delete, accept_marble, reject_marble and delete_note
+type NameRequest struct {
+	Name string `json:"name"`
+}
+
+// WriteRequest arguments for write, ecrire and set_note
+type WriteRequest struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// InitMarbleRequest arguments for init_marble
+type InitMarbleRequest struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	Size  *int   `json:"size"`
+	User  string `json:"user"`
+}
+
+// SetUserRequest arguments for set_user
+type SetUserRequest struct {
+	Name string `json:"name"`
+	User string `json:"user"`
+}
+
+// DescriptionRequest a marble color and size inside a trade request
+type DescriptionRequest struct {
+	Color string `json:"color"`
+	Size  *int   `json:"size"`
+}
+
+// OpenTradeRequest arguments for open_trade
+type OpenTradeRequest struct {
+	User    string               `json:"user"`
+	Want    DescriptionRequest   `json:"want"`
+	Willing []DescriptionRequest `json:"willing"`
+	Expires string               `json:"expires"` //optional, RFC 3339 or a duration such as 36h
+}
+
+// OpenEscrowTradeRequest arguments for open_escrow_trade
+type OpenEscrowTradeRequest struct {
+	User    string             `json:"user"`
+	Want    DescriptionRequest `json:"want"`
+	Marbles []string           `json:"marbles"` //names of the marbles to lock for the trade
+	Expires string             `json:"expires"` //optional, RFC 3339 or a duration such as 36h
+}
+
+// BundleItemRequest a kind of marble and how many of it inside a bundle trade request
+type BundleItemRequest struct {
+	Color    string `json:"color"`
+	Size     *int   `json:"size"`
+	Quantity *int   `json:"quantity"`
+}
+
+// OpenBundleTradeRequest arguments for open_bundle_trade
+type OpenBundleTradeRequest struct {
+	User    string              `json:"user"`
+	Wants   []BundleItemRequest `json:"wants"`
+	Gives   []BundleItemRequest `json:"gives"`
+	Expires string              `json:"expires"` //optional, RFC 3339 or a duration such as 36h
+}
+
+// TradeCloserRequest the closing side of perform_trade
+type TradeCloserRequest struct {
+	User  string   `json:"user"`
+	Name  string   `json:"name"`  //marble the closer gives up
+	Names []string `json:"names"` //or, for a bundle trade, every marble the closer gives up
+}
+
+// TradeOpenerRequest the opening side of perform_trade
+type TradeOpenerRequest struct {
+	User  string `json:"user"`
+	Color string `json:"color"` //kind of marble the closer gets, not used by bundle trades
+	Size  *int   `json:"size"`
+}
+
+// PerformTradeRequest arguments for perform_trade
+type PerformTradeRequest struct {
+	ID     string             `json:"id"`
+	Closer TradeCloserRequest `json:"closer"`
+	Opener TradeOpenerRequest `json:"opener"`
+}
+
+// OfferMarbleRequest arguments for offer_marble
+type OfferMarbleRequest struct {
+	Name    string `json:"name"`
+	To      string `json:"to"`
+	Expires string `json:"expires"` //optional, RFC 3339 or a duration such as 36h
+}
+
+// TradeIDRequest arguments for remove_trade
+type TradeIDRequest struct {
+	ID string `json:"id"`
+}
+
+// ResetRequest arguments for reset
+type ResetRequest struct {
+	Confirm string `json:"confirm"` //must be "RESET"
+	Limit   *int   `json:"limit"`   //optional, most keys deleted in one call
+}
+
+// PageRequest arguments for purge_expired_trades and migrate_keyspace, which work through the ledger a page at a time
+type PageRequest struct {
+	Limit    *int   `json:"limit"`    //optional, most keys looked at in one call
+	Bookmark string `json:"bookmark"` //optional, from the previous call
+}
+
+// MigrateRequest arguments for migrate_marble_index and migrate_open_trades, they take none
+type MigrateRequest struct{}
+
+// ============================================================================================================================
+// Error - list every field problem in one message
+// ============================================================================================================================
+func (v ValidationError) Error() string {
+	var problems []string
+	for _, e := range v {
+		problems = append(problems, e.Field+": "+e.Message)
+	}
+	return "Invalid request - " + strings.Join(problems, "; ")
+}
+
+// ============================================================================================================================
+// requireString - note a missing string field
+// ============================================================================================================================
+func (v *ValidationError) requireString(field string, value string) {
+	if len(strings.TrimSpace(value)) <= 0 {
+		*v = append(*v, FieldError{field, "must be a non-empty string"})
+	}
+}
+
+// ============================================================================================================================
+// requireSize - note a missing or negative size field
+// ============================================================================================================================
+func (v *ValidationError) requireSize(field string, value *int) {
+	if value == nil {
+		*v = append(*v, FieldError{field, "is required"})
+	} else if *value < 0 {
+		*v = append(*v, FieldError{field, "must not be negative"})
+	}
+}
+
+// ============================================================================================================================
+// requireBundle - note an empty bundle, or an item without a color, size or positive quantity
+// ============================================================================================================================
+func (v *ValidationError) requireBundle(field string, items []BundleItemRequest) {
+	if len(items) == 0 {
+		*v = append(*v, FieldError{field, "must list at least one kind of marble"})
+	}
+	for i, item := range items {
+		f := field + "[" + strconv.Itoa(i) + "]"
+		v.requireString(f+".color", item.Color)
+		v.requireSize(f+".size", item.Size)
+		if item.Quantity == nil || *item.Quantity <= 0 {
+			*v = append(*v, FieldError{f + ".quantity", "must be a positive number"})
+		}
+	}
+}
+
+// ============================================================================================================================
+// requireLimit - note a page size that is given but not positive
+// ============================================================================================================================
+func (v *ValidationError) requireLimit(field string, value *int) {
+	if value != nil && *value <= 0 {
+		*v = append(*v, FieldError{field, "must be a positive number"})
+	}
+}
+
+// ============================================================================================================================
+// limitArgs - the optional page size in positional form, nothing when it wasn't given
+// ============================================================================================================================
+func limitArgs(limit *int) []string {
+	if limit == nil {
+		return nil
+	}
+	return []string{strconv.Itoa(*limit)}
+}
+
+// ============================================================================================================================
+// requestArgs - turn a single JSON object argument into the positional args, anything else is positional
+// ============================================================================================================================
+func requestArgs(args []string, req request) ([]string, error) {
+	if len(args) != 1 || !isJSONObject(args[0]) {
+		return args, nil //so a marble named "{x" can still be given positionally
+	}
+	decoder := json.NewDecoder(strings.NewReader(args[0]))
+	decoder.DisallowUnknownFields() //a misspelt field is an error, not a silently missing value
+	err := decoder.Decode(req)
+	if err != nil {
+		return nil, ValidationError{{"request", "does not match the request: " + err.Error()}}
+	}
+	problems := req.validate()
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return req.args(), nil
+}
+
+// ============================================================================================================================
+// isJSONObject - true when arg is one whole JSON object and nothing else
+// ============================================================================================================================
+func isJSONObject(arg string) bool {
+	arg = strings.TrimSpace(arg)
+	return strings.HasPrefix(arg, "{") && json.Valid([]byte(arg))
+}
+
+// ============================================================================================================================
+// sizeArg - format a validated size for the positional form
+// ============================================================================================================================
+func sizeArg(size *int) string {
+	if size == nil {
+		return ""
+	}
+	return strconv.Itoa(*size)
+}
+
+func (r *InitRequest) validate() ValidationError {
+	var v ValidationError
+	if r.Value == nil {
+		v = append(v, FieldError{"value", "is required"})
+	}
+	return v
+}
+
+func (r *InitRequest) args() []string {
+	return []string{sizeArg(r.Value)}
+}
+
+func (r *NameRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("name", r.Name)
+	return v
+}
+
+func (r *NameRequest) args() []string {
+	return []string{r.Name}
+}
+
+func (r *WriteRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("name", r.Name)
+	return v
+}
+
+func (r *WriteRequest) args() []string {
+	return []string{r.Name, r.Value}
+}
+
+func (r *InitMarbleRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("name", r.Name)
+	v.requireString("color", r.Color)
+	v.requireSize("size", r.Size)
+	v.requireString("user", r.User)
+	return v
+}
+
+func (r *InitMarbleRequest) args() []string {
+	return []string{r.Name, r.Color, sizeArg(r.Size), r.User}
+}
+
+func (r *SetUserRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("name", r.Name)
+	v.requireString("user", r.User)
+	return v
+}
+
+func (r *SetUserRequest) args() []string {
+	return []string{r.Name, r.User}
+}
+
+func (r *OpenTradeRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("user", r.User)
+	v.requireString("want.color", r.Want.Color)
+	v.requireSize("want.size", r.Want.Size)
+	if len(r.Willing) == 0 {
+		v = append(v, FieldError{"willing", "must offer at least one marble"})
+	}
+	for i, option := range r.Willing {
+		field := "willing[" + strconv.Itoa(i) + "]"
+		v.requireString(field+".color", option.Color)
+		v.requireSize(field+".size", option.Size)
+	}
+	return v
+}
+
+func (r *OpenTradeRequest) args() []string {
+	args := []string{r.User, r.Want.Color, sizeArg(r.Want.Size)}
+	for _, option := range r.Willing {
+		args = append(args, option.Color, sizeArg(option.Size))
+	}
+	if r.Expires != "" {
+		args = append(args, r.Expires)
+	}
+	return args
+}
+
+func (r *PerformTradeRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("id", r.ID)
+	v.requireString("closer.user", r.Closer.User)
+	v.requireString("opener.user", r.Opener.User)
+	if len(r.Closer.Names) > 0 {
+		for i, name := range r.Closer.Names {
+			v.requireString("closer.names["+strconv.Itoa(i)+"]", name)
+		}
+		return v
+	}
+	v.requireString("closer.name", r.Closer.Name)
+	v.requireString("opener.color", r.Opener.Color)
+	v.requireSize("opener.size", r.Opener.Size)
+	return v
+}
+
+func (r *PerformTradeRequest) args() []string {
+	if len(r.Closer.Names) > 0 {
+		return append([]string{r.ID, r.Closer.User, r.Opener.User}, r.Closer.Names...)
+	}
+	return []string{r.ID, r.Closer.User, r.Closer.Name, r.Opener.User, r.Opener.Color, sizeArg(r.Opener.Size)}
+}
+
+func (r *OpenEscrowTradeRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("user", r.User)
+	v.requireString("want.color", r.Want.Color)
+	v.requireSize("want.size", r.Want.Size)
+	if len(r.Marbles) == 0 {
+		v = append(v, FieldError{"marbles", "must offer at least one marble"})
+	}
+	for i, name := range r.Marbles {
+		v.requireString("marbles["+strconv.Itoa(i)+"]", name)
+	}
+	return v
+}
+
+func (r *OpenEscrowTradeRequest) args() []string {
+	return append([]string{r.User, r.Want.Color, sizeArg(r.Want.Size), r.Expires}, r.Marbles...)
+}
+
+func (r *OpenBundleTradeRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("user", r.User)
+	v.requireBundle("wants", r.Wants)
+	v.requireBundle("gives", r.Gives)
+	return v
+}
+
+func (r *OpenBundleTradeRequest) args() []string {
+	args := []string{r.User, strconv.Itoa(len(r.Wants))}
+	for _, item := range append(append([]BundleItemRequest{}, r.Wants...), r.Gives...) {
+		args = append(args, item.Color, sizeArg(item.Size), sizeArg(item.Quantity))
+	}
+	if r.Expires != "" {
+		args = append(args, r.Expires)
+	}
+	return args
+}
+
+func (r *TradeIDRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("id", r.ID)
+	return v
+}
+
+func (r *TradeIDRequest) args() []string {
+	return []string{r.ID}
+}
+
+func (r *OfferMarbleRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("name", r.Name)
+	v.requireString("to", r.To)
+	return v
+}
+
+func (r *OfferMarbleRequest) args() []string {
+	return []string{r.Name, r.To, r.Expires}
+}
+
+func (r *ResetRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireString("confirm", r.Confirm)
+	v.requireLimit("limit", r.Limit)
+	return v
+}
+
+func (r *ResetRequest) args() []string {
+	return append([]string{r.Confirm}, limitArgs(r.Limit)...)
+}
+
+func (r *PageRequest) validate() ValidationError {
+	var v ValidationError
+	v.requireLimit("limit", r.Limit)
+	return v
+}
+
+func (r *PageRequest) args() []string {
+	if r.Bookmark == "" {
+		return limitArgs(r.Limit)
+	}
+	limit := "" //parsePaging reads an empty limit as the default page size
+	if r.Limit != nil {
+		limit = strconv.Itoa(*r.Limit)
+	}
+	return []string{limit, r.Bookmark}
+}
+
+func (r *MigrateRequest) validate() ValidationError {
+	return nil
+}
+
+func (r *MigrateRequest) args() []string {
+	return nil
+}
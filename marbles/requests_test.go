@@ -0,0 +1,129 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRequestArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    request
+		args   []string
+		want   []string //positional form, when the request is valid
+		fields []string //fields reported, when it isn't
+	}{
+		{"positional passes through", &SetUserRequest{}, []string{"m1", "bob"}, []string{"m1", "bob"}, nil},
+		{"not json is positional", &SetUserRequest{}, []string{`{"name":`}, []string{`{"name":`}, nil},
+		{"unknown field", &SetUserRequest{}, []string{`{"name":"m1","owner":"bob"}`}, nil, []string{"request"}},
+		{"wrong type", &SetUserRequest{}, []string{`{"name":1,"user":"bob"}`}, nil, []string{"request"}},
+		{"init", &InitRequest{}, []string{`{"value":5}`}, []string{"5"}, nil},
+		{"init value", &InitRequest{}, []string{`{}`}, nil, []string{"value"}},
+		{"name", &NameRequest{}, []string{`{"name":"m1"}`}, []string{"m1"}, nil},
+		{"name blank", &NameRequest{}, []string{`{"name":" "}`}, nil, []string{"name"}},
+		{"write", &WriteRequest{}, []string{`{"name":"k","value":""}`}, []string{"k", ""}, nil},
+		{"init_marble", &InitMarbleRequest{}, []string{`{"name":"m1","color":"blue","size":16,"user":"bob"}`}, []string{"m1", "blue", "16", "bob"}, nil},
+		{"init_marble every field", &InitMarbleRequest{}, []string{`{"size":-1}`}, nil, []string{"name", "color", "size", "user"}},
+		{"set_user", &SetUserRequest{}, []string{`{"name":"m1","user":"bob"}`}, []string{"m1", "bob"}, nil},
+		{"open_trade", &OpenTradeRequest{}, []string{`{"user":"bob","want":{"color":"red","size":16},"willing":[{"color":"blue","size":35}],"expires":"36h"}`},
+			[]string{"bob", "red", "16", "blue", "35", "36h"}, nil},
+		{"open_trade willing", &OpenTradeRequest{}, []string{`{"user":"bob","want":{"color":"red","size":16},"willing":[{"color":"blue"}]}`}, nil, []string{"willing[0].size"}},
+		{"open_trade nothing offered", &OpenTradeRequest{}, []string{`{"user":"bob","want":{"color":"red","size":16}}`}, nil, []string{"willing"}},
+		{"open_escrow_trade", &OpenEscrowTradeRequest{}, []string{`{"user":"bob","want":{"color":"red","size":16},"marbles":["m1","m4"]}`},
+			[]string{"bob", "red", "16", "", "m1", "m4"}, nil},
+		{"open_escrow_trade marbles", &OpenEscrowTradeRequest{}, []string{`{"user":"bob","want":{"color":"red","size":16},"marbles":["m1",""]}`}, nil, []string{"marbles[1]"}},
+		{"open_escrow_trade nothing offered", &OpenEscrowTradeRequest{}, []string{`{"user":"bob","want":{"color":"red","size":16}}`}, nil, []string{"marbles"}},
+		{"open_bundle_trade", &OpenBundleTradeRequest{}, []string{`{"user":"bob","wants":[{"color":"red","size":10,"quantity":1}],"gives":[{"color":"green","size":5,"quantity":2}]}`},
+			[]string{"bob", "1", "red", "10", "1", "green", "5", "2"}, nil},
+		{"open_bundle_trade wants", &OpenBundleTradeRequest{}, []string{`{"user":"bob","wants":[],"gives":[{"color":"green","size":5,"quantity":2}]}`}, nil, []string{"wants"}},
+		{"perform_trade", &PerformTradeRequest{}, []string{`{"id":"t1","closer":{"user":"amy","name":"m2"},"opener":{"user":"bob","color":"blue","size":35}}`},
+			[]string{"t1", "amy", "m2", "bob", "blue", "35"}, nil},
+		{"perform_trade bundle", &PerformTradeRequest{}, []string{`{"id":"t1","closer":{"user":"amy","names":["m2","m5"]},"opener":{"user":"bob"}}`},
+			[]string{"t1", "amy", "bob", "m2", "m5"}, nil},
+		{"offer_marble", &OfferMarbleRequest{}, []string{`{"name":"m1","to":"amy","expires":"1h"}`}, []string{"m1", "amy", "1h"}, nil},
+		{"offer_marble to", &OfferMarbleRequest{}, []string{`{"name":"m1"}`}, nil, []string{"to"}},
+		{"remove_trade", &TradeIDRequest{}, []string{`{"id":"t1"}`}, []string{"t1"}, nil},
+		{"reset", &ResetRequest{}, []string{`{"confirm":"RESET","limit":10}`}, []string{"RESET", "10"}, nil},
+		{"reset limit", &ResetRequest{}, []string{`{"confirm":"RESET","limit":0}`}, nil, []string{"limit"}},
+		{"page", &PageRequest{}, []string{`{"limit":10}`}, []string{"10"}, nil},
+		{"page bookmark", &PageRequest{}, []string{`{"bookmark":"ab"}`}, []string{"", "ab"}, nil},
+		{"page limit", &PageRequest{}, []string{`{"limit":-1}`}, nil, []string{"limit"}},
+		{"migrate", &MigrateRequest{}, []string{`{}`}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := requestArgs(tt.args, tt.req)
+			if tt.fields == nil {
+				if err != nil || !reflect.DeepEqual(args, tt.want) {
+					t.Fatalf("requestArgs(%q) = %q, %v, want %q", tt.args, args, err, tt.want)
+				}
+				return
+			}
+			problems, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("requestArgs(%q) = %q, %v, want a ValidationError", tt.args, args, err)
+			}
+			var fields []string
+			for _, problem := range problems {
+				fields = append(fields, problem.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Fatalf("requestArgs(%q) reported %q, want %q: %s", tt.args, fields, tt.fields, err)
+			}
+		})
+	}
+}
+
+func TestBraceNamedMarbleIsPositional(t *testing.T) {
+	c := seedChain(t)
+	c.mustInvoke("init_marble", "{x", "green", "5", "bob")
+	c.as(bob).mustInvoke("set_user", "{x", "amy")
+	if c.owner("{x") != "amy" {
+		t.Fatalf("{x belongs to %q", c.owner("{x"))
+	}
+	c.as(admin).mustInvoke("delete", "{x")
+	if c.marble("{x") != nil {
+		t.Fatal("{x was not deleted")
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errUnknownInvoke, 400},
+		{errUnknownQuery, 400},
+		{ValidationError{{"name", "must be a non-empty string"}}, 400},
+		{argError("Incorrect number of arguments"), 400},
+		{denied("only an admin can reset the chaincode"), 403},
+		{notFound("marble m9 does not exist"), 404},
+		{conflict("This marble arleady exists"), 409},
+		{errors.New("Failed to get state for m1"), 500},
+	}
+	for _, tt := range tests {
+		if got := ErrorStatus(tt.err); got != tt.want {
+			t.Errorf("ErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
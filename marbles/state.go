@@ -0,0 +1,31 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// ChaincodeState is the part of the chaincode stub the handlers actually use, see the ledger package.
+// Each main package wraps its peer's stub in a shimState, tests use ledger.MemState.
+type ChaincodeState = ledger.ChaincodeState
+
+// StateIterator walks the results of a RangeQueryState call
+type StateIterator = ledger.StateIterator
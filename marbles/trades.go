@@ -0,0 +1,433 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+var tradeObject = "trade"                           //trade~<id> holds a single AnOpenTrade
+var tradeOpenerIndexName = "trade~opener~id"        //open trades by the user who opened them
+var tradeWantIndexName = "trade~want~color~size~id" //open trades by the marble they want
+
+// TradePurge what one purge_expired_trades call removed
+type TradePurge struct {
+	Trades   []string `json:"trades"`             //ids of the expired trades removed
+	Bookmark string   `json:"bookmark,omitempty"` //pass back to carry on, empty once every trade has been looked at
+}
+
+// ============================================================================================================================
+// tradeID - the id an open trade is stored and looked up under, trades from before ids existed use their timestamp
+// ============================================================================================================================
+func tradeID(trade AnOpenTrade) string {
+	if trade.ID != "" {
+		return trade.ID
+	}
+	return strconv.FormatInt(trade.Timestamp, 10)
+}
+
+// ============================================================================================================================
+// newTradeID - derive a trade id and timestamp (ms) from the transaction, so every endorser comes up with the same ones
+// ============================================================================================================================
+func newTradeID(stub ChaincodeState) (string, int64, error) {
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return "", 0, errors.New("Failed to get transaction timestamp")
+	}
+	txID := stub.GetTxID()
+	if txID == "" {
+		return "", 0, errors.New("Failed to get transaction id")
+	}
+
+	millis := txTime.UnixNano() / int64(time.Millisecond)
+	hash := sha256.Sum256([]byte(txID))
+	return strconv.FormatInt(millis, 10) + "-" + hex.EncodeToString(hash[:8]), millis, nil //time first so ids sort by age
+}
+
+// ============================================================================================================================
+// parseExpiry - read when something expires, an RFC 3339 time or a duration after now such as "36h", as utc ms, 0 never
+// ============================================================================================================================
+func parseExpiry(what string, value string, now int64) (int64, error) {
+	if len(value) <= 0 {
+		return 0, nil
+	}
+	var expiresAt int64
+	if ttl, err := time.ParseDuration(value); err == nil {
+		expiresAt = now + int64(ttl/time.Millisecond) //from the transaction timestamp, not a peer's clock
+	} else if expires, err := time.Parse(time.RFC3339, value); err == nil {
+		expiresAt = expires.UnixNano() / int64(time.Millisecond)
+	} else {
+		return 0, argError(what + " must be an RFC 3339 time or a duration such as 36h")
+	}
+	if expiresAt <= now {
+		return 0, argError(what + " must be in the future")
+	}
+	return expiresAt, nil
+}
+
+// ============================================================================================================================
+// expired - true if the trade had run out by now
+// ============================================================================================================================
+func (trade AnOpenTrade) expired(now int64) bool {
+	return trade.ExpiresAt != 0 && now >= trade.ExpiresAt
+}
+
+// ============================================================================================================================
+// liveTrades - leave out trades that have expired, without a transaction timestamp every trade is kept
+// ============================================================================================================================
+func liveTrades(stub ChaincodeState, trades []AnOpenTrade) []AnOpenTrade {
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return trades //queries may not carry a timestamp, perform_trade still refuses expired trades
+	}
+	now := txTime.UnixNano() / int64(time.Millisecond)
+	live := []AnOpenTrade{}
+	for _, trade := range trades {
+		if !trade.expired(now) {
+			live = append(live, trade)
+		}
+	}
+	return live
+}
+
+// ============================================================================================================================
+// tradeKeys - the record key followed by the index keys for an open trade
+// ============================================================================================================================
+func tradeKeys(trade AnOpenTrade) ([]string, error) {
+	id := tradeID(trade)
+	record, err := ledger.CreateCompositeKey(tradeObject, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	byOpener, err := ledger.CreateCompositeKey(tradeOpenerIndexName, []string{strings.ToLower(trade.User), id})
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{record, byOpener}
+	for _, want := range trade.wanted() { //a bundle shows up under each kind it wants
+		byWant, err := ledger.CreateCompositeKey(tradeWantIndexName, []string{strings.ToLower(want.Color), strconv.Itoa(want.Size), id})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, byWant)
+	}
+	return keys, nil
+}
+
+// ============================================================================================================================
+// getTrade - read a single open trade
+// ============================================================================================================================
+func getTrade(stub ChaincodeState, id string) (AnOpenTrade, error) {
+	var trade AnOpenTrade
+	key, err := ledger.CreateCompositeKey(tradeObject, []string{id})
+	if err != nil {
+		return trade, err
+	}
+	tradeAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return trade, errors.New("Failed to get open trade " + id)
+	}
+	if tradeAsBytes == nil {
+		return trade, notFound("Did not find open trade " + id)
+	}
+	trade, err = decodeTrade(tradeAsBytes)
+	if err != nil {
+		return trade, errors.New("Open trade " + id + " is malformed - " + err.Error())
+	}
+	return trade, nil
+}
+
+// ============================================================================================================================
+// putTrade - write an open trade and its index entries
+// ============================================================================================================================
+func putTrade(stub ChaincodeState, trade AnOpenTrade) error {
+	keys, err := tradeKeys(trade)
+	if err != nil {
+		return err
+	}
+	jsonAsBytes, _ := json.Marshal(trade)
+	err = stub.PutState(keys[0], jsonAsBytes)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys[1:] {
+		err = stub.PutState(key, indexValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// deleteTrade - remove an open trade, its index entries and its escrow locks
+// ============================================================================================================================
+func deleteTrade(stub ChaincodeState, trade AnOpenTrade) error {
+	keys, err := tradeKeys(trade)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = stub.DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range trade.Escrow { //performed, removed or expired, the marbles are free again
+		err = releaseLock(stub, name, tradeID(trade))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// listTrades - read every open trade
+// ============================================================================================================================
+func listTrades(stub ChaincodeState) ([]AnOpenTrade, error) {
+	var trades []AnOpenTrade
+	iter, err := ledger.ScanIndex(stub, tradeObject, nil)
+	if err != nil {
+		return nil, errors.New("Failed to scan open trades")
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		_, tradeAsBytes, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read open trades")
+		}
+		trade, err := decodeTrade(tradeAsBytes)
+		if err != nil {
+			fmt.Println("! skipping malformed trade, " + err.Error()) //validate_records reports these
+			continue
+		}
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// ============================================================================================================================
+// tradesFromIndex - read the open trades whose ids come last in the matching index keys
+// ============================================================================================================================
+func tradesFromIndex(stub ChaincodeState, indexName string, attributes []string) ([]AnOpenTrade, error) {
+	var trades []AnOpenTrade
+	iter, err := ledger.ScanIndex(stub, indexName, attributes)
+	if err != nil {
+		return nil, errors.New("Failed to scan trade index")
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		key, _, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read trade index")
+		}
+		_, attrs, err := ledger.SplitCompositeKey(key)
+		if err != nil || len(attrs) == 0 {
+			continue
+		}
+		trade, err := getTrade(stub, attrs[len(attrs)-1])
+		if err != nil {
+			continue //index entry outlived its trade
+		}
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+// ============================================================================================================================
+// Open Trades - list every open trade that hasn't expired, same shape the old _opentrades document had
+// ============================================================================================================================
+func (t *Chaincode) open_trades(stub ChaincodeState, args []string) ([]byte, error) {
+	var all AllTrades
+	var err error
+	all.OpenTrades, err = listTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	all.OpenTrades = liveTrades(stub, all.OpenTrades)
+	return json.Marshal(all)
+}
+
+// ============================================================================================================================
+// Trades By User - list the open trades opened by a user
+// ============================================================================================================================
+func (t *Chaincode) trades_by_user(stub ChaincodeState, args []string) ([]byte, error) {
+	var all AllTrades
+	var err error
+
+	//   0
+	// "bob"
+	if len(args) != 1 {
+		return nil, argError("Incorrect number of arguments. Expecting 1")
+	}
+	all.OpenTrades, err = tradesFromIndex(stub, tradeOpenerIndexName, []string{strings.ToLower(args[0])})
+	if err != nil {
+		return nil, err
+	}
+	all.OpenTrades = liveTrades(stub, all.OpenTrades)
+	return json.Marshal(all)
+}
+
+// ============================================================================================================================
+// Trades Wanting - list the open trades that want a marble of this color and size
+// ============================================================================================================================
+func (t *Chaincode) trades_wanting(stub ChaincodeState, args []string) ([]byte, error) {
+	var all AllTrades
+
+	//   0       1
+	// "blue", "16"
+	if len(args) != 2 {
+		return nil, argError("Incorrect number of arguments. Expecting 2")
+	}
+	size, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, argError("2nd argument must be a numeric string")
+	}
+	all.OpenTrades, err = tradesFromIndex(stub, tradeWantIndexName, []string{strings.ToLower(args[0]), strconv.Itoa(size)})
+	if err != nil {
+		return nil, err
+	}
+	all.OpenTrades = liveTrades(stub, all.OpenTrades)
+	return json.Marshal(all)
+}
+
+// ============================================================================================================================
+// Purge Expired Trades - remove open trades that have expired, looking at up to limit trades per call
+// ============================================================================================================================
+// Anyone may call it, it only removes what perform_trade would refuse anyway. Run it until it hands back no bookmark.
+func (t *Chaincode) purge_expired_trades(stub ChaincodeState, args []string) ([]byte, error) {
+	args, err := requestArgs(args, &PageRequest{}) //or a single JSON object, see requests.go
+	if err != nil {
+		return nil, err
+	}
+
+	//   0*       1*
+	// "100", "bookmark"
+	limit, bookmark, err := parsePaging(args)
+	if err != nil {
+		return nil, err
+	}
+	txTime, err := stub.GetTxTime()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+	now := txTime.UnixNano() / int64(time.Millisecond)
+
+	startKey, endKey, err := ledger.PrefixRange(tradeObject, nil)
+	if err != nil {
+		return nil, err
+	}
+	if bookmark != "" {
+		lastKey, err := hex.DecodeString(bookmark)
+		if err != nil || string(lastKey) < startKey || string(lastKey) > endKey {
+			return nil, argError("bookmark does not belong to this query")
+		}
+		startKey = string(lastKey) + ledger.KeySeparator //smallest key after the last one we looked at
+	}
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return nil, errors.New("Failed to scan open trades")
+	}
+	defer iter.Close()
+
+	report := TradePurge{Trades: []string{}}
+	looked := 0
+	lastKey := ""
+	for iter.HasNext() {
+		key, tradeAsBytes, err := iter.Next()
+		if err != nil {
+			return nil, errors.New("Failed to read open trades")
+		}
+		if looked == limit { //there is at least one more, hand out a bookmark
+			report.Bookmark = hex.EncodeToString([]byte(lastKey))
+			break
+		}
+		looked++
+		lastKey = key
+
+		trade, err := decodeTrade(tradeAsBytes)
+		if err != nil || !trade.expired(now) { //validate_records reports malformed trades
+			continue
+		}
+		err = deleteTrade(stub, trade)
+		if err != nil {
+			return nil, err
+		}
+		report.Trades = append(report.Trades, tradeID(trade))
+	}
+
+	if len(report.Trades) > 0 {
+		err = emitEvent(stub, tradesExpiredEvent, EventPayload{Trades: report.Trades})
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Println("- purged " + strconv.Itoa(len(report.Trades)) + " expired trades")
+	return json.Marshal(report)
+}
+
+// ============================================================================================================================
+// Migrate Open Trades - split the legacy _opentrades document into one record per trade, then retire the document
+// ============================================================================================================================
+func (t *Chaincode) migrate_open_trades(stub ChaincodeState, args []string) ([]byte, error) {
+	_, err := requestArgs(args, &MigrateRequest{}) //or a single JSON object, see requests.go, there are no arguments
+	if err != nil {
+		return nil, err
+	}
+	err = t.requireAdmin(stub, "migrate the open trades")
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- start migrate open trades")
+	legacyKey, tradesAsBytes, err := ledger.GetSystemDoc(stub, openTradesStr) //before or after migrate_keyspace
+	if err != nil {
+		return nil, err
+	}
+	var trades AllTrades
+	json.Unmarshal(tradesAsBytes, &trades) //un stringify it aka JSON.parse()
+
+	for _, trade := range trades.OpenTrades {
+		trade.ID = tradeID(trade) //legacy trades keep their timestamp as id
+		err = putTrade(stub, trade)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = stub.DelState(legacyKey)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("- end migrate open trades, moved " + strconv.Itoa(len(trades.OpenTrades)))
+	return []byte(strconv.Itoa(len(trades.OpenTrades))), nil
+}
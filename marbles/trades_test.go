@@ -0,0 +1,336 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package marbles
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+)
+
+// staleState holds writes back until apply, like a Fabric 1.x peer that has no read-your-writes
+type staleState struct {
+	*ledger.MemState
+	writes map[string][]byte
+}
+
+func (s *staleState) PutState(key string, value []byte) error {
+	s.writes[key] = value
+	return nil
+}
+
+func (s *staleState) DelState(key string) error {
+	s.writes[key] = nil
+	return nil
+}
+
+// apply - commit the transaction's writes
+func (s *staleState) apply() {
+	for key, value := range s.writes {
+		if value == nil {
+			delete(s.State, key)
+		} else {
+			s.State[key] = value
+		}
+	}
+	s.writes = make(map[string][]byte)
+}
+
+// brokenScans fails every range query, so cleanTrades can't list the open trades
+type brokenScans struct {
+	*ledger.MemState
+}
+
+func (s brokenScans) RangeQueryState(startKey, endKey string) (ledger.StateIterator, error) {
+	return nil, errors.New("range queries are down")
+}
+
+func TestPerformTradeMovesBothMarbles(t *testing.T) {
+	c := seedChain(t)
+	id := c.tradeID()
+	c.as(amy).mustInvoke("perform_trade", id, "amy", "m2", "bob", "blue", "35")
+
+	tests := []struct {
+		marble, owner, previous string
+	}{
+		{"m1", "amy", "bob"},
+		{"m2", "bob", "amy"},
+	}
+	for _, tt := range tests {
+		if c.owner(tt.marble) != tt.owner {
+			t.Errorf("%s belongs to %s, want %s", tt.marble, c.owner(tt.marble), tt.owner)
+		}
+		var history []CustodyRecord
+		c.mustQuery(&history, "marble_history", tt.marble)
+		last := history[len(history)-1]
+		if last.Owner != tt.owner || last.PreviousOwner != tt.previous || last.Reason != "perform_trade" {
+			t.Errorf("%s last moved %v", tt.marble, last)
+		}
+	}
+	var page MarblePage
+	c.mustQuery(&page, "marbles_by_owner", "bob")
+	if len(page.Marbles) != 1 || page.Marbles[0].Name != "m2" {
+		t.Errorf("bob's marbles = %v, the ownership index was not moved", page.Marbles)
+	}
+	if len(c.trades()) != 0 {
+		t.Error("the trade is still open")
+	}
+	if _, err := c.as(amy).invoke("perform_trade", id, "amy", "m2", "bob", "blue", "35"); err == nil {
+		t.Error("the same trade was performed twice")
+	}
+}
+
+func TestCleanTradesReadsThisTransactionsWrites(t *testing.T) {
+	c := newTestChain(t)
+	stale := &staleState{MemState: c.st, writes: make(map[string][]byte)}
+	run := func(function string, args ...string) error {
+		c.tx++
+		c.st.TxID = "tx" + strconv.Itoa(c.tx)
+		c.st.TxTime = c.st.TxTime.Add(time.Second)
+		_, err := c.cc.Invoke(stale, function, args)
+		stale.apply()
+		return err
+	}
+	for _, call := range [][]string{
+		{"init", "1"},
+		{"init_marble", "r1", "red", "16", "bob"},
+		{"init_marble", "b1", "blue", "1", "amy"},
+		{"open_trade", "bob", "blue", "1", "red", "16"},
+		{"set_user", "r1", "carl"}, //cleanTrades has to see r1 leave bob in the same transaction
+	} {
+		if err := run(call[0], call[1:]...); err != nil {
+			t.Fatalf("%q: %s", call, err)
+		}
+	}
+	if trades := c.trades(); len(trades) != 0 {
+		t.Fatalf("open trades = %v, bob no longer has the marble the trade offered", trades)
+	}
+}
+
+func TestFailedCleanTradesFailsTheInvocation(t *testing.T) {
+	c := seedChain(t)
+	c.as(bob)
+	c.tx++
+	c.st.TxID = "tx" + strconv.Itoa(c.tx)
+	if _, err := c.cc.Invoke(brokenScans{c.st}, "set_user", []string{"m1", "carl"}); err == nil {
+		t.Fatal("set_user succeeded without pruning the open trades")
+	}
+	if c.owner("m1") != "bob" || len(c.trades()) != 1 {
+		t.Fatalf("m1 belongs to %s with %d open trades, nothing should have been written", c.owner("m1"), len(c.trades()))
+	}
+}
+
+func TestTradeExpiry(t *testing.T) {
+	c := seedChain(t)
+	c.as(amy).mustInvoke("open_trade", "amy", "blue", "35", "red", "16", "1m")
+	c.as(carl).mustInvoke("open_trade", "carl", "blue", "35", "green", "5", "2016-07-01T01:00:00Z")
+	var wanting AllTrades
+	c.mustQuery(&wanting, "trades_wanting", "blue", "35")
+	if len(wanting.OpenTrades) != 2 {
+		t.Fatalf("trades wanting a blue 35 = %v", wanting.OpenTrades)
+	}
+	amys := wanting.OpenTrades[0]
+	if amys.User != "amy" {
+		amys = wanting.OpenTrades[1]
+	}
+	if amys.ExpiresAt != amys.Timestamp+60000 {
+		t.Fatalf("amy's trade expires at %d, want a minute after %d", amys.ExpiresAt, amys.Timestamp)
+	}
+
+	c.wait(2 * time.Minute)
+	if _, err := c.as(bob).invoke("perform_trade", amys.ID, "bob", "m1", "amy", "red", "16"); ErrorStatus(err) != 400 || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("performing an expired trade = %v", err)
+	}
+	var purge TradePurge
+	json.Unmarshal(c.as(bob).mustInvoke("purge_expired_trades"), &purge)
+	if len(purge.Trades) != 1 || purge.Trades[0] != amys.ID || purge.Bookmark != "" {
+		t.Fatalf("purge = %v, want only amy's trade", purge)
+	}
+	if len(c.trades()) != 2 {
+		t.Fatalf("open trades = %v, bob's and carl's have not expired", c.trades())
+	}
+
+	c.wait(time.Hour)
+	json.Unmarshal(c.mustInvoke("purge_expired_trades"), &purge)
+	if len(purge.Trades) != 1 {
+		t.Fatalf("purge = %v, want carl's trade", purge)
+	}
+}
+
+func TestPurgeExpiredTradesPages(t *testing.T) {
+	tests := []struct {
+		name  string
+		first []string
+		next  func(bookmark string) []string
+	}{
+		{"positional", []string{"1"}, func(bookmark string) []string { return []string{"1", bookmark} }},
+		{"json", []string{`{"limit":1}`}, func(bookmark string) []string { return []string{`{"bookmark":"` + bookmark + `"}`} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChain(t)
+			c.mustInvoke("init_marble", "m1", "red", "1", "bob")
+			c.mustInvoke("open_trade", "bob", "blue", "1", "red", "1", "1s")
+			c.mustInvoke("open_trade", "bob", "green", "1", "red", "1", "1s")
+			c.wait(time.Minute)
+
+			var purge TradePurge
+			json.Unmarshal(c.mustInvoke("purge_expired_trades", tt.first...), &purge)
+			if len(purge.Trades) != 1 || purge.Bookmark == "" {
+				t.Fatalf("first page = %v, want one trade and a bookmark", purge)
+			}
+			bookmark := purge.Bookmark
+			purge = TradePurge{}
+			json.Unmarshal(c.mustInvoke("purge_expired_trades", tt.next(bookmark)...), &purge)
+			if len(purge.Trades) != 1 || purge.Bookmark != "" {
+				t.Fatalf("last page = %v, want one trade and no bookmark", purge)
+			}
+			if len(c.trades()) != 0 {
+				t.Fatalf("open trades = %v", c.trades())
+			}
+		})
+	}
+}
+
+func TestEscrowTrade(t *testing.T) {
+	c := seedChain(t)
+	c.mustInvoke("init_marble", "m4", "blue", "35", "bob")
+	c.as(bob).mustInvoke("open_escrow_trade", `{"user":"bob","want":{"color":"green","size":5},"marbles":["m4"],"expires":"1h"}`)
+	var wanting AllTrades
+	c.mustQuery(&wanting, "trades_wanting", "green", "5")
+	if len(wanting.OpenTrades) != 1 || len(wanting.OpenTrades[0].Escrow) != 1 {
+		t.Fatalf("trades wanting a green 5 = %v", wanting.OpenTrades)
+	}
+	id := wanting.OpenTrades[0].ID
+
+	refused := [][]string{
+		{"set_user", "m4", "amy"},
+		{"delete", "m4"},
+		{"offer_marble", "m4", "amy"},
+		{"open_escrow_trade", "bob", "red", "16", "", "m4"},
+	}
+	for _, call := range refused {
+		if _, err := c.as(admin).invoke(call[0], call[1:]...); err == nil || !strings.Contains(err.Error(), "escrow") {
+			t.Errorf("%q while m4 is in escrow = %v", call, err)
+		}
+	}
+	c.mustInvoke("set_user", "m1", "amy") //bob's other blue 35 is free to go, and the escrow trade doesn't need it
+	if len(c.trades()) != 1 {
+		t.Fatalf("open trades = %v, want only the escrow trade", c.trades())
+	}
+
+	c.as(carl).mustInvoke("perform_trade", id, "carl", "m3", "bob", "blue", "35")
+	if c.owner("m4") != "carl" || c.owner("m3") != "bob" {
+		t.Fatalf("m4 belongs to %s and m3 to %s, want carl and bob", c.owner("m4"), c.owner("m3"))
+	}
+	if holder, _ := lockedFor(c.st, "m4"); holder != "" {
+		t.Fatalf("m4 is still held for %s", holder)
+	}
+	c.as(carl).mustInvoke("set_user", "m4", "amy")
+}
+
+func TestEscrowLockLapsesWithItsTrade(t *testing.T) {
+	c := seedChain(t)
+	c.as(amy).mustInvoke("open_escrow_trade", "amy", "blue", "35", "1m", "m2")
+	c.wait(time.Hour)
+	c.as(amy).mustInvoke("set_user", "m2", "carl")
+	if c.owner("m2") != "carl" {
+		t.Fatalf("m2 belongs to %s, the lock should have lapsed", c.owner("m2"))
+	}
+}
+
+func TestOpenTradeWillingColorEscrow(t *testing.T) {
+	c := newTestChain(t)
+	c.mustInvoke("init_marble", "x1", "escrow", "1", "bob")
+	c.as(bob).mustInvoke("open_trade", "bob", "blue", "1", "escrow", "1", "36h")
+	trades := c.trades()
+	if len(trades) != 1 || len(trades[0].Escrow) != 0 || trades[0].Willing[0].Color != "escrow" {
+		t.Fatalf("open trades = %v, want an ordinary trade offering an escrow colored marble", trades)
+	}
+}
+
+func TestBundleTrade(t *testing.T) {
+	c := newTestChain(t)
+	for _, marble := range [][]string{
+		{"b1", "blue", "16", "bob"}, {"b2", "blue", "16", "bob"}, {"b3", "red", "10", "bob"},
+		{"a1", "red", "10", "amy"}, {"a2", "green", "5", "amy"}, {"a3", "green", "5", "amy"}, {"a4", "green", "5", "amy"},
+	} {
+		c.mustInvoke("init_marble", marble...)
+	}
+	c.as(amy).mustInvoke("open_bundle_trade", "amy", "2", "blue", "16", "2", "red", "10", "1", "green", "5", "3")
+	id := c.tradeID()
+
+	tests := []struct {
+		name  string
+		names []string
+	}{
+		{"too few", []string{"b1", "b3"}},
+		{"too many", []string{"b1", "b2", "b3", "a1"}},
+		{"listed twice", []string{"b1", "b1", "b3"}},
+	}
+	for _, tt := range tests {
+		if _, err := c.as(bob).invoke("perform_trade", append([]string{id, "bob", "amy"}, tt.names...)...); err == nil {
+			t.Errorf("%s: perform_trade with %q succeeded", tt.name, tt.names)
+		}
+	}
+
+	c.as(bob).mustInvoke("perform_trade", `{"id":"`+id+`","closer":{"user":"bob","names":["b1","b2","b3"]},"opener":{"user":"amy"}}`)
+	for marble, owner := range map[string]string{"b1": "amy", "b2": "amy", "b3": "amy", "a1": "amy", "a2": "bob", "a3": "bob", "a4": "bob"} {
+		if c.owner(marble) != owner {
+			t.Errorf("%s belongs to %s, want %s", marble, c.owner(marble), owner)
+		}
+	}
+	if len(c.trades()) != 0 {
+		t.Fatal("the bundle trade is still open")
+	}
+
+	c.as(bob).mustInvoke("open_bundle_trade", "bob", "1", "red", "10", "1", "green", "5", "2")
+	c.as(bob).mustInvoke("set_user", "a2", "carl")
+	if len(c.trades()) != 1 {
+		t.Fatal("the bundle trade was pruned while bob could still cover it")
+	}
+	c.as(bob).mustInvoke("set_user", "a3", "carl")
+	if len(c.trades()) != 0 {
+		t.Fatal("the bundle trade outlived bob's last two green 5s")
+	}
+}
+
+func TestMigrateOpenTrades(t *testing.T) {
+	c := newTestChain(t)
+	c.st.State[openTradesStr] = []byte(`{"open_trades":[{"user":"amy","timestamp":5,"want":{"color":"blue","size":1},"willing":[{"color":"red","size":16}]}]}`)
+	c.mustInvoke("migrate_open_trades")
+	var mine AllTrades
+	c.mustQuery(&mine, "trades_by_user", "amy")
+	if len(mine.OpenTrades) != 1 || tradeID(mine.OpenTrades[0]) != "5" {
+		t.Fatalf("amy's trades = %v", mine.OpenTrades)
+	}
+	if _, ok := c.st.State[openTradesStr]; ok {
+		t.Fatal("the legacy document was not retired")
+	}
+	c.mustInvoke("remove_trade", "5")
+	if len(c.trades()) != 0 {
+		t.Fatal("the migrated trade could not be removed by its old id")
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"strconv"
 	"encoding/json"
+	"sort"
 	"strings"
 
 	"github.com/openblockchain/obc-peer/openchain/chaincode/shim"
@@ -35,6 +36,10 @@ type SimpleChaincode struct {
 
 var marbleIndexStr = "_marbleindex"				//name for the key/value that will store a list of all known marbles
 var openTradesStr = "_opentrades"				//name for the key/value that will store all open trades
+var roleAttribute = "role"						//certificate attribute holding the caller's role
+var adminRole = "admin"							//role allowed to re-run init, write, delete and reset
+var resetConfirmation = "RESET"					//what reset's argument must be, so nobody wipes the ledger by accident
+var chaincodeResetEvent = "chaincode_reset"		//sent once reset has run
 
 type Marble struct{
 	Name string `json:"name"`					//the fieldtags are needed to keep case from bouncing around
@@ -54,11 +59,15 @@ func main() {
 }
 
 // ============================================================================================================================
-// Init - reset all the things
+// Init - set up the test var and an empty marble index, marbles already on the ledger are kept
 // ============================================================================================================================
 func (t *SimpleChaincode) init(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
 	var Aval int
 	var err error
+	args, err = requestArgs(args, "value")				//or a single JSON object
+	if err != nil {
+		return nil, err
+	}
 
 	if len(args) != 1 {
 		return nil, errors.New("Incorrect number of arguments. Expecting 1")
@@ -76,9 +85,7 @@ func (t *SimpleChaincode) init(stub *shim.ChaincodeStub, args []string) ([]byte,
 		return nil, err
 	}
 	
-	var empty []string
-	jsonAsBytes, _ := json.Marshal(empty)								//marshal an emtpy array of strings to clear the index
-	err = stub.PutState(marbleIndexStr, jsonAsBytes)
+	err = initIndex(stub, marbleIndexStr, []string{})					//only if there is none, init used to wipe the index
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +93,67 @@ func (t *SimpleChaincode) init(stub *shim.ChaincodeStub, args []string) ([]byte,
 	return nil, nil
 }
 
+// ============================================================================================================================
+// initIndex - store empty under name unless something is already there
+// ============================================================================================================================
+func initIndex(stub *shim.ChaincodeStub, name string, empty interface{}) error {
+	indexAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return errors.New("Failed to get " + name)
+	}
+	if len(indexAsBytes) > 0 {
+		return nil
+	}
+	jsonAsBytes, _ := json.Marshal(empty)
+	return stub.PutState(name, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// requireAdmin - make sure the caller's certificate carries the admin role
+// ============================================================================================================================
+func requireAdmin(stub *shim.ChaincodeStub, action string) error {
+	role, err := stub.ReadCertAttribute(roleAttribute)
+	if err != nil || strings.ToLower(strings.TrimSpace(string(role))) != adminRole {
+		fmt.Println("! caller without the " + adminRole + " role tried to " + action)
+		return errors.New("only an admin can " + action)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// requestArgs - turn a single JSON object argument into the positional args, one per field and in the same order
+// ============================================================================================================================
+func requestArgs(args []string, fields ...string) ([]string, error) {
+	if len(args) != 1 || !strings.HasPrefix(strings.TrimSpace(args[0]), "{") || !json.Valid([]byte(args[0])) {
+		return args, nil													//anything else is positional, a marble named "{x" included
+	}
+	var req map[string]json.RawMessage
+	err := json.Unmarshal([]byte(args[0]), &req)
+	if err != nil {
+		return nil, errors.New("request must be a JSON object - " + err.Error())
+	}
+	positional := make([]string, len(fields))
+	for i, field := range fields {
+		raw, ok := req[field]
+		if !ok {
+			return nil, errors.New("request is missing " + field)
+		}
+		delete(req, field)
+		if json.Unmarshal(raw, &positional[i]) != nil {
+			positional[i] = string(raw)										//numbers are passed on as written
+		}
+	}
+	if len(req) > 0 {														//a misspelt field is an error, not a missing value
+		var unknown []string
+		for field := range req {
+			unknown = append(unknown, field)
+		}
+		sort.Strings(unknown)										//same message on every peer
+		return nil, errors.New("request has unknown fields " + strings.Join(unknown, ", "))
+	}
+	return positional, nil
+}
+
 // ============================================================================================================================
 // Run - Our entry point
 // ============================================================================================================================
@@ -93,8 +161,14 @@ func (t *SimpleChaincode) Run(stub *shim.ChaincodeStub, function string, args []
 	fmt.Println("run is running " + function)
 
 	// Handle different functions
-	if function == "init" {													//initialize the chaincode state, used as reset
+	if function == "init" {													//initialize the chaincode state
+		err := requireAdmin(stub, "run init")								//deploy comes through here too, so the deployer needs the admin role
+		if err != nil {
+			return nil, err
+		}
 		return t.init(stub, args)
+	} else if function == "reset" {											//deletes every marble and empties the index
+		return t.reset(stub, args)
 	} else if function == "delete" {										//deletes an entity from its state
 		return t.Delete(stub, args)
 	} else if function == "write" {											//writes a value to the chaincode state
@@ -145,16 +219,70 @@ func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte,
 	return valAsbytes, nil													//send it onward
 }
 
+// ============================================================================================================================
+// Reset - delete every marble and empty the index, admin only, takes the place init used to have
+// ============================================================================================================================
+func (t *SimpleChaincode) reset(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+	args, err := requestArgs(args, "confirm")								//or a single JSON object
+	if err != nil {
+		return nil, err
+	}
+	err = requireAdmin(stub, "reset the chaincode")
+	if err != nil {
+		return nil, err
+	}
+
+	//    0
+	// "RESET"
+	if len(args) != 1 || args[0] != resetConfirmation {
+		return nil, errors.New("reset deletes every marble, pass \"" + resetConfirmation + "\" to confirm")
+	}
+
+	marblesAsBytes, err := stub.GetState(marbleIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get marble index")
+	}
+	var marbleIndex []string
+	json.Unmarshal(marblesAsBytes, &marbleIndex)							//un stringify it aka JSON.parse()
+	for _, name := range marbleIndex {
+		err = stub.DelState(name)
+		if err != nil {
+			return nil, errors.New("Failed to delete " + name)
+		}
+	}
+	jsonAsBytes, _ := json.Marshal([]string{})
+	err = stub.PutState(marbleIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- reset deleted " + strconv.Itoa(len(marbleIndex)) + " marbles")
+	payload, _ := json.Marshal(map[string]interface{}{"tx_id": stub.UUID, "deleted": len(marbleIndex)})
+	err = stub.SetEvent(chaincodeResetEvent, payload)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 // ============================================================================================================================
 // Delete - remove a key/value pair from state
 // ============================================================================================================================
 func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+	args, err := requestArgs(args, "name")									//or a single JSON object
+	if err != nil {
+		return nil, err
+	}
 	if len(args) != 1 {
 		return nil, errors.New("Incorrect number of arguments. Expecting 1")
 	}
+	err = requireAdmin(stub, "delete state")								//deletes any key, not just the caller's marbles
+	if err != nil {
+		return nil, err
+	}
 	
 	name := args[0]
-	err := stub.DelState(name)													//remove the key from chaincode state
+	err = stub.DelState(name)													//remove the key from chaincode state
 	if err != nil {
 		return nil, errors.New("Failed to delete state")
 	}
@@ -190,11 +318,19 @@ func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byt
 func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
 	var name, value string // Entities
 	var err error
+	args, err = requestArgs(args, "name", "value")				//or a single JSON object
+	if err != nil {
+		return nil, err
+	}
 	fmt.Println("running write()")
 
 	if len(args) != 2 {
 		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
 	}
+	err = requireAdmin(stub, "write state")								//overwrites any key, marbles and the index included
+	if err != nil {
+		return nil, err
+	}
 
 	name = args[0]															//rename for funsies
 	value = args[1]
@@ -210,6 +346,10 @@ func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte
 // ============================================================================================================================
 func (t *SimpleChaincode) init_marble(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
 	var err error
+	args, err = requestArgs(args, "name", "color", "size", "user")				//or a single JSON object
+	if err != nil {
+		return nil, err
+	}
 
 	//   0       1       2     3
 	// "asdf", "blue", "35", "bob"
@@ -268,6 +408,10 @@ func (t *SimpleChaincode) init_marble(stub *shim.ChaincodeStub, args []string) (
 // ============================================================================================================================
 func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
 	var err error
+	args, err = requestArgs(args, "name", "user")				//or a single JSON object
+	if err != nil {
+		return nil, err
+	}
 	
 	//   0       1
 	// "name", "bob"
@@ -0,0 +1,94 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/ledger"
+	"github.com/chaitanyaamin/marbles-chaincode/marbles"
+	"github.com/openblockchain/obc-peer/openchain/chaincode/shim"
+)
+
+// newTestChaincode - a SimpleChaincode whose handlers see st instead of the peer's stub, called by an admin
+func newTestChaincode(st *ledger.MemState) *SimpleChaincode {
+	cc := &SimpleChaincode{State: func(*shim.ChaincodeStub) marbles.ChaincodeState { return st }}
+	cc.Marbles.Identify = func(marbles.ChaincodeState) (marbles.Caller, error) {
+		return marbles.Caller{User: "admin", Role: "admin"}, nil
+	}
+	return cc
+}
+
+func TestRunAndQuery(t *testing.T) {
+	st := ledger.NewMemState()
+	st.TxID = "tx1"
+	st.TxTime = time.Date(2016, 4, 25, 0, 0, 0, 0, time.UTC)
+	cc := newTestChaincode(st)
+	stub := &shim.ChaincodeStub{UUID: "tx1"}
+
+	for _, call := range [][]string{
+		{"init", "100"},
+		{"init_marble", "m1", "blue", "35", "bob"},
+	} {
+		_, err := cc.Run(stub, call[0], call[1:])
+		if err != nil {
+			t.Fatalf("run %q: %s", call, err)
+		}
+	}
+
+	res, err := cc.Query(stub, "read", []string{"m1"})
+	if err != nil {
+		t.Fatalf("read m1: %s", err)
+	}
+	var m marbles.Marble
+	err = json.Unmarshal(res, &m)
+	if err != nil {
+		t.Fatalf("read m1 answered %q: %s", res, err)
+	}
+	if m.Name != "m1" || m.Color != "blue" || m.Size != 35 || m.User != "bob" {
+		t.Errorf("read m1 = %+v", m)
+	}
+
+	_, err = cc.Run(stub, "no_such_invoke", nil)
+	if err == nil {
+		t.Error("run of an unknown function succeeded")
+	}
+	_, err = cc.Query(stub, "no_such_query", nil)
+	if err == nil {
+		t.Error("query of an unknown function succeeded")
+	}
+	_, err = cc.Run(stub, "init_marble", []string{"m1", "red", "16", "amy"})
+	if err == nil {
+		t.Error("run recreated m1")
+	}
+}
+
+func TestShimState(t *testing.T) {
+	stub := &shim.ChaincodeStub{UUID: "tx7"}
+	st, ok := new(SimpleChaincode).state(stub).(shimState)
+	if !ok || st.ChaincodeStub != stub {
+		t.Fatalf("state wraps the peer's stub as %#v", st)
+	}
+	if id := st.GetTxID(); id != "tx7" {
+		t.Errorf("GetTxID = %q, want tx7", id)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	"github.com/chaitanyaamin/marbles-chaincode/marbles"
+	"github.com/openblockchain/obc-peer/openchain/chaincode/shim"
+)
+
+// shimState adapts the peer's stub to marbles.ChaincodeState
+type shimState struct {
+	*shim.ChaincodeStub
+}
+
+// ============================================================================================================================
+// RangeQueryState - hand back the shim iterator as a marbles.StateIterator
+// ============================================================================================================================
+func (s shimState) RangeQueryState(startKey, endKey string) (marbles.StateIterator, error) {
+	iter, err := s.ChaincodeStub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	return iter, nil
+}
+
+// ============================================================================================================================
+// GetTxID - the transaction's uuid
+// ============================================================================================================================
+func (s shimState) GetTxID() string {
+	return s.UUID
+}
+
+// ============================================================================================================================
+// GetTxTime - the transaction timestamp as a time.Time
+// ============================================================================================================================
+func (s shimState) GetTxTime() (time.Time, error) {
+	ts, err := s.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}